@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -42,6 +43,7 @@ type attachment struct {
 	Name    string               `json:"name"`
 	Header  textproto.MIMEHeader `json:"header"`
 	Content []byte               `json:"content"`
+	URL     string               `json:"url"`
 }
 
 type httpResp struct {
@@ -116,6 +118,7 @@ func handlePostback(w http.ResponseWriter, r *http.Request) {
 				Name:    f.Name,
 				Header:  f.Header,
 				Content: make([]byte, len(f.Content)),
+				URL:     f.URL,
 			}
 			copy(a.Content, f.Content)
 			files = append(files, a)
@@ -127,10 +130,10 @@ func handlePostback(w http.ResponseWriter, r *http.Request) {
 	app.logger.DebugWith("sending message").String("provider", provider).String("message", fmt.Sprintf("%#+v", message)).Write()
 
 	// Send message.
-	response, err := p.Push(message)
+	response, err := p.Push(r.Context(), message)
 	if err != nil {
 		app.logger.ErrorWith("error sending message").Err("err", err).Write()
-		sendErrorResponse(w, "error sending message", http.StatusInternalServerError, nil)
+		sendErrorResponse(w, "error sending message", errorStatus(err), nil)
 		return
 	}
 
@@ -138,6 +141,93 @@ func handlePostback(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// handleDeliveryReceipt parses a delivery receipt sent by the provider of
+// the messenger in the url params.
+func handleDeliveryReceipt(w http.ResponseWriter, r *http.Request) {
+	var (
+		app      = r.Context().Value("app").(*App)
+		provider = chi.URLParam(r, "provider")
+	)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		app.logger.ErrorWith("error reading request body").Err("err", err).Write()
+		sendErrorResponse(w, "invalid body", http.StatusBadRequest, nil)
+		return
+	}
+	defer r.Body.Close()
+
+	p, ok := app.messengers[provider]
+	if !ok {
+		sendErrorResponse(w, "unknown provider", http.StatusBadRequest, nil)
+		return
+	}
+	dr, ok := p.(messenger.DeliveryReporter)
+	if !ok {
+		sendErrorResponse(w, "provider does not support delivery receipts", http.StatusBadRequest, nil)
+		return
+	}
+
+	st, err := dr.HandleDeliveryReceipt(r.Context(), body)
+	if errors.Is(err, messenger.ErrSubscriptionConfirmed) {
+		sendResponse(w, "subscription confirmed")
+		return
+	}
+	if err != nil {
+		app.logger.ErrorWith("error parsing delivery receipt").String("provider", provider).Err("err", err).Write()
+		sendErrorResponse(w, "invalid delivery receipt", http.StatusBadRequest, nil)
+		return
+	}
+
+	sendResponse(w, st)
+}
+
+// handleHealthCheck runs the health checks of all loaded messengers that
+// support them and reports the failing ones.
+func handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value("app").(*App)
+
+	failed := make(map[string]string)
+	for name, m := range app.messengers {
+		hc, ok := m.(messenger.HealthChecker)
+		if !ok {
+			continue
+		}
+
+		if err := hc.HealthCheck(r.Context()); err != nil {
+			app.logger.ErrorWith("health check failed").String("provider", name).Err("err", err).Write()
+			failed[name] = err.Error()
+		}
+	}
+
+	if len(failed) > 0 {
+		sendErrorResponse(w, "health check failed", http.StatusServiceUnavailable, failed)
+		return
+	}
+
+	sendResponse(w, "ok")
+}
+
+// errorStatus maps messenger errors to HTTP status codes.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, messenger.ErrInvalidRecipient), errors.Is(err, messenger.ErrOptedOut):
+		return http.StatusBadRequest
+	case errors.Is(err, messenger.ErrUnregistered):
+		return http.StatusGone
+	case errors.Is(err, messenger.ErrMessageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, messenger.ErrThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, messenger.ErrAuth):
+		return http.StatusBadGateway
+	case errors.Is(err, messenger.ErrClosed), errors.Is(err, messenger.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // wrap is a middleware that wraps HTTP handlers and injects the "app" context.
 func wrap(app *App, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
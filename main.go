@@ -74,27 +74,15 @@ func init() {
 func loadMessengers(msgrs []string, app *App) {
 	app.messengers = make(map[string]messenger.Messenger)
 
+	reg := messenger.NewRegistry()
+
 	for _, m := range msgrs {
 		var cfg MessengerCfg
 		if err := ko.Unmarshal("messenger."+m, &cfg); err != nil {
 			log.Fatalf("error reading %s messenger config: %v", m, err)
 		}
 
-		var (
-			msgr messenger.Messenger
-			err  error
-		)
-		switch m {
-		case "pinpoint":
-			msgr, err = messenger.NewPinpoint([]byte(cfg.Config), app.logger)
-		case "ses":
-			msgr, err = messenger.NewAWSSES([]byte(cfg.Config), app.logger)
-		case "twilio":
-			msgr, err = messenger.NewTwilio([]byte(cfg.Config), app.logger)
-		default:
-			log.Fatalf("invalid provider: %s", m)
-		}
-
+		msgr, err := reg.New(m, []byte(cfg.Config), app.logger)
 		if err != nil {
 			log.Fatalf("error creating %s messenger: %v", m, err)
 		}
@@ -124,6 +112,8 @@ func main() {
 
 	r := chi.NewRouter()
 	r.Post("/webhook/{provider}", wrap(app, handlePostback))
+	r.Post("/delivery/{provider}", wrap(app, handleDeliveryReceipt))
+	r.Get("/health", wrap(app, handleHealthCheck))
 
 	// HTTP Server.
 	srv := &http.Server{
@@ -0,0 +1,172 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// awsCfg holds the connection and credential settings shared by the AWS
+// backed messengers.
+type awsCfg struct {
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Region    string `json:"region"`
+	Endpoint  string `json:"endpoint"`
+
+	// RoleARN is an optional IAM role to assume using the base
+	// credentials, eg: for cross-account access.
+	RoleARN    string `json:"role_arn"`
+	ExternalID string `json:"external_id"`
+
+	// UseWebIdentity forces credentials to be loaded from the web identity
+	// token (eg: IRSA on EKS) pointed to by the standard AWS_ROLE_ARN and
+	// AWS_WEB_IDENTITY_TOKEN_FILE env vars.
+	UseWebIdentity bool `json:"use_web_identity"`
+
+	// MaxRetries is the number of times the SDK retries failed requests.
+	// It defaults to 3 when unset and 0 disables retries.
+	MaxRetries *int `json:"max_retries"`
+
+	// UseSharedConfig loads settings missing from the config, eg: the
+	// region, from the shared config (~/.aws/config) and the AWS_REGION
+	// and AWS_PROFILE env vars.
+	UseSharedConfig bool `json:"use_shared_config"`
+
+	// Profile is a named profile in the shared config and credentials
+	// files, eg: for local development. It implies UseSharedConfig. The
+	// access and secret keys, if set, take precedence over the profile's
+	// credentials.
+	Profile string `json:"profile"`
+}
+
+// awsDefaultMaxRetries is the number of SDK retries when max_retries isn't set.
+const awsDefaultMaxRetries = 3
+
+// awsErrors maps AWS error codes to the package's error sentinels.
+var awsErrors = map[string]error{
+	"Throttling":                  ErrThrottled,
+	"ThrottlingException":         ErrThrottled,
+	"TooManyRequestsException":    ErrThrottled,
+	"LimitExceededException":      ErrThrottled,
+	"InvalidClientTokenId":        ErrAuth,
+	"UnrecognizedClientException": ErrAuth,
+	"SignatureDoesNotMatch":       ErrAuth,
+	"IncompleteSignature":         ErrAuth,
+	"MissingAuthenticationToken":  ErrAuth,
+	"ExpiredToken":                ErrAuth,
+	"ExpiredTokenException":       ErrAuth,
+	"AccessDenied":                ErrAuth,
+	"AccessDeniedException":       ErrAuth,
+	"MessageRejected":             ErrInvalidRecipient,
+	"InvalidParameterValue":       ErrInvalidRecipient,
+	"InvalidParameter":            ErrInvalidRecipient,
+}
+
+// wrapAWSError wraps AWS errors with the matching error sentinel so that
+// callers can check them with errors.Is while still having access to the
+// underlying awserr.Error.
+func wrapAWSError(err error) error {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return err
+	}
+
+	if e, ok := awsErrors[awsErr.Code()]; ok {
+		return fmt.Errorf("%w: %w", e, err)
+	}
+	return err
+}
+
+// newHTTPTransport returns a transport for the AWS clients that is owned
+// by the messenger so its connections can be released on Close.
+func newHTTPTransport() *http.Transport {
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
+
+// newAWSSession creates a session from the config that sends requests
+// through the given transport.
+func newAWSSession(c awsCfg, transport *http.Transport) (*session.Session, error) {
+	maxRetries := awsDefaultMaxRetries
+	if c.MaxRetries != nil {
+		if *c.MaxRetries < 0 {
+			return nil, fmt.Errorf("invalid max_retries: %d", *c.MaxRetries)
+		}
+		maxRetries = *c.MaxRetries
+	}
+
+	config := &aws.Config{
+		MaxRetries: aws.Int(maxRetries),
+		HTTPClient: &http.Client{Transport: transport},
+	}
+	if c.AccessKey != "" && c.SecretKey != "" && !c.UseWebIdentity {
+		config.Credentials = credentials.NewStaticCredentials(c.AccessKey, c.SecretKey, "")
+	}
+	if c.Region != "" {
+		config.Region = &c.Region
+	}
+	if c.Endpoint != "" {
+		config.Endpoint = &c.Endpoint
+	}
+
+	opts := session.Options{Config: *config, Profile: c.Profile}
+	if c.UseSharedConfig || c.Profile != "" {
+		opts.SharedConfigState = session.SharedConfigEnable
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating aws session: %v", err)
+	}
+
+	if c.UseWebIdentity {
+		var (
+			roleARN   = os.Getenv("AWS_ROLE_ARN")
+			tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+		)
+		if roleARN == "" || tokenFile == "" {
+			return nil, fmt.Errorf("use_web_identity requires AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE to be set")
+		}
+
+		creds := stscreds.NewWebIdentityCredentials(sess, roleARN, os.Getenv("AWS_ROLE_SESSION_NAME"), tokenFile)
+		sess = sess.Copy(&aws.Config{Credentials: creds})
+	}
+
+	// Static keys (or the default chain) form the base session which is
+	// then used to assume the role.
+	if c.RoleARN != "" {
+		creds := stscreds.NewCredentials(sess, c.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if c.ExternalID != "" {
+				p.ExternalID = aws.String(c.ExternalID)
+			}
+		})
+		sess = sess.Copy(&aws.Config{Credentials: creds})
+	}
+
+	// Custom endpoints (eg: LocalStack) may not emulate STS, so the
+	// credentials check is skipped.
+	if c.Endpoint == "" {
+		if err := checkCredentials(context.Background(), sess); err != nil {
+			return nil, err
+		}
+	}
+
+	return sess, nil
+}
+
+func checkCredentials(ctx context.Context, sess *session.Session) error {
+	// Create a SES service client.
+	svc := sts.New(sess)
+	// Call the GetCallerIdentity API to check credentials
+	params := &sts.GetCallerIdentityInput{}
+	_, err := svc.GetCallerIdentityWithContext(ctx, params)
+	return err
+}
@@ -0,0 +1,248 @@
+package messenger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestNewAWSSession(t *testing.T) {
+	zero, negative := 0, -1
+
+	sess, err := newAWSSession(awsCfg{Region: "eu-west-1", AccessKey: "a", SecretKey: "s", Endpoint: "http://localhost:4566"}, newHTTPTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(sess.Config.Endpoint) != "http://localhost:4566" || aws.StringValue(sess.Config.Region) != "eu-west-1" {
+		t.Errorf("got config %+v", sess.Config)
+	}
+	if n := aws.IntValue(sess.Config.MaxRetries); n != awsDefaultMaxRetries {
+		t.Errorf("got MaxRetries %d", n)
+	}
+
+	sess, err = newAWSSession(awsCfg{Region: "eu-west-1", Endpoint: "http://localhost:4566", MaxRetries: &zero}, newHTTPTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := aws.IntValue(sess.Config.MaxRetries); n != 0 {
+		t.Errorf("got MaxRetries %d", n)
+	}
+
+	if _, err := newAWSSession(awsCfg{Endpoint: "http://localhost:4566", MaxRetries: &negative}, newHTTPTransport()); err == nil {
+		t.Error("expected an error for negative max_retries")
+	}
+
+	// Without an explicit region, the shared config chain is used.
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_REGION", "ap-south-1")
+
+	sess, err = newAWSSession(awsCfg{AccessKey: "a", SecretKey: "s", Endpoint: "http://localhost:4566", UseSharedConfig: true}, newHTTPTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := aws.StringValue(sess.Config.Region); r != "ap-south-1" {
+		t.Errorf("got region %q, want %q", r, "ap-south-1")
+	}
+}
+
+// newFakeSTS returns a server that answers the STS credential actions with
+// fixed temporary credentials and records the requests' forms.
+func newFakeSTS(t *testing.T) (*httptest.Server, *[]url.Values) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		forms []url.Values
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		forms = append(forms, r.PostForm)
+		mu.Unlock()
+
+		action := r.PostForm.Get("Action")
+		fmt.Fprintf(w, `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>ASIA%[1]s</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%[2]s</Expiration>
+    </Credentials>
+  </%[1]sResult>
+</%[1]sResponse>`, action, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &forms
+}
+
+func TestNewAWSSessionAssumeRole(t *testing.T) {
+	srv, forms := newFakeSTS(t)
+
+	sess, err := newAWSSession(awsCfg{
+		Region:     "eu-west-1",
+		AccessKey:  "a",
+		SecretKey:  "s",
+		Endpoint:   srv.URL,
+		RoleARN:    "arn:aws:iam::123456789012:role/listmonk",
+		ExternalID: "ext",
+	}, newHTTPTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := sess.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.AccessKeyID != "ASIAAssumeRole" || v.SessionToken != "token" {
+		t.Errorf("got credentials %+v", v)
+	}
+
+	if len(*forms) != 1 {
+		t.Fatalf("got %d STS requests, want 1", len(*forms))
+	}
+	f := (*forms)[0]
+	if f.Get("Action") != "AssumeRole" || f.Get("RoleArn") != "arn:aws:iam::123456789012:role/listmonk" || f.Get("ExternalId") != "ext" {
+		t.Errorf("got STS request %v", f)
+	}
+}
+
+func TestNewAWSSessionWebIdentity(t *testing.T) {
+	srv, forms := newFakeSTS(t)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("header.payload.signature"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := awsCfg{Region: "eu-west-1", Endpoint: srv.URL, UseWebIdentity: true}
+	if _, err := newAWSSession(cfg, newHTTPTransport()); err == nil {
+		t.Error("expected an error without AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/irsa")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	sess, err := newAWSSession(cfg, newHTTPTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := sess.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.AccessKeyID != "ASIAAssumeRoleWithWebIdentity" {
+		t.Errorf("got credentials %+v", v)
+	}
+
+	if len(*forms) != 1 {
+		t.Fatalf("got %d STS requests, want 1", len(*forms))
+	}
+	f := (*forms)[0]
+	if f.Get("RoleArn") != "arn:aws:iam::123456789012:role/irsa" || f.Get("WebIdentityToken") != "header.payload.signature" {
+		t.Errorf("got STS request %v", f)
+	}
+}
+
+func TestNewAWSSessionProfile(t *testing.T) {
+	dir := t.TempDir()
+	credsFile := filepath.Join(dir, "credentials")
+	if err := os.WriteFile(credsFile, []byte(`[default]
+aws_access_key_id = default-key
+aws_secret_access_key = default-secret
+
+[dev]
+aws_access_key_id = dev-key
+aws_secret_access_key = dev-secret
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsFile)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	cases := []struct {
+		name string
+		cfg  awsCfg
+		want string
+	}{
+		{"profile", awsCfg{Profile: "dev"}, "dev-key"},
+		{"static keys take precedence", awsCfg{Profile: "dev", AccessKey: "static-key", SecretKey: "static-secret"}, "static-key"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.cfg.Region = "eu-west-1"
+			c.cfg.Endpoint = "http://localhost:4566"
+
+			sess, err := newAWSSession(c.cfg, newHTTPTransport())
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := sess.Config.Credentials.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.AccessKeyID != c.want {
+				t.Errorf("got access key %q, want %q", v.AccessKeyID, c.want)
+			}
+		})
+	}
+}
+
+func TestWrapAWSError(t *testing.T) {
+	cases := []struct {
+		code string
+		want error
+	}{
+		{"Throttling", ErrThrottled},
+		{"ThrottlingException", ErrThrottled},
+		{"TooManyRequestsException", ErrThrottled},
+		{"InvalidClientTokenId", ErrAuth},
+		{"SignatureDoesNotMatch", ErrAuth},
+		{"ExpiredToken", ErrAuth},
+		{"AccessDeniedException", ErrAuth},
+		{"MessageRejected", ErrInvalidRecipient},
+		{"InvalidParameterValue", ErrInvalidRecipient},
+	}
+	for _, c := range cases {
+		orig := awserr.New(c.code, "failed", nil)
+		err := wrapAWSError(orig)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.code, err, c.want)
+		}
+
+		// The AWS error is still accessible.
+		var awsErr awserr.Error
+		if !errors.As(err, &awsErr) || awsErr.Code() != c.code {
+			t.Errorf("%s: lost the underlying error: %v", c.code, err)
+		}
+	}
+
+	// Unknown codes and other errors are returned as is.
+	for _, err := range []error{awserr.New("InternalFailure", "failed", nil), errors.New("failed"), nil} {
+		if got := wrapAWSError(err); got != err {
+			t.Errorf("got %v, want %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreakerMessenger.Push while the
+// circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreakerMessenger wraps a Messenger and stops pushing to it after
+// Threshold consecutive failures. While open, pushes fail with
+// ErrCircuitOpen until Cooldown has passed, after which a single probe is
+// let through: its success closes the circuit and its failure reopens it.
+type CircuitBreakerMessenger struct {
+	Messenger
+
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// NewCircuitBreakerMessenger wraps m with a circuit breaker that opens
+// after threshold consecutive failures for cooldown.
+func NewCircuitBreakerMessenger(m Messenger, threshold int, cooldown time.Duration) *CircuitBreakerMessenger {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &CircuitBreakerMessenger{
+		Messenger: m,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Push pushes the message through the underlying messenger unless the
+// circuit is open.
+func (c *CircuitBreakerMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	if err := c.allow(); err != nil {
+		return "", err
+	}
+
+	id, err := c.Messenger.Push(ctx, msg)
+	c.record(err)
+	return id, err
+}
+
+// allow reports whether a push may go through, moving an open circuit
+// whose cooldown has passed to half-open for a single probe.
+func (c *CircuitBreakerMessenger) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case circuitOpen:
+		if c.now().Sub(c.openedAt) < c.cooldown {
+			return ErrCircuitOpen
+		}
+		c.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// A probe is already in flight.
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record updates the circuit with the outcome of a push.
+func (c *CircuitBreakerMessenger) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !isProviderFailure(err) {
+		c.state = circuitClosed
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= c.threshold {
+		c.state = circuitOpen
+		c.openedAt = c.now()
+	}
+}
+
+// isProviderFailure reports whether err indicates a problem with the
+// provider rather than with the message or the caller.
+func isProviderFailure(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrInvalidRecipient),
+		errors.Is(err, ErrMessageTooLarge),
+		errors.Is(err, ErrSuppressed),
+		errors.Is(err, ErrOptedOut),
+		errors.Is(err, ErrUnregistered):
+		return false
+	}
+	return true
+}
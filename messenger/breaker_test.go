@@ -0,0 +1,116 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerMessenger(t *testing.T) {
+	var (
+		now     = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		sendErr = errors.New("provider unavailable")
+		fail    = true
+	)
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		if fail {
+			return "", sendErr
+		}
+		return "id", nil
+	}}
+	c := NewCircuitBreakerMessenger(f, 3, time.Minute)
+	c.now = func() time.Time { return now }
+
+	// The circuit opens after 3 consecutive failures.
+	for i := 0; i < 3; i++ {
+		if _, err := c.Push(context.Background(), Message{}); !errors.Is(err, sendErr) {
+			t.Fatalf("push %d: got %v", i, err)
+		}
+	}
+	if _, err := c.Push(context.Background(), Message{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	if n := f.pushes(); n != 3 {
+		t.Errorf("got %d pushes while open", n)
+	}
+
+	// After the cooldown, a failed probe reopens the circuit.
+	now = now.Add(time.Minute)
+	if _, err := c.Push(context.Background(), Message{}); !errors.Is(err, sendErr) {
+		t.Fatalf("got %v from the probe", err)
+	}
+	if _, err := c.Push(context.Background(), Message{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	fail = false
+	for i := 0; i < 3; i++ {
+		if _, err := c.Push(context.Background(), Message{}); err != nil {
+			t.Fatalf("push %d: got %v", i, err)
+		}
+	}
+	if c.state != circuitClosed || c.failures != 0 {
+		t.Errorf("got state %d with %d failures", c.state, c.failures)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		if msg.Subject == "probe" {
+			close(probing)
+			<-release
+			return "id", nil
+		}
+		return "", errors.New("fail")
+	}}
+	c := NewCircuitBreakerMessenger(f, 1, time.Second)
+	c.now = func() time.Time { return now }
+
+	_, _ = c.Push(context.Background(), Message{})
+	c.mu.Lock()
+	now = now.Add(time.Second)
+	c.mu.Unlock()
+
+	// Only a single probe is let through while half-open.
+	done := make(chan error)
+	go func() {
+		_, err := c.Push(context.Background(), Message{Subject: "probe"})
+		done <- err
+	}()
+	<-probing
+	if _, err := c.Push(context.Background(), Message{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v during the probe, want ErrCircuitOpen", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerIgnoresMessageErrors(t *testing.T) {
+	for _, err := range []error{
+		fmt.Errorf("%w: bad address", ErrInvalidRecipient),
+		ErrMessageTooLarge,
+		ErrSuppressed,
+		ErrOptedOut,
+		ErrUnregistered,
+		context.Canceled,
+	} {
+		f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+			return "", err
+		}}
+		c := NewCircuitBreakerMessenger(f, 1, time.Hour)
+		for i := 0; i < 3; i++ {
+			if _, got := c.Push(context.Background(), Message{}); !errors.Is(got, err) {
+				t.Errorf("%v: push %d got %v", err, i, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+const brevoAPIURL = "https://api.brevo.com"
+
+type brevoCfg struct {
+	APIKey string `json:"api_key"`
+
+	// TemplateID, if set, sends messages with a Brevo template instead of
+	// the message body. The subscriber's attributes are passed as the
+	// template's params.
+	TemplateID int `json:"template_id"`
+
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type brevoMessenger struct {
+	cfg    brevoCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type brevoAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type brevoAttachment struct {
+	Content string `json:"content"`
+	Name    string `json:"name"`
+}
+
+type brevoEmail struct {
+	Sender      brevoAddress           `json:"sender"`
+	To          []brevoAddress         `json:"to"`
+	Cc          []brevoAddress         `json:"cc,omitempty"`
+	Bcc         []brevoAddress         `json:"bcc,omitempty"`
+	ReplyTo     *brevoAddress          `json:"replyTo,omitempty"`
+	Subject     string                 `json:"subject,omitempty"`
+	HTMLContent string                 `json:"htmlContent,omitempty"`
+	TextContent string                 `json:"textContent,omitempty"`
+	TemplateID  int                    `json:"templateId,omitempty"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	Attachments []brevoAttachment      `json:"attachment,omitempty"`
+}
+
+type brevoResp struct {
+	MessageID string `json:"messageId"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+func (b brevoMessenger) Name() string {
+	return "brevo"
+}
+
+// Push sends the email through the Brevo transactional email API.
+func (b brevoMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	b.logger.DebugWith("sending message").String("email", b.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	files, err := fetchAttachments(ctx, b.cfg.httpClientCfg, msg.Attachments)
+	if err != nil {
+		return "", err
+	}
+	msg.Attachments = files
+
+	name, addr := splitAddress(messageFrom(msg))
+	e := brevoEmail{
+		Sender:  brevoAddress{Email: addr, Name: name},
+		To:      brevoAddresses([]string{msg.Subscriber.Email}),
+		Cc:      brevoAddresses(msg.Cc),
+		Bcc:     brevoAddresses(msg.Bcc),
+		Subject: msg.Subject,
+	}
+	if len(msg.ReplyTo) > 0 {
+		name, addr := splitAddress(msg.ReplyTo[0])
+		e.ReplyTo = &brevoAddress{Email: addr, Name: name}
+	}
+
+	if b.cfg.TemplateID != 0 {
+		e.TemplateID = b.cfg.TemplateID
+		e.Params = msg.Subscriber.Attribs
+	} else if msg.ContentType == ContentTypePlain {
+		e.TextContent = string(msg.Body)
+	} else {
+		e.HTMLContent = string(msg.Body)
+		e.TextContent = string(msg.AltBody)
+	}
+
+	if len(msg.Headers) > 0 {
+		e.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			e.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	for _, a := range msg.Attachments {
+		e.Attachments = append(e.Attachments, brevoAttachment{
+			Content: base64.StdEncoding.EncodeToString(a.Content),
+			Name:    a.Name,
+		})
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg.APIURL+"/v3/smtp/email", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api-key", b.cfg.APIKey)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "brevo"); err != nil {
+		return "", err
+	}
+
+	var out brevoResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding brevo response (status %d): %v", resp.StatusCode, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("%w: brevo error %s: %s", ErrAuth, out.Code, out.Message)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return "", fmt.Errorf("brevo error %s (status %d): %s", out.Code, resp.StatusCode, out.Message)
+	}
+
+	b.logger.InfoWith("successfully sent email").String("email", b.logger.email(msg.Subscriber.Email)).String("message_id", out.MessageID).Write()
+
+	return out.MessageID, nil
+}
+
+func (b brevoMessenger) Flush() error {
+	return nil
+}
+
+func (b brevoMessenger) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// brevoAddresses converts a list of RFC 5322 addresses to Brevo's address
+// objects.
+func brevoAddresses(addrs []string) []brevoAddress {
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	out := make([]brevoAddress, 0, len(addrs))
+	for _, a := range addrs {
+		name, addr := splitAddress(a)
+		out = append(out, brevoAddress{Email: addr, Name: name})
+	}
+	return out
+}
+
+// NewBrevo creates new instance of brevo
+func NewBrevo(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c brevoCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("invalid api_key")
+	}
+	if c.APIURL == "" {
+		c.APIURL = brevoAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return brevoMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
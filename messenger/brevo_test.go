@@ -0,0 +1,85 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestBrevoPush(t *testing.T) {
+	var (
+		path, key string
+		email     brevoEmail
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, key = r.URL.Path, r.Header.Get("api-key")
+		if err := json.NewDecoder(r.Body).Decode(&email); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"messageId": "<202401010000.1@smtp-relay.mailin.fr>"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewBrevo([]byte(fmt.Sprintf(`{"api_key": "key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.Attachments = []Attachment{{Name: "a.pdf", Content: []byte("%PDF")}}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "<202401010000.1@smtp-relay.mailin.fr>" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/v3/smtp/email" || key != "key" {
+		t.Errorf("got request to %s with api-key %q", path, key)
+	}
+	if email.Sender != (brevoAddress{Email: "sender@example.com", Name: "Sender"}) || len(email.To) != 1 || email.To[0].Email != "to@example.com" {
+		t.Errorf("got sender %+v to %+v", email.Sender, email.To)
+	}
+	if email.Subject != "Hello" || email.HTMLContent != "<p>Hello</p>" {
+		t.Errorf("got email %+v", email)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0] != (brevoAttachment{Content: "JVBERg==", Name: "a.pdf"}) {
+		t.Errorf("got attachments %+v", email.Attachments)
+	}
+}
+
+func TestBrevoPushErrors(t *testing.T) {
+	status := http.StatusUnauthorized
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusUnauthorized {
+			_, _ = w.Write([]byte(`{"code": "unauthorized", "message": "Key not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code": "invalid_parameter", "message": "email is not valid in to"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewBrevo([]byte(fmt.Sprintf(`{"api_key": "bad", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); !errors.Is(err, ErrAuth) || !strings.Contains(err.Error(), "Key not found") {
+		t.Errorf("got %v, want ErrAuth", err)
+	}
+
+	status = http.StatusBadRequest
+	_, err = m.Push(context.Background(), testMessage())
+	if err == nil || errors.Is(err, ErrAuth) || !strings.Contains(err.Error(), "invalid_parameter") {
+		t.Errorf("got %v, want the brevo error", err)
+	}
+}
@@ -0,0 +1,173 @@
+package messenger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+// ErrInFlight is returned by DedupeMessenger's Push when a message with the
+// same idempotency key is being sent by another push.
+var ErrInFlight = errors.New("duplicate message in flight")
+
+// DedupeStore records the message IDs of sent messages by their
+// idempotency key.
+type DedupeStore interface {
+	// Reserve claims key for a send, returning ok if the caller may send
+	// it. Otherwise, it returns the message ID recorded for key, or
+	// ErrInFlight if key is reserved by a send that hasn't completed.
+	Reserve(key string) (id string, ok bool, err error)
+
+	// Store records the message ID sent for a reserved key.
+	Store(key, id string) error
+
+	// Release drops the reservation of key after a failed send so that
+	// the message can be retried.
+	Release(key string) error
+}
+
+// DedupeMessenger wraps a Messenger and skips pushes of messages that
+// have already been sent, eg: when listmonk retries a postback, returning
+// the message ID of the earlier send.
+type DedupeMessenger struct {
+	Messenger
+	store  DedupeStore
+	logger *onelog.Logger
+}
+
+// NewDedupeMessenger wraps m, deduplicating pushes with store.
+func NewDedupeMessenger(m Messenger, store DedupeStore, l *onelog.Logger) *DedupeMessenger {
+	return &DedupeMessenger{Messenger: m, store: store, logger: l}
+}
+
+// Push pushes the message through the underlying messenger unless its
+// idempotency key has already been sent or is being sent.
+func (d *DedupeMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	key := idempotencyKey(msg)
+
+	id, ok, err := d.store.Reserve(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return id, nil
+	}
+
+	id, err = d.Messenger.Push(ctx, msg)
+	if err != nil {
+		if rErr := d.store.Release(key); rErr != nil {
+			d.logger.ErrorWith("error releasing idempotency key").String("key", key).Err("err", rErr).Write()
+		}
+		return id, err
+	}
+
+	// The message has been sent at this point, so a failure to record it
+	// only risks a duplicate on retry and isn't reported as a send error.
+	if err := d.store.Store(key, id); err != nil {
+		d.logger.ErrorWith("error recording sent message").String("key", key).String("message_id", id).Err("err", err).Write()
+	}
+	return id, nil
+}
+
+// idempotencyKey returns the message's idempotency key, deriving one from
+// the recipient, subject and body if it isn't set.
+func idempotencyKey(msg Message) string {
+	if msg.IdempotencyKey != "" {
+		return msg.IdempotencyKey
+	}
+
+	h := sha256.New()
+	h.Write([]byte(msg.Subscriber.Email))
+	h.Write([]byte{0})
+	h.Write([]byte(msg.Subject))
+	h.Write([]byte{0})
+	h.Write(msg.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupeEntry is a sent message's ID, or a reservation for a send in
+// progress if pending.
+type dedupeEntry struct {
+	id      string
+	pending bool
+	expires time.Time
+}
+
+// MemoryDedupeStore is an in-memory DedupeStore whose keys, and the
+// reservations of sends that never complete, expire after a TTL.
+type MemoryDedupeStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]dedupeEntry
+
+	// lastSweep is when expired keys were last evicted.
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryDedupeStore creates an in-memory store that forgets keys after ttl.
+func NewMemoryDedupeStore(ttl time.Duration) *MemoryDedupeStore {
+	return &MemoryDedupeStore{
+		ttl:       ttl,
+		entries:   make(map[string]dedupeEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Reserve claims key unless it has an unexpired message ID or reservation.
+func (s *MemoryDedupeStore) Reserve(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.pending {
+			return "", false, ErrInFlight
+		}
+		return e.id, false, nil
+	}
+
+	s.sweep(now)
+	s.entries[key] = dedupeEntry{pending: true, expires: now.Add(s.ttl)}
+	return "", true, nil
+}
+
+// Store records the message ID for key.
+func (s *MemoryDedupeStore) Store(key, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.entries[key] = dedupeEntry{id: id, expires: now.Add(s.ttl)}
+	return nil
+}
+
+// Release drops the reservation of key.
+func (s *MemoryDedupeStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.pending {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// sweep evicts expired keys, at most once every TTL.
+func (s *MemoryDedupeStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) >= s.ttl {
+		for k, e := range s.entries {
+			if !now.Before(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+}
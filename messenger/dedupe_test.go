@@ -0,0 +1,181 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+// failingDedupeStore is a MemoryDedupeStore that fails to record sends.
+type failingDedupeStore struct {
+	*MemoryDedupeStore
+}
+
+func (failingDedupeStore) Store(key, id string) error {
+	return errors.New("store unavailable")
+}
+
+func TestDedupeMessenger(t *testing.T) {
+	f := &fakeMessenger{}
+	d := NewDedupeMessenger(f, NewMemoryDedupeStore(time.Hour), onelog.New(io.Discard, 0))
+
+	msg := Message{Subject: "Hello", Body: []byte("Hi")}
+	msg.Subscriber.Email = "a@example.com"
+
+	id1, err := d.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := d.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 != id2 || f.pushes() != 1 {
+		t.Errorf("got ids %q, %q after %d pushes", id1, id2, f.pushes())
+	}
+
+	// A different body or an explicit key is a different message.
+	msg.Body = []byte("Bye")
+	if _, err := d.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.IdempotencyKey = "k"
+	if _, err := d.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if f.pushes() != 3 {
+		t.Errorf("got %d pushes, want 3", f.pushes())
+	}
+}
+
+func TestDedupeMessengerFailedSend(t *testing.T) {
+	fail := true
+	f := &fakeMessenger{push: func(context.Context, Message) (string, error) {
+		if fail {
+			return "", errors.New("send failed")
+		}
+		return "id", nil
+	}}
+	d := NewDedupeMessenger(f, NewMemoryDedupeStore(time.Hour), onelog.New(io.Discard, 0))
+
+	msg := Message{IdempotencyKey: "k"}
+	if _, err := d.Push(context.Background(), msg); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// The failed send released the key, so the retry is sent.
+	fail = false
+	if id, err := d.Push(context.Background(), msg); err != nil || id != "id" {
+		t.Fatalf("got %q, %v", id, err)
+	}
+	if f.pushes() != 2 {
+		t.Errorf("got %d pushes, want 2", f.pushes())
+	}
+}
+
+// TestDedupeMessengerConcurrent checks that concurrent pushes of the same
+// message send it once.
+func TestDedupeMessengerConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	f := &fakeMessenger{push: func(context.Context, Message) (string, error) {
+		<-release
+		return "id", nil
+	}}
+	d := NewDedupeMessenger(f, NewMemoryDedupeStore(time.Hour), onelog.New(io.Discard, 0))
+
+	msg := Message{IdempotencyKey: "k"}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		inFlight int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := d.Push(context.Background(), msg)
+			if errors.Is(err, ErrInFlight) {
+				mu.Lock()
+				inFlight++
+				mu.Unlock()
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Wait for the pushes other than the one sending to be turned away.
+	for deadline := time.Now().Add(time.Second); ; {
+		mu.Lock()
+		n := inFlight
+		mu.Unlock()
+		if n == 9 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if f.pushes() != 1 || inFlight != 9 {
+		t.Errorf("got %d pushes and %d in flight errors", f.pushes(), inFlight)
+	}
+	if id, err := d.Push(context.Background(), msg); err != nil || id != "id" {
+		t.Errorf("got %q, %v after the send", id, err)
+	}
+}
+
+func TestDedupeMessengerLogsStoreErrors(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDedupeMessenger(&fakeMessenger{}, failingDedupeStore{NewMemoryDedupeStore(time.Hour)}, onelog.New(&buf, onelog.ERROR))
+
+	id, err := d.Push(context.Background(), Message{IdempotencyKey: "k"})
+	if err != nil || id == "" {
+		t.Fatalf("got %q, %v: a failure to record a sent message isn't a send error", id, err)
+	}
+	if out := buf.String(); !strings.Contains(out, "error recording sent message") || !strings.Contains(out, "store unavailable") {
+		t.Errorf("store error not logged: %s", out)
+	}
+}
+
+func TestMemoryDedupeStoreExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryDedupeStore(time.Minute)
+	s.now = func() time.Time { return now }
+
+	if _, ok, _ := s.Reserve("k"); !ok {
+		t.Fatal("fresh key not reserved")
+	}
+	if _, _, err := s.Reserve("k"); !errors.Is(err, ErrInFlight) {
+		t.Fatalf("got %v, want ErrInFlight", err)
+	}
+
+	// A reservation that's never completed expires.
+	now = now.Add(time.Minute)
+	if _, ok, _ := s.Reserve("k"); !ok {
+		t.Fatal("expired reservation not reclaimed")
+	}
+	_ = s.Store("k", "id")
+	if id, ok, _ := s.Reserve("k"); ok || id != "id" {
+		t.Fatalf("got %q, %v", id, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := s.Reserve("k"); !ok {
+		t.Fatal("expired key not reserved")
+	}
+
+	// Release only drops reservations.
+	_ = s.Store("sent", "id")
+	_ = s.Release("sent")
+	if id, ok, _ := s.Reserve("sent"); ok || id != "id" {
+		t.Errorf("released a sent key")
+	}
+}
@@ -0,0 +1,335 @@
+package messenger
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+	DeliveryStatusPending   = "pending"
+
+	snsTypeNotification             = "Notification"
+	snsTypeSubscriptionConfirmation = "SubscriptionConfirmation"
+
+	// snsDeliveryTimeLayout is the timestamp layout of SNS SMS delivery
+	// status logs.
+	snsDeliveryTimeLayout = "2006-01-02 15:04:05.000"
+)
+
+// ErrSubscriptionConfirmed is returned by HandleDeliveryReceipt when the
+// request confirmed the subscription that delivers the receipts instead of
+// carrying one.
+var ErrSubscriptionConfirmed = errors.New("subscription confirmed")
+
+// DeliveryReporter is optionally implemented by messengers whose delivery
+// isn't confirmed when a message is sent, eg: SMS, and that receive
+// delivery receipts from their provider later.
+type DeliveryReporter interface {
+	HandleDeliveryReceipt(ctx context.Context, raw []byte) (DeliveryStatus, error)
+}
+
+// DeliveryStatus is the delivery status of a previously sent message.
+type DeliveryStatus struct {
+	MessageID string `json:"message_id"`
+
+	// Status is one of the DeliveryStatus* values and ProviderStatus is the
+	// status as reported by the provider.
+	Status         string `json:"status"`
+	ProviderStatus string `json:"provider_status"`
+	Description    string `json:"description,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// snsEnvelope is the SNS HTTP(S) notification that wraps a message
+// published to a topic, or the confirmation of a subscription to it.
+type snsEnvelope struct {
+	Type         string `json:"Type"`
+	MessageID    string `json:"MessageId"`
+	Token        string `json:"Token"`
+	TopicArn     string `json:"TopicArn"`
+	Subject      string `json:"Subject"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+	Timestamp    string `json:"Timestamp"`
+
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+// stringToSign returns the fields of the envelope covered by its
+// signature, in the order and format SNS signs them.
+func (e snsEnvelope) stringToSign() string {
+	var keys [][2]string
+	if e.Type == snsTypeNotification {
+		keys = [][2]string{{"Message", e.Message}, {"MessageId", e.MessageID}}
+		if e.Subject != "" {
+			keys = append(keys, [2]string{"Subject", e.Subject})
+		}
+		keys = append(keys, [][2]string{{"Timestamp", e.Timestamp}, {"TopicArn", e.TopicArn}, {"Type", e.Type}}...)
+	} else {
+		keys = [][2]string{
+			{"Message", e.Message}, {"MessageId", e.MessageID}, {"SubscribeURL", e.SubscribeURL},
+			{"Timestamp", e.Timestamp}, {"Token", e.Token}, {"TopicArn", e.TopicArn}, {"Type", e.Type},
+		}
+	}
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k[0] + "\n" + k[1] + "\n")
+	}
+	return b.String()
+}
+
+// snsCertMaxBytes caps the size of a fetched SNS signing certificate.
+const snsCertMaxBytes = 64 << 10
+
+// snsReceiver verifies the signatures of the SNS HTTP(S) notifications that
+// deliver receipts and confirms the subscriptions that deliver them.
+type snsReceiver struct {
+	// host is the SNS endpoint of the messenger's region, eg:
+	// "sns.us-east-1.amazonaws.com". Signing certificates and subscription
+	// confirmations are only fetched from it.
+	host   string
+	client *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+func newSNSReceiver(region string, transport *http.Transport) *snsReceiver {
+	return &snsReceiver{
+		host:   "sns." + region + ".amazonaws.com",
+		client: &http.Client{Transport: transport, Timeout: httpDefaultTimeout},
+		certs:  make(map[string]*x509.Certificate),
+	}
+}
+
+// receive verifies the signed SNS request in raw and returns its
+// envelope. Subscription confirmations are confirmed and reported with
+// ErrSubscriptionConfirmed.
+func (r *snsReceiver) receive(ctx context.Context, raw []byte) (snsEnvelope, error) {
+	var env snsEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return env, fmt.Errorf("error parsing sns notification: %v", err)
+	}
+	if env.Type != snsTypeNotification && env.Type != snsTypeSubscriptionConfirmation {
+		return env, fmt.Errorf("unsupported sns message type: %q", env.Type)
+	}
+	if err := r.verify(ctx, env); err != nil {
+		return env, fmt.Errorf("error verifying sns %s: %w", strings.ToLower(env.Type), err)
+	}
+
+	if env.Type == snsTypeSubscriptionConfirmation {
+		if err := r.confirm(ctx, env.SubscribeURL); err != nil {
+			return env, fmt.Errorf("error confirming sns subscription to %s: %w", env.TopicArn, err)
+		}
+		return env, ErrSubscriptionConfirmed
+	}
+	return env, nil
+}
+
+// verify checks the envelope's signature against the signing certificate
+// it points to.
+func (r *snsReceiver) verify(ctx context.Context, env snsEnvelope) error {
+	var (
+		h   hash.Hash
+		alg crypto.Hash
+	)
+	switch env.SignatureVersion {
+	case "1":
+		h, alg = sha1.New(), crypto.SHA1
+	case "2":
+		h, alg = sha256.New(), crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported signature version %q", env.SignatureVersion)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	cert, err := r.cert(ctx, env.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate doesn't have an RSA key")
+	}
+
+	h.Write([]byte(env.stringToSign()))
+	if err := rsa.VerifyPKCS1v15(pub, alg, h.Sum(nil), sig); err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	return nil
+}
+
+// cert returns the signing certificate at u, fetching it on first use.
+func (r *snsReceiver) cert(ctx context.Context, u string) (*x509.Certificate, error) {
+	if err := r.checkURL(u); err != nil {
+		return nil, fmt.Errorf("invalid SigningCertURL: %v", err)
+	}
+
+	r.mu.Lock()
+	cert, ok := r.certs[u]
+	r.mu.Unlock()
+	if !ok {
+		b, err := r.get(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching signing certificate: %v", err)
+		}
+		blk, _ := pem.Decode(b)
+		if blk == nil {
+			return nil, errors.New("invalid signing certificate: no PEM block found")
+		}
+		if cert, err = x509.ParseCertificate(blk.Bytes); err != nil {
+			return nil, fmt.Errorf("invalid signing certificate: %v", err)
+		}
+
+		r.mu.Lock()
+		r.certs[u] = cert
+		r.mu.Unlock()
+	}
+
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, errors.New("signing certificate has expired or isn't valid yet")
+	}
+	return cert, nil
+}
+
+// confirm confirms a subscription by visiting its SubscribeURL.
+func (r *snsReceiver) confirm(ctx context.Context, u string) error {
+	if err := r.checkURL(u); err != nil {
+		return fmt.Errorf("invalid SubscribeURL: %v", err)
+	}
+	_, err := r.get(ctx, u)
+	return err
+}
+
+// checkURL checks that u is an https URL on the region's SNS endpoint.
+func (r *snsReceiver) checkURL(u string) error {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if pu.Scheme != "https" || pu.Host != r.host {
+		return fmt.Errorf("%s isn't on https://%s", u, r.host)
+	}
+	return nil
+}
+
+func (r *snsReceiver) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, snsCertMaxBytes))
+}
+
+// pinpointSMSEvent is a Pinpoint SMS event, eg: TEXT_DELIVERED, as
+// published to an event destination.
+type pinpointSMSEvent struct {
+	EventType                string `json:"eventType"`
+	EventTimestamp           int64  `json:"eventTimestamp"`
+	MessageID                string `json:"messageId"`
+	MessageStatus            string `json:"messageStatus"`
+	MessageStatusDescription string `json:"messageStatusDescription"`
+}
+
+// snsSMSDelivery is an SNS SMS delivery status log.
+type snsSMSDelivery struct {
+	Notification struct {
+		MessageID string `json:"messageId"`
+		Timestamp string `json:"timestamp"`
+	} `json:"notification"`
+	Delivery struct {
+		ProviderResponse string `json:"providerResponse"`
+	} `json:"delivery"`
+	Status string `json:"status"`
+}
+
+// parseDeliveryReceipt parses an SNS notification carrying either a
+// Pinpoint SMS event or an SNS SMS delivery status log.
+func parseDeliveryReceipt(env snsEnvelope) (DeliveryStatus, error) {
+	var ev pinpointSMSEvent
+	if err := json.Unmarshal([]byte(env.Message), &ev); err != nil {
+		return DeliveryStatus{}, fmt.Errorf("error parsing delivery receipt: %v", err)
+	}
+	if ev.MessageStatus != "" {
+		return DeliveryStatus{
+			MessageID:      ev.MessageID,
+			Status:         pinpointDeliveryStatus(ev.MessageStatus),
+			ProviderStatus: ev.MessageStatus,
+			Description:    ev.MessageStatusDescription,
+			Timestamp:      time.UnixMilli(ev.EventTimestamp).UTC(),
+		}, nil
+	}
+
+	var d snsSMSDelivery
+	if err := json.Unmarshal([]byte(env.Message), &d); err != nil {
+		return DeliveryStatus{}, fmt.Errorf("error parsing delivery receipt: %v", err)
+	}
+	if d.Status == "" || d.Notification.MessageID == "" {
+		return DeliveryStatus{}, fmt.Errorf("sns notification %s is not a delivery receipt", env.MessageID)
+	}
+
+	ts, err := time.Parse(snsDeliveryTimeLayout, d.Notification.Timestamp)
+	if err != nil {
+		ts, _ = time.Parse(time.RFC3339, env.Timestamp)
+	}
+
+	status := DeliveryStatusFailed
+	if strings.EqualFold(d.Status, "SUCCESS") {
+		status = DeliveryStatusDelivered
+	}
+
+	return DeliveryStatus{
+		MessageID:      d.Notification.MessageID,
+		Status:         status,
+		ProviderStatus: d.Status,
+		Description:    d.Delivery.ProviderResponse,
+		Timestamp:      ts,
+	}, nil
+}
+
+// pinpointDeliveryStatus maps a Pinpoint SMS message status to a
+// DeliveryStatus* value.
+func pinpointDeliveryStatus(s string) string {
+	switch s {
+	case "DELIVERED":
+		return DeliveryStatusDelivered
+	case "SUCCESSFUL", "PENDING":
+		return DeliveryStatusPending
+	default:
+		return DeliveryStatusFailed
+	}
+}
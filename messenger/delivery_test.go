@@ -0,0 +1,255 @@
+package messenger
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSNSHost = "sns.us-east-1.amazonaws.com"
+
+// fakeSNS serves a signing certificate and subscription confirmations as
+// the SNS endpoint of a region.
+type fakeSNS struct {
+	key       *rsa.PrivateKey
+	receiver  *snsReceiver
+	certHits  atomic.Int32
+	confirmed atomic.Int32
+}
+
+func newFakeSNS(t *testing.T) *fakeSNS {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: testSNSHost},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	f := &fakeSNS{key: key}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/SimpleNotificationService.pem":
+			f.certHits.Add(1)
+			_, _ = w.Write(certPEM)
+		case r.URL.Query().Get("Action") == "ConfirmSubscription":
+			f.confirmed.Add(1)
+			_, _ = w.Write([]byte("<ConfirmSubscriptionResponse/>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// Every request is sent to the test server, whatever its host.
+	addr := srv.Listener.Addr().String()
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	f.receiver = newSNSReceiver("us-east-1", transport)
+	return f
+}
+
+// sign signs the envelope with the fake's key and returns it as JSON.
+func (f *fakeSNS) sign(t *testing.T, env snsEnvelope) []byte {
+	t.Helper()
+
+	if env.SigningCertURL == "" {
+		env.SigningCertURL = "https://" + testSNSHost + "/SimpleNotificationService.pem"
+	}
+	if env.SignatureVersion == "" {
+		env.SignatureVersion = "1"
+	}
+
+	var (
+		sum []byte
+		alg = crypto.SHA1
+	)
+	if env.SignatureVersion == "2" {
+		h := sha256.Sum256([]byte(env.stringToSign()))
+		sum, alg = h[:], crypto.SHA256
+	} else {
+		h := sha1.Sum([]byte(env.stringToSign()))
+		sum = h[:]
+	}
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, alg, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Signature = base64.StdEncoding.EncodeToString(sig)
+
+	b, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func pinpointReceipt(status string) snsEnvelope {
+	return snsEnvelope{
+		Type:      snsTypeNotification,
+		MessageID: "n-1",
+		TopicArn:  "arn:aws:sns:us-east-1:123456789012:sms",
+		Message:   `{"eventType":"TEXT_DELIVERED","eventTimestamp":1700000000000,"messageId":"m-1","messageStatus":"` + status + `","messageStatusDescription":"ok"}`,
+		Timestamp: "2023-11-14T22:13:20.000Z",
+	}
+}
+
+func TestSNSStringToSign(t *testing.T) {
+	env := snsEnvelope{Type: snsTypeNotification, MessageID: "id", Message: "msg", Timestamp: "ts", TopicArn: "arn"}
+	if got, want := env.stringToSign(), "Message\nmsg\nMessageId\nid\nTimestamp\nts\nTopicArn\narn\nType\nNotification\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	env.Subject = "subj"
+	if got := env.stringToSign(); !strings.Contains(got, "MessageId\nid\nSubject\nsubj\nTimestamp\n") {
+		t.Errorf("subject not signed: %q", got)
+	}
+
+	env = snsEnvelope{Type: snsTypeSubscriptionConfirmation, MessageID: "id", Message: "msg", SubscribeURL: "url", Timestamp: "ts", Token: "tok", TopicArn: "arn"}
+	want := "Message\nmsg\nMessageId\nid\nSubscribeURL\nurl\nTimestamp\nts\nToken\ntok\nTopicArn\narn\nType\nSubscriptionConfirmation\n"
+	if got := env.stringToSign(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSNSReceiverNotification(t *testing.T) {
+	f := newFakeSNS(t)
+
+	for _, version := range []string{"1", "2"} {
+		env := pinpointReceipt("DELIVERED")
+		env.SignatureVersion = version
+
+		got, err := f.receiver.receive(context.Background(), f.sign(t, env))
+		if err != nil {
+			t.Fatalf("signature version %s: %v", version, err)
+		}
+		st, err := parseDeliveryReceipt(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.MessageID != "m-1" || st.Status != DeliveryStatusDelivered || !st.Timestamp.Equal(time.UnixMilli(1700000000000)) {
+			t.Errorf("unexpected status: %+v", st)
+		}
+	}
+
+	// The certificate is fetched once.
+	if n := f.certHits.Load(); n != 1 {
+		t.Errorf("certificate fetched %d times", n)
+	}
+}
+
+func TestSNSReceiverRejects(t *testing.T) {
+	f := newFakeSNS(t)
+
+	tampered := f.sign(t, pinpointReceipt("FAILED"))
+	tampered = []byte(strings.Replace(string(tampered), "FAILED", "DELIVERED", 1))
+
+	for name, raw := range map[string][]byte{
+		"tampered":  tampered,
+		"unsigned":  []byte(`{"Type":"Notification","Message":"{}","SignatureVersion":"1","SigningCertURL":"https://` + testSNSHost + `/SimpleNotificationService.pem"}`),
+		"version":   []byte(`{"Type":"Notification","SignatureVersion":"3"}`),
+		"type":      []byte(`{"Type":"UnsubscribeConfirmation"}`),
+		"cert host": f.sign(t, snsEnvelope{Type: snsTypeNotification, Message: "{}", SigningCertURL: "https://sns.attacker.example/cert.pem"}),
+		"cert http": f.sign(t, snsEnvelope{Type: snsTypeNotification, Message: "{}", SigningCertURL: "http://" + testSNSHost + "/SimpleNotificationService.pem"}),
+		"region":    f.sign(t, snsEnvelope{Type: snsTypeNotification, Message: "{}", SigningCertURL: "https://sns.eu-west-1.amazonaws.com/SimpleNotificationService.pem"}),
+	} {
+		if _, err := f.receiver.receive(context.Background(), raw); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSNSReceiverSubscriptionConfirmation(t *testing.T) {
+	f := newFakeSNS(t)
+
+	env := snsEnvelope{
+		Type:         snsTypeSubscriptionConfirmation,
+		MessageID:    "c-1",
+		Token:        "token",
+		TopicArn:     "arn:aws:sns:us-east-1:123456789012:sms",
+		Message:      "You have chosen to subscribe to the topic.",
+		SubscribeURL: "https://" + testSNSHost + "/?Action=ConfirmSubscription&TopicArn=arn&Token=token",
+		Timestamp:    "2023-11-14T22:13:20.000Z",
+	}
+	if _, err := f.receiver.receive(context.Background(), f.sign(t, env)); !errors.Is(err, ErrSubscriptionConfirmed) {
+		t.Fatalf("got %v, want ErrSubscriptionConfirmed", err)
+	}
+	if n := f.confirmed.Load(); n != 1 {
+		t.Fatalf("subscription confirmed %d times", n)
+	}
+
+	// A signed confirmation pointing elsewhere isn't followed.
+	env.SubscribeURL = "https://internal.example/?Action=ConfirmSubscription"
+	if _, err := f.receiver.receive(context.Background(), f.sign(t, env)); err == nil || errors.Is(err, ErrSubscriptionConfirmed) {
+		t.Fatalf("got %v, want an error", err)
+	}
+	if n := f.confirmed.Load(); n != 1 {
+		t.Errorf("subscription confirmed %d times", n)
+	}
+}
+
+func TestParseDeliveryReceipt(t *testing.T) {
+	for status, want := range map[string]string{
+		"DELIVERED":  DeliveryStatusDelivered,
+		"SUCCESSFUL": DeliveryStatusPending,
+		"PENDING":    DeliveryStatusPending,
+		"BLOCKED":    DeliveryStatusFailed,
+	} {
+		st, err := parseDeliveryReceipt(pinpointReceipt(status))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Status != want || st.ProviderStatus != status {
+			t.Errorf("%s: got %+v", status, st)
+		}
+	}
+
+	// An SNS SMS delivery status log.
+	st, err := parseDeliveryReceipt(snsEnvelope{
+		Type:      snsTypeNotification,
+		Timestamp: "2023-11-14T22:13:20.000Z",
+		Message:   `{"notification":{"messageId":"m-2","timestamp":"2023-11-14 22:13:21.123"},"delivery":{"providerResponse":"Message has been accepted by phone"},"status":"SUCCESS"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.MessageID != "m-2" || st.Status != DeliveryStatusDelivered || st.Timestamp.Format(snsDeliveryTimeLayout) != "2023-11-14 22:13:21.123" {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	if _, err := parseDeliveryReceipt(snsEnvelope{Type: snsTypeNotification, Message: `{"foo":1}`}); err == nil {
+		t.Error("expected an error for a notification that isn't a receipt")
+	}
+}
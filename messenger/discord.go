@@ -0,0 +1,166 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/francoispqt/onelog"
+)
+
+// Discord's embed limits, in characters.
+const (
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+)
+
+type discordCfg struct {
+	WebhookURL string `json:"webhook_url"`
+
+	// WebhookURLAttribute is an optional subscriber attribute holding a
+	// per-subscriber webhook URL that overrides WebhookURL.
+	WebhookURLAttribute string `json:"webhook_url_attribute"`
+	httpClientCfg
+	logCfg
+}
+
+type discordMessenger struct {
+	cfg    discordCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type discordEmbed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description"`
+}
+
+type discordPayload struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordResp struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+func (d discordMessenger) Name() string {
+	return "discord"
+}
+
+// Push posts the message as an embed to the Discord webhook.
+func (d discordMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	d.logger.DebugWith("sending message").String("email", d.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	u := d.cfg.WebhookURL
+	if d.cfg.WebhookURLAttribute != "" {
+		if a, ok := msg.Subscriber.Attribs[d.cfg.WebhookURLAttribute].(string); ok && a != "" {
+			u = a
+		}
+	}
+	if u == "" {
+		return "", fmt.Errorf("could not find discord webhook url")
+	}
+
+	// wait=true makes Discord respond with the created message instead of
+	// an empty 204.
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("invalid discord webhook url: %v", err)
+	}
+	q := pu.Query()
+	q.Set("wait", "true")
+	pu.RawQuery = q.Encode()
+
+	b, err := json.Marshal(discordPayload{
+		Embeds: []discordEmbed{{
+			Title:       truncate(msg.Subject, discordMaxTitle),
+			Description: truncate(string(msg.Body), discordMaxDescription),
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pu.String(), bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "discord"); err != nil {
+		return "", err
+	}
+
+	var out discordResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding discord response (status %d): %v", resp.StatusCode, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("%w: discord error: %s", ErrAuth, out.Message)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return "", fmt.Errorf("discord error (status %d): %s", resp.StatusCode, out.Message)
+	}
+
+	d.logger.InfoWith("successfully sent discord message").String("subject", msg.Subject).String("message_id", out.ID).Write()
+
+	return out.ID, nil
+}
+
+func (d discordMessenger) Flush() error {
+	return nil
+}
+
+func (d discordMessenger) Close() error {
+	d.client.CloseIdleConnections()
+	return nil
+}
+
+// truncate shortens s to at most max characters, ending it with an
+// ellipsis if it was cut.
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
+
+// NewDiscord creates new instance of discord
+func NewDiscord(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c discordCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.WebhookURL == "" && c.WebhookURLAttribute == "" {
+		return nil, fmt.Errorf("invalid webhook_url or webhook_url_attribute")
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return discordMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestDiscordPush(t *testing.T) {
+	var (
+		wait    string
+		payload discordPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait = r.URL.Query().Get("wait")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"id": "1234567890"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewDiscord([]byte(fmt.Sprintf(`{"webhook_url": %q}`, srv.URL+"/api/webhooks/1/token")), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Titles and descriptions over Discord's limits are truncated with
+	// an ellipsis, counting characters rather than bytes.
+	msg := testMessage()
+	msg.Subject = strings.Repeat("é", discordMaxTitle+10)
+	msg.Body = []byte(strings.Repeat("ü", discordMaxDescription+10))
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1234567890" || wait != "true" {
+		t.Errorf("got id %q with wait=%q", id, wait)
+	}
+	if len(payload.Embeds) != 1 {
+		t.Fatalf("got embeds %+v", payload.Embeds)
+	}
+	e := payload.Embeds[0]
+	if n := utf8.RuneCountInString(e.Title); n != discordMaxTitle || !strings.HasSuffix(e.Title, "…") {
+		t.Errorf("got a %d character title", n)
+	}
+	if n := utf8.RuneCountInString(e.Description); n != discordMaxDescription || !strings.HasSuffix(e.Description, "…") {
+		t.Errorf("got a %d character description", n)
+	}
+
+	// Content within the limits is sent as is.
+	if _, err := m.Push(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if e := payload.Embeds[0]; e.Title != "Hello" || e.Description != "<p>Hello</p>" {
+		t.Errorf("got embed %+v", e)
+	}
+}
+
+func TestDiscordPushRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 1.5, "global": false}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewDiscord([]byte(fmt.Sprintf(`{"webhook_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Push(context.Background(), testMessage())
+	var te *ThrottledError
+	if !errors.Is(err, ErrThrottled) || !errors.As(err, &te) || te.RetryAfter != 2*time.Second {
+		t.Errorf("got %v, want ErrThrottled with a 2s Retry-After", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "You are being rate limited.") {
+		t.Errorf("got %v, want the discord message", err)
+	}
+}
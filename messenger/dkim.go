@@ -0,0 +1,80 @@
+package messenger
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// dkimSignedHeaders are the headers included in DKIM signatures, when the
+// message has them.
+var dkimSignedHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"MIME-Version", "Content-Type", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// dkimSigner signs raw messages with an rsa-sha256 DKIM signature using the
+// relaxed/relaxed canonicalization.
+type dkimSigner struct {
+	opt dkim.SignOptions
+}
+
+// newDKIMSigner loads the PEM encoded RSA private key, in PKCS #1 or
+// PKCS #8 form, from keyFile.
+func newDKIMSigner(domain, selector, keyFile string) (*dkimSigner, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dkim_private_key_file: %v", err)
+	}
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return nil, fmt.Errorf("invalid dkim_private_key_file: no PEM block found")
+	}
+
+	var key *rsa.PrivateKey
+	switch blk.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(blk.Bytes)
+	case "PRIVATE KEY":
+		var k any
+		k, err = x509.ParsePKCS8PrivateKey(blk.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = k.(*rsa.PrivateKey); !ok {
+				err = errors.New("only RSA keys are supported")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", blk.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid dkim_private_key_file: %v", err)
+	}
+
+	return &dkimSigner{opt: dkim.SignOptions{
+		Domain:                 domain,
+		Selector:               selector,
+		Signer:                 key,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             dkimSignedHeaders,
+	}}, nil
+}
+
+// sign returns the message with a DKIM-Signature header prepended.
+func (d *dkimSigner) sign(msg []byte) ([]byte, error) {
+	var b bytes.Buffer
+	b.Grow(len(msg) + 512)
+
+	opt := d.opt
+	if err := dkim.Sign(&b, bytes.NewReader(msg), &opt); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,130 @@
+package messenger
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// writeDKIMKey writes a new RSA key to a PEM file and returns its path.
+func writeDKIMKey(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dkim.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, key
+}
+
+// verifyDKIM verifies the DKIM signature of a signed message with
+// go-msgauth, serving the public key as the mail._domainkey.example.com
+// TXT record.
+func verifyDKIM(msg []byte, pub *rsa.PublicKey) error {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	lookup := func(domain string) ([]string, error) {
+		if domain != "mail._domainkey.example.com" {
+			return nil, fmt.Errorf("unexpected lookup of %s", domain)
+		}
+		return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)}, nil
+	}
+
+	vs, err := dkim.VerifyWithOptions(bytes.NewReader(msg), &dkim.VerifyOptions{LookupTXT: lookup})
+	if err != nil {
+		return err
+	}
+	if len(vs) != 1 {
+		return fmt.Errorf("got %d signatures, want 1", len(vs))
+	}
+	return vs[0].Err
+}
+
+func TestDKIMSign(t *testing.T) {
+	path, key := writeDKIMKey(t)
+	signer, err := newDKIMSigner("example.com", "mail", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email := makeEmail(Message{
+		From:        "Sender <sender@example.com>",
+		Subject:     "Hello   there",
+		ContentType: ContentTypeHTML,
+		Body:        []byte("<p>Hello  world</p>"),
+		AltBody:     []byte("Hello  world \t"),
+		Attachments: []Attachment{{Name: "a.txt", Content: []byte("attached")}},
+	})
+	email.To = []string{"to@example.com"}
+	raw, err := email.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := signer.sign(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(signed, []byte("DKIM-Signature: ")) {
+		t.Fatalf("unexpected signature header: %.120s", signed)
+	}
+	if !bytes.HasSuffix(signed, raw) {
+		t.Fatal("signed message doesn't end with the original message")
+	}
+	if err := verifyDKIM(signed, &key.PublicKey); err != nil {
+		t.Fatalf("signature doesn't verify: %v", err)
+	}
+
+	sig := string(signed[:len(signed)-len(raw)])
+	for _, tag := range []string{"a=rsa-sha256", "c=relaxed/relaxed", "d=example.com", "s=mail"} {
+		if !strings.Contains(sig, tag) {
+			t.Errorf("signature has no %s: %s", tag, sig)
+		}
+	}
+
+	// Tampering with a signed header or the body breaks the signature.
+	for _, tc := range []struct{ old, new string }{
+		{"Subject: Hello   there", "Subject: Hello there!"},
+		// The base64 encoded attachment content, "attached".
+		{"YXR0YWNoZWQ=", "YXR0YWNrZWQ="},
+	} {
+		tampered := strings.Replace(string(signed), tc.old, tc.new, 1)
+		if tampered == string(signed) {
+			t.Fatalf("%q not found in the message", tc.old)
+		}
+		if err := verifyDKIM([]byte(tampered), &key.PublicKey); err == nil {
+			t.Errorf("replacing %q with %q didn't break the signature", tc.old, tc.new)
+		}
+	}
+}
+
+func TestNewDKIMSignerErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.pem"), notPEM} {
+		if _, err := newDKIMSigner("example.com", "mail", path); err == nil {
+			t.Errorf("expected an error for %s", path)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package messenger
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/knadh/smtppool"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const (
+	defaultCharset = "UTF-8"
+
+	hdrContentEncoding = "Content-Encoding"
+
+	contentTypeAMP = "text/x-amp-html"
+
+	hdrListUnsubscribe     = "List-Unsubscribe"
+	hdrListUnsubscribePost = "List-Unsubscribe-Post"
+)
+
+// makeEmail converts a Message into an smtppool.Email that can either be
+// rendered to raw bytes or sent over SMTP.
+func makeEmail(msg Message) smtppool.Email {
+	// An explicit content type is authoritative, an empty one is detected.
+	ct := msg.ContentType
+	if ct == "" {
+		ct = detectContentType(msg.Body)
+	}
+	isHTML := ct != ContentTypePlain
+
+	// convert attachments to smtppool.Attachments
+	var files []smtppool.Attachment
+	if msg.Attachments != nil {
+		files = make([]smtppool.Attachment, 0, len(msg.Attachments))
+		for _, f := range msg.Attachments {
+			a := smtppool.Attachment{
+				Filename: f.Name,
+				Header:   attachmentHeader(f),
+				Content:  make([]byte, len(f.Content)),
+			}
+			copy(a.Content, f.Content)
+
+			// Inline parts are only meaningful alongside an HTML body.
+			if f.ContentID != "" && isHTML {
+				a.HTMLRelated = true
+				a.Header.Set(smtppool.HdrContentID, "<"+f.ContentID+">")
+				a.Header.Set(smtppool.HdrContentDisposition, fmt.Sprintf("inline;\r\n filename=\"%s\"", f.Name))
+			}
+			files = append(files, a)
+		}
+	}
+
+	// Copy the headers so messengers can add their own without
+	// mutating the caller's message.
+	headers := make(textproto.MIMEHeader, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = append([]string(nil), v...)
+	}
+
+	// One-click unsubscribe (RFC 8058) requires an HTTPS URL, so the
+	// List-Unsubscribe-Post header is only added when one is present.
+	var unsub []string
+	if msg.UnsubscribeURL != "" {
+		unsub = append(unsub, "<"+msg.UnsubscribeURL+">")
+		headers.Set(hdrListUnsubscribePost, "List-Unsubscribe=One-Click")
+	}
+	if msg.UnsubscribeMailto != "" {
+		unsub = append(unsub, "<mailto:"+strings.TrimPrefix(msg.UnsubscribeMailto, "mailto:")+">")
+	}
+	if len(unsub) > 0 {
+		headers.Set(hdrListUnsubscribe, strings.Join(unsub, ", "))
+	}
+
+	email := smtppool.Email{
+		From:        messageFrom(msg),
+		To:          []string{msg.Subscriber.Email},
+		Cc:          msg.Cc,
+		Bcc:         msg.Bcc,
+		ReplyTo:     msg.ReplyTo,
+		Subject:     msg.Subject,
+		Sender:      msg.From,
+		Headers:     headers,
+		Attachments: files,
+	}
+
+	// An HTML body with an alternative plain text body is rendered as
+	// multipart/alternative.
+	if isHTML {
+		email.HTML = msg.Body
+		email.Text = msg.AltBody
+	} else {
+		email.Text = msg.Body
+	}
+
+	return email
+}
+
+// validateHeaders checks custom headers for names with characters that
+// aren't allowed by RFC 5322 and for values with CR or LF characters that
+// would inject headers of their own.
+func validateHeaders(h textproto.MIMEHeader) error {
+	for k, vals := range h {
+		if k == "" {
+			return fmt.Errorf("invalid empty header name")
+		}
+		for i := 0; i < len(k); i++ {
+			if c := k[i]; c < 33 || c > 126 || c == ':' {
+				return fmt.Errorf("invalid header name %q", k)
+			}
+		}
+		for _, v := range vals {
+			if strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("invalid value for header %q: contains CR or LF", k)
+			}
+		}
+	}
+	return nil
+}
+
+// errMissingFrom is returned when neither the campaign nor the message
+// has a from address.
+var errMissingFrom = errors.New("invalid from: neither the campaign nor the message has a from address")
+
+// messageFrom returns the From address for an email, preferring the
+// campaign's from address over the message's when it's set.
+func messageFrom(msg Message) string {
+	if msg.Campaign != nil && msg.Campaign.FromEmail != "" {
+		return msg.Campaign.FromEmail
+	}
+	return msg.From
+}
+
+// validateRecipient returns ErrInvalidRecipient if the subscriber's email
+// is empty or isn't a valid RFC 5322 address.
+func validateRecipient(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("%w: empty email", ErrInvalidRecipient)
+	}
+	if _, err := mail.ParseAddress(addr); err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidRecipient, addr, err)
+	}
+	return nil
+}
+
+// splitAddress splits an RFC 5322 address, eg: "Name <addr>", into its
+// name and address parts. Unparseable values are returned as the address.
+func splitAddress(s string) (string, string) {
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", s
+	}
+	return a.Name, a.Address
+}
+
+// withDefaultName adds name to a bare from address. Addresses that already
+// have a name, or can't be parsed, are returned as is. Non-ASCII names are
+// rendered as RFC 2047 encoded-words.
+func withDefaultName(from, name string) string {
+	a, err := mail.ParseAddress(from)
+	if err != nil || a.Name != "" {
+		return from
+	}
+
+	a.Name = name
+	return a.String()
+}
+
+// reHTMLContent matches common HTML tags for detecting HTML bodies.
+var reHTMLContent = regexp.MustCompile(`(?i)<(!doctype\s+html|html|head|body|p|div|br|a|table|span|img|h[1-6]|ul|ol|li|strong|em|b|i)[\s/>]`)
+
+// detectContentType returns ContentTypeHTML if the body contains HTML tags
+// and ContentTypePlain otherwise.
+func detectContentType(body []byte) string {
+	if reHTMLContent.Match(body) {
+		return ContentTypeHTML
+	}
+	return ContentTypePlain
+}
+
+// gzipMagic is the header of gzip compressed content.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipTypes are Content-Types that declare the content as gzip compressed.
+var gzipTypes = map[string]bool{
+	"application/gzip":   true,
+	"application/x-gzip": true,
+}
+
+// attachmentHeader returns a copy of the attachment's MIME header, filling
+// in the Content-Type (detected from the filename or the content),
+// disposition and encoding when they're missing. gzip compressed content
+// whose Content-Type doesn't say so, eg: a compressed "report.csv", is
+// marked with a Content-Encoding.
+func attachmentHeader(f Attachment) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader, len(f.Header)+3)
+	for k, v := range f.Header {
+		h[k] = append([]string(nil), v...)
+	}
+
+	if h.Get(smtppool.HdrContentType) == "" {
+		ct := mime.TypeByExtension(filepath.Ext(f.Name))
+		if ct == "" {
+			// DetectContentType falls back to application/octet-stream.
+			ct = http.DetectContentType(f.Content)
+		}
+		h.Set(smtppool.HdrContentType, ct)
+	}
+	if h.Get(hdrContentEncoding) == "" && bytes.HasPrefix(f.Content, gzipMagic) {
+		ct, _, _ := mime.ParseMediaType(h.Get(smtppool.HdrContentType))
+		if !gzipTypes[ct] {
+			h.Set(hdrContentEncoding, "gzip")
+		}
+	}
+	if h.Get(smtppool.HdrContentDisposition) == "" {
+		h.Set(smtppool.HdrContentDisposition, fmt.Sprintf("attachment;\r\n filename=\"%s\"", f.Name))
+	}
+	if h.Get(smtppool.HdrContentTransferEncoding) == "" {
+		h.Set(smtppool.HdrContentTransferEncoding, "base64")
+	}
+
+	return h
+}
+
+// charsetEncoder returns the encoder for the named charset.
+func charsetEncoder(charset string) (*encoding.Encoder, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q", charset)
+	}
+	return enc.NewEncoder(), nil
+}
+
+// encodeCharset transcodes the email's subject and body to the given
+// charset. The subject is rendered as an RFC 2047 encoded-word. The body
+// parts are labelled with the charset by renderEmail.
+func encodeCharset(email *smtppool.Email, charset string) error {
+	if strings.EqualFold(charset, defaultCharset) {
+		// UTF-8 bodies need no transcoding, but the subject is still
+		// encoded explicitly rather than relying on smtppool.
+		email.Subject = mime.BEncoding.Encode(defaultCharset, email.Subject)
+		return nil
+	}
+
+	enc, err := charsetEncoder(charset)
+	if err != nil {
+		return err
+	}
+
+	subj, err := enc.String(email.Subject)
+	if err != nil {
+		return fmt.Errorf("error encoding subject as %s: %v", charset, err)
+	}
+	email.Subject = mime.BEncoding.Encode(charset, subj)
+
+	if email.Text, err = enc.Bytes(email.Text); err != nil {
+		return fmt.Errorf("error encoding body as %s: %v", charset, err)
+	}
+	if email.HTML, err = enc.Bytes(email.HTML); err != nil {
+		return fmt.Errorf("error encoding body as %s: %v", charset, err)
+	}
+
+	return nil
+}
+
+// renderEmail renders the email to raw bytes like smtppool's Bytes, with
+// the text and HTML parts labelled with the charset they were encoded in by
+// encodeCharset. smtppool labels them as UTF-8 and only renders the message
+// headers here.
+func renderEmail(email smtppool.Email, charset string) ([]byte, error) {
+	if strings.EqualFold(charset, defaultCharset) {
+		return email.Bytes()
+	}
+
+	head := email
+	head.Text, head.HTML, head.Attachments = nil, nil, nil
+	raw, err := head.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	fields, _, err := splitMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var related, others []mimePart
+	for _, a := range email.Attachments {
+		p := mimePart{header: a.Header, content: a.Content}
+		if a.HTMLRelated {
+			related = append(related, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	if len(email.HTML) == 0 && len(related) > 0 {
+		return nil, errors.New("there are HTML attachments, but no HTML body")
+	}
+
+	// The body is text, HTML with its inline attachments or both as
+	// alternatives, followed by the other attachments.
+	var alts []mimePart
+	if len(email.Text) > 0 || len(email.HTML) == 0 {
+		alts = append(alts, textPart(smtppool.ContentTypePlain, charset, email.Text))
+	}
+	if len(email.HTML) > 0 {
+		p := textPart(smtppool.ContentTypeHTML, charset, email.HTML)
+		if len(related) > 0 {
+			p = mimePart{multipart: smtppool.ContentTypeMultipartRelated, parts: append([]mimePart{p}, related...)}
+		}
+		alts = append(alts, p)
+	}
+	body := alts[0]
+	if len(alts) > 1 {
+		body = mimePart{multipart: smtppool.ContentTypeMultipartAlt, parts: alts}
+	}
+	if len(others) > 0 {
+		body = mimePart{multipart: smtppool.ContentTypeMultipartMixed, parts: append([]mimePart{body}, others...)}
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(raw) + len(email.Text) + len(email.HTML))
+	for _, f := range fields {
+		if strings.EqualFold(f.name, smtppool.HdrContentType) || strings.EqualFold(f.name, smtppool.HdrContentTransferEncoding) {
+			continue
+		}
+		b.WriteString(f.raw + "\r\n")
+	}
+	if err := body.write(&b, nil); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// mimePart is a part of an email rendered by renderEmail, either a leaf
+// with its header and content or a multipart with its parts.
+type mimePart struct {
+	header  textproto.MIMEHeader
+	content []byte
+
+	multipart string
+	parts     []mimePart
+}
+
+// textPart returns a quoted-printable text part labelled with the charset.
+func textPart(ct, charset string, body []byte) mimePart {
+	return mimePart{
+		header: textproto.MIMEHeader{
+			smtppool.HdrContentType:             {ct + "; charset=" + charset},
+			smtppool.HdrContentTransferEncoding: {"quoted-printable"},
+		},
+		content: body,
+	}
+}
+
+// write writes the part to b, as a part of parent, or as the body of the
+// message after its header when parent is nil.
+func (p mimePart) write(b *bytes.Buffer, parent *multipart.Writer) error {
+	h := p.header
+	var w *multipart.Writer
+	if p.multipart != "" {
+		w = multipart.NewWriter(b)
+		h = textproto.MIMEHeader{smtppool.HdrContentType: {p.multipart + ";\r\n boundary=" + w.Boundary()}}
+	}
+
+	if parent != nil {
+		if _, err := parent.CreatePart(h); err != nil {
+			return err
+		}
+	} else {
+		// The content headers come last, in a stable order.
+		for _, k := range []string{smtppool.HdrContentType, smtppool.HdrContentTransferEncoding} {
+			if v := h.Get(k); v != "" {
+				b.WriteString(k + ": " + v + "\r\n")
+			}
+		}
+		b.WriteString("\r\n")
+	}
+
+	if w == nil {
+		if h.Get(smtppool.HdrContentTransferEncoding) == "quoted-printable" {
+			qp := quotedprintable.NewWriter(b)
+			if _, err := qp.Write(p.content); err != nil {
+				return err
+			}
+			return qp.Close()
+		}
+
+		// Attachments are always base64 encoded, 57 bytes per 76
+		// character line.
+		for c := p.content; len(c) > 0; {
+			n := min(len(c), 57)
+			b.WriteString(base64.StdEncoding.EncodeToString(c[:n]) + "\r\n")
+			c = c[n:]
+		}
+		return nil
+	}
+
+	for _, c := range p.parts {
+		if err := c.write(b, w); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// reAltBoundary matches the boundary of the multipart/alternative part of
+// an email rendered by smtppool.
+var reAltBoundary = regexp.MustCompile(`multipart/alternative;\r\n boundary=([^\r\n]+)`)
+
+// insertAMP adds an AMP part to the end of the multipart/alternative part of
+// a rendered email. Clients pick the last alternative they support, so the
+// part order is text, HTML and then AMP.
+func insertAMP(raw []byte, amp string) ([]byte, error) {
+	m := reAltBoundary.FindSubmatch(raw)
+	if m == nil {
+		return nil, errors.New("amp body requires text and html bodies")
+	}
+	end := bytes.LastIndex(raw, []byte("\r\n--"+string(m[1])+"--"))
+	if end < 0 {
+		return nil, errors.New("error finding the end of the multipart/alternative part")
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(raw) + len(amp) + 256)
+	b.Write(raw[:end])
+	fmt.Fprintf(&b, "\r\n--%s\r\nContent-Transfer-Encoding: quoted-printable\r\nContent-Type: %s; charset=%s\r\n\r\n",
+		m[1], contentTypeAMP, defaultCharset)
+
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(amp)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	b.Write(raw[end:])
+	return b.Bytes(), nil
+}
+
+// htmlToText strips the tags of an HTML body for use as a plain text
+// fallback.
+func htmlToText(b []byte) string {
+	return strings.TrimSpace(html.UnescapeString(reHTMLTag.ReplaceAllString(string(b), "")))
+}
+
+// headerField is a raw header field, including its folds but not its
+// terminating CRLF.
+type headerField struct {
+	name string
+	raw  string
+}
+
+// splitMessage splits a CRLF terminated message into its header fields and
+// body.
+func splitMessage(msg []byte) ([]headerField, []byte, error) {
+	head, body, ok := bytes.Cut(msg, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, nil, errors.New("invalid message: no header separator")
+	}
+
+	var fields []headerField
+	for _, line := range strings.Split(string(head), "\r\n") {
+		if line != "" && (line[0] == ' ' || line[0] == '\t') {
+			if len(fields) == 0 {
+				return nil, nil, errors.New("invalid message: header continues nothing")
+			}
+			fields[len(fields)-1].raw += "\r\n" + line
+			continue
+		}
+
+		name, _, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid header line %q", line)
+		}
+		fields = append(fields, headerField{name: strings.TrimRight(name, " \t"), raw: line})
+	}
+
+	return fields, body, nil
+}
@@ -0,0 +1,433 @@
+package messenger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/knadh/smtppool"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// parsedPart is a leaf part of a parsed email with its content as is,
+// without decoding its transfer encoding.
+type parsedPart struct {
+	header  textproto.MIMEHeader
+	content []byte
+}
+
+// parseEmail parses a raw email and returns its headers and leaf parts
+// in order.
+func parseEmail(t *testing.T, raw []byte) (mail.Header, []parsedPart) {
+	t.Helper()
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.Header, parseParts(t, textproto.MIMEHeader(m.Header), m.Body)
+}
+
+func parseParts(t *testing.T, h textproto.MIMEHeader, r io.Reader) []parsedPart {
+	t.Helper()
+
+	ct, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasPrefix(ct, "multipart/") {
+		var out []parsedPart
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return out
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, parseParts(t, p.Header, p)...)
+		}
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []parsedPart{{header: h, content: b}}
+}
+
+func TestRenderEmailCharset(t *testing.T) {
+	msg := Message{
+		From:        "sender@example.com",
+		Subject:     "Café",
+		ContentType: ContentTypeHTML,
+		Body:        []byte("<p>Café</p>"),
+		AltBody:     []byte("Café"),
+		Attachments: []Attachment{
+			// An attachment labelled, and containing, the charset that
+			// the bodies are relabelled from.
+			{Name: "data.csv", Header: textproto.MIMEHeader{"Content-Type": {"text/csv; charset=UTF-8"}}, Content: []byte("a; charset=UTF-8\n")},
+			{Name: "logo.png", ContentID: "logo", Content: []byte("\x89PNG\r\n\x1a\n")},
+		},
+	}
+	msg.Subscriber.Email = "to@example.com"
+
+	email := makeEmail(msg)
+	if err := encodeCharset(&email, "ISO-8859-1"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := renderEmail(email, "ISO-8859-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, parts := parseEmail(t, raw)
+	if ct := h.Get("Content-Type"); !strings.HasPrefix(ct, "multipart/mixed;") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if subj, _ := new(mime.WordDecoder).DecodeHeader(h.Get("Subject")); subj != "Café" {
+		// The decoder only knows UTF-8, US-ASCII and ISO-8859-1.
+		t.Errorf("got Subject %q", subj)
+	}
+	if h.Get("From") != "<sender@example.com>" || h.Get("To") != "<to@example.com>" || h.Get("Message-Id") == "" {
+		t.Errorf("message headers missing: %v", h)
+	}
+
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts, want text, html, inline image and attachment", len(parts))
+	}
+	latin1, _ := charmap.ISO8859_1.NewEncoder().String("Café")
+	for i, ct := range []string{"text/plain; charset=ISO-8859-1", "text/html; charset=ISO-8859-1"} {
+		p := parts[i]
+		if got := p.header.Get("Content-Type"); got != ct {
+			t.Errorf("part %d: got Content-Type %q, want %q", i, got, ct)
+		}
+		b, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(p.content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), latin1) {
+			t.Errorf("part %d: body %q isn't ISO-8859-1 encoded", i, b)
+		}
+	}
+	if got := parts[2].header.Get("Content-Id"); got != "<logo>" {
+		t.Errorf("got inline Content-Id %q", got)
+	}
+
+	// The attachment is untouched.
+	csv := parts[3]
+	if got := csv.header.Get("Content-Type"); got != "text/csv; charset=UTF-8" {
+		t.Errorf("attachment relabelled: %q", got)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(csv.content), "\r\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "a; charset=UTF-8\n" {
+		t.Errorf("attachment content changed: %q", got)
+	}
+}
+
+func TestRenderEmailSinglePart(t *testing.T) {
+	for _, tc := range []struct {
+		email smtppool.Email
+		ct    string
+	}{
+		{smtppool.Email{From: "a@example.com", To: []string{"b@example.com"}, Text: []byte("x")}, "text/plain; charset=windows-1252"},
+		{smtppool.Email{From: "a@example.com", To: []string{"b@example.com"}, HTML: []byte("<b>x</b>")}, "text/html; charset=windows-1252"},
+	} {
+		raw, err := renderEmail(tc.email, "windows-1252")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, parts := parseEmail(t, raw)
+		if got := h.Get("Content-Type"); got != tc.ct || len(parts) != 1 {
+			t.Errorf("got Content-Type %q with %d parts", got, len(parts))
+		}
+		if n := strings.Count(string(raw), "Content-Type:"); n != 1 {
+			t.Errorf("got %d Content-Type headers", n)
+		}
+	}
+}
+
+func TestRenderEmailUTF8(t *testing.T) {
+	email := smtppool.Email{From: "a@example.com", To: []string{"b@example.com"}, Text: []byte("x"), HTML: []byte("<b>x</b>")}
+	raw, err := renderEmail(email, "utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, parts := parseEmail(t, raw)
+	for _, p := range parts {
+		if ct := p.header.Get("Content-Type"); !strings.HasSuffix(ct, "; charset=UTF-8") {
+			t.Errorf("got Content-Type %q", ct)
+		}
+	}
+}
+
+func TestRenderEmailAMP(t *testing.T) {
+	email := smtppool.Email{From: "a@example.com", To: []string{"b@example.com"}, Text: []byte("x"), HTML: []byte("<b>x</b>")}
+	raw, err := renderEmail(email, "ISO-8859-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = insertAMP(raw, "<html amp4email></html>"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, parts := parseEmail(t, raw)
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	if ct := parts[2].header.Get("Content-Type"); ct != contentTypeAMP+"; charset=UTF-8" {
+		t.Errorf("got AMP Content-Type %q", ct)
+	}
+}
+
+func TestMakeEmailReplyTo(t *testing.T) {
+	msg := Message{From: "sender@example.com", Subject: "Hi", ContentType: ContentTypePlain, Body: []byte("x")}
+	msg.Subscriber.Email = "to@example.com"
+	msg.ReplyTo = []string{"Support <support@example.com>"}
+
+	email := makeEmail(msg)
+	raw, err := email.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := parseEmail(t, raw)
+	if got := h.Get("Reply-To"); got != `"Support" <support@example.com>` {
+		t.Errorf("got Reply-To %q", got)
+	}
+
+	msg.ReplyTo = nil
+	email = makeEmail(msg)
+	if raw, err = email.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := parseEmail(t, raw); h.Get("Reply-To") != "" {
+		t.Errorf("got Reply-To %q without one set", h.Get("Reply-To"))
+	}
+}
+
+func TestAttachmentHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    Attachment
+		want string
+	}{
+		{"extension", Attachment{Name: "report.pdf", Content: []byte("%PDF-1.4")}, "application/pdf"},
+		{"sniffed", Attachment{Name: "logo", Content: []byte("\x89PNG\r\n\x1a\n")}, "image/png"},
+		{"unknown", Attachment{Name: "blob", Content: []byte{0, 1, 2}}, "application/octet-stream"},
+		{"explicit", Attachment{Name: "data.txt", Header: textproto.MIMEHeader{"Content-Type": {"text/csv"}}, Content: []byte("a,b")}, "text/csv"},
+	} {
+		h := attachmentHeader(tc.f)
+		if got := h.Get("Content-Type"); got != tc.want {
+			t.Errorf("%s: got Content-Type %q, want %q", tc.name, got, tc.want)
+		}
+		if got := h.Get("Content-Disposition"); !strings.Contains(got, `filename="`+tc.f.Name+`"`) {
+			t.Errorf("%s: got Content-Disposition %q", tc.name, got)
+		}
+		if got := h.Get("Content-Transfer-Encoding"); got != "base64" {
+			t.Errorf("%s: got Content-Transfer-Encoding %q", tc.name, got)
+		}
+	}
+
+	// The attachment's own header isn't modified.
+	f := Attachment{Name: "a.txt", Header: textproto.MIMEHeader{}}
+	attachmentHeader(f)
+	if len(f.Header) != 0 {
+		t.Errorf("attachment header modified: %v", f.Header)
+	}
+}
+
+func TestAttachmentHeaderGzip(t *testing.T) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write([]byte(`{"a": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz := b.Bytes()
+
+	for _, tc := range []struct {
+		name     string
+		f        Attachment
+		wantType string
+		wantEnc  string
+	}{
+		{"compressed", Attachment{Name: "data.json", Content: gz}, "application/json", "gzip"},
+		{"gzip type", Attachment{Name: "data", Header: textproto.MIMEHeader{"Content-Type": {"application/gzip"}}, Content: gz}, "application/gzip", ""},
+		{"declared", Attachment{Name: "data.json", Header: textproto.MIMEHeader{"Content-Encoding": {"x-gzip"}}, Content: gz}, "application/json", "x-gzip"},
+		{"uncompressed", Attachment{Name: "data.json", Content: []byte(`{"a": 1}`)}, "application/json", ""},
+	} {
+		h := attachmentHeader(tc.f)
+		if got := h.Get("Content-Type"); got != tc.wantType {
+			t.Errorf("%s: got Content-Type %q, want %q", tc.name, got, tc.wantType)
+		}
+		if got := h.Values("Content-Encoding"); strings.Join(got, ",") != tc.wantEnc {
+			t.Errorf("%s: got Content-Encoding %q, want %q", tc.name, got, tc.wantEnc)
+		}
+	}
+}
+
+func TestMakeEmailInline(t *testing.T) {
+	msg := Message{
+		ContentType: ContentTypeHTML,
+		Body:        []byte(`<img src="cid:logo">`),
+		Attachments: []Attachment{
+			{Name: "logo.png", ContentID: "logo", Content: []byte("\x89PNG\r\n\x1a\n")},
+			{Name: "terms.pdf", Content: []byte("%PDF-1.4")},
+		},
+	}
+
+	email := makeEmail(msg)
+	logo, terms := email.Attachments[0], email.Attachments[1]
+	if !logo.HTMLRelated || logo.Header.Get("Content-Id") != "<logo>" || !strings.HasPrefix(logo.Header.Get("Content-Disposition"), "inline;") {
+		t.Errorf("got inline attachment %+v", logo)
+	}
+	if terms.HTMLRelated || terms.Header.Get("Content-Id") != "" || !strings.HasPrefix(terms.Header.Get("Content-Disposition"), "attachment;") {
+		t.Errorf("got regular attachment %+v", terms)
+	}
+
+	// Plain text bodies can't reference inline parts.
+	msg.ContentType = ContentTypePlain
+	if a := makeEmail(msg).Attachments[0]; a.HTMLRelated || a.Header.Get("Content-Id") != "" {
+		t.Errorf("got inline attachment with a plain body %+v", a)
+	}
+}
+
+func TestMakeEmailListUnsubscribe(t *testing.T) {
+	for _, tc := range []struct {
+		url, mailto string
+		want, post  string
+	}{
+		{"https://example.com/u/1", "", "<https://example.com/u/1>", "List-Unsubscribe=One-Click"},
+		{"https://example.com/u/1", "unsub@example.com", "<https://example.com/u/1>, <mailto:unsub@example.com>", "List-Unsubscribe=One-Click"},
+		{"", "mailto:unsub@example.com", "<mailto:unsub@example.com>", ""},
+		{"", "", "", ""},
+	} {
+		email := makeEmail(Message{UnsubscribeURL: tc.url, UnsubscribeMailto: tc.mailto})
+		if got := email.Headers.Get("List-Unsubscribe"); got != tc.want {
+			t.Errorf("%q %q: got List-Unsubscribe %q, want %q", tc.url, tc.mailto, got, tc.want)
+		}
+		if got := email.Headers.Get("List-Unsubscribe-Post"); got != tc.post {
+			t.Errorf("%q %q: got List-Unsubscribe-Post %q, want %q", tc.url, tc.mailto, got, tc.post)
+		}
+	}
+}
+
+func TestMakeEmailAltBody(t *testing.T) {
+	msg := Message{From: "sender@example.com", ContentType: ContentTypeHTML, Body: []byte("<p>Hi</p>"), AltBody: []byte("Hi")}
+	msg.Subscriber.Email = "to@example.com"
+
+	email := makeEmail(msg)
+	raw, err := email.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, parts := parseEmail(t, raw)
+	if ct := h.Get("Content-Type"); !strings.HasPrefix(ct, "multipart/alternative;") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if len(parts) != 2 || !strings.HasPrefix(parts[0].header.Get("Content-Type"), "text/plain") || !strings.HasPrefix(parts[1].header.Get("Content-Type"), "text/html") {
+		t.Fatalf("got parts %+v", parts)
+	}
+
+	// The alternative is ignored for plain text bodies.
+	msg.ContentType = ContentTypePlain
+	email = makeEmail(msg)
+	if string(email.Text) != "<p>Hi</p>" || email.HTML != nil {
+		t.Errorf("got text %q and html %q", email.Text, email.HTML)
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		h    textproto.MIMEHeader
+		want bool
+	}{
+		{textproto.MIMEHeader{"X-Tag": {"a", "b"}, "X-Campaign": {"spring sale"}}, true},
+		{textproto.MIMEHeader{"X-Tag": {"a\r\nBcc: victim@example.com"}}, false},
+		{textproto.MIMEHeader{"X-Tag": {"ok", "a\nb"}}, false},
+		{textproto.MIMEHeader{"X-Tag": {"a\rb"}}, false},
+		{textproto.MIMEHeader{"X Tag": {"a"}}, false},
+		{textproto.MIMEHeader{"X-Tag:": {"a"}}, false},
+		{textproto.MIMEHeader{"X-Tägg": {"a"}}, false},
+		{textproto.MIMEHeader{"": {"a"}}, false},
+	} {
+		if err := validateHeaders(tc.h); (err == nil) != tc.want {
+			t.Errorf("%q: got %v", tc.h, err)
+		}
+	}
+}
+
+func TestSESHeaders(t *testing.T) {
+	m, f := newTestSES(t, "ses", "")
+
+	msg := sesTestMessage()
+	msg.Headers = textproto.MIMEHeader{"X-Tag": {"a\r\nBcc: victim@example.com"}}
+	if _, err := m.Push(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "contains CR or LF") {
+		t.Fatalf("got %v", err)
+	}
+	if n := len(f.requests()); n != 0 {
+		t.Fatalf("got %d requests for an invalid header", n)
+	}
+
+	// Every value of a multi-value header is sent.
+	msg.Headers = textproto.MIMEHeader{"X-Tag": {"a", "b"}}
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := parseEmail(t, f.requests()[0].rawEmail(t))
+	if got := h["X-Tag"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("got X-Tag %q", got)
+	}
+}
+
+func TestEstimatedBytes(t *testing.T) {
+	html := sesTestMessage()
+	html.ContentType = ContentTypeHTML
+	html.Body = []byte(strings.Repeat("<p>Hello, world</p>\n", 2000))
+	html.AltBody = []byte(strings.Repeat("Hello, world\n", 2000))
+
+	att := sesTestMessage()
+	att.Headers = textproto.MIMEHeader{"X-Campaign": {"spring"}}
+	att.Cc = []string{"cc@example.com"}
+	att.Attachments = []Attachment{
+		{Name: "a.bin", Content: bytes.Repeat([]byte{0, 1, 2}, 100000)},
+		{Name: "b.txt", Content: []byte("hello")},
+	}
+	if n := att.AttachmentBytes(); n != 300005 {
+		t.Errorf("got AttachmentBytes %d", n)
+	}
+
+	for _, msg := range []Message{sesTestMessage(), html, att} {
+		email := makeEmail(msg)
+		b, err := email.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The estimate leaves out the MIME structure and the body's
+		// transfer encoding.
+		est, got := msg.EstimatedBytes(), len(b)
+		tolerance := got / 10
+		if tolerance < 1024 {
+			tolerance = 1024
+		}
+		if d := got - est; d > tolerance || d < -tolerance {
+			t.Errorf("got estimate %d for a %d byte email", est, got)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"sync"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// MessageEncoder serializes a message into a request body for the webhook
+// messenger, returning the body and its content type.
+type MessageEncoder interface {
+	Encode(msg Message) ([]byte, string, error)
+}
+
+// MessageEncoderFunc adapts a function to a MessageEncoder.
+type MessageEncoderFunc func(msg Message) ([]byte, string, error)
+
+// Encode calls f(msg).
+func (f MessageEncoderFunc) Encode(msg Message) ([]byte, string, error) {
+	return f(msg)
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]MessageEncoder{
+		"json": JSONEncoder{},
+		"form": FormEncoder{},
+	}
+)
+
+// RegisterEncoder adds an encoder that webhooks can select by name with
+// their "encoder" config. It returns an error if the name is already
+// registered.
+func RegisterEncoder(name string, e MessageEncoder) error {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	if _, ok := encoders[name]; ok {
+		return fmt.Errorf("encoder %s is already registered", name)
+	}
+	encoders[name] = e
+	return nil
+}
+
+// lookupEncoder returns the encoder registered under name.
+func lookupEncoder(name string) (MessageEncoder, error) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	e, ok := encoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoder: %s", name)
+	}
+	return e, nil
+}
+
+// webhookPayload is the body JSONEncoder produces for every message.
+type webhookPayload struct {
+	From        string               `json:"from"`
+	Subject     string               `json:"subject"`
+	ContentType string               `json:"content_type"`
+	Body        string               `json:"body"`
+	Headers     textproto.MIMEHeader `json:"headers,omitempty"`
+	Attachments []webhookAttachment  `json:"attachments,omitempty"`
+	Subscriber  models.Subscriber    `json:"subscriber"`
+	Campaign    *models.Campaign     `json:"campaign,omitempty"`
+}
+
+// webhookAttachment is an attachment in a webhookPayload. The content is
+// base64 encoded. Attachments sent by URL are passed on as is, without
+// their content, to keep the payload small.
+type webhookAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	Content     []byte `json:"content,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+// JSONEncoder encodes the whole message, including the subscriber,
+// campaign and attachments, as a JSON object.
+type JSONEncoder struct{}
+
+// Encode marshals the message into a webhookPayload.
+func (JSONEncoder) Encode(msg Message) ([]byte, string, error) {
+	p := webhookPayload{
+		From:        msg.From,
+		Subject:     msg.Subject,
+		ContentType: msg.ContentType,
+		Body:        string(msg.Body),
+		Headers:     msg.Headers,
+		Subscriber:  msg.Subscriber,
+		Campaign:    msg.Campaign,
+	}
+	for _, a := range msg.Attachments {
+		p.Attachments = append(p.Attachments, webhookAttachment{
+			Name:        a.Name,
+			ContentType: a.Header.Get("Content-Type"),
+			Content:     a.Content,
+			URL:         a.URL,
+		})
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, "", err
+	}
+	return b, "application/json", nil
+}
+
+// FormEncoder encodes the message as flat form fields for targets that
+// don't accept JSON. Forms can't carry files, so attachments are sent as
+// a list of their names only.
+type FormEncoder struct{}
+
+// Encode builds an application/x-www-form-urlencoded body.
+func (FormEncoder) Encode(msg Message) ([]byte, string, error) {
+	v := url.Values{}
+	v.Set("from", msg.From)
+	v.Set("subject", msg.Subject)
+	v.Set("content_type", msg.ContentType)
+	v.Set("body", string(msg.Body))
+	v.Set("subscriber_uuid", msg.Subscriber.UUID)
+	v.Set("subscriber_email", msg.Subscriber.Email)
+	v.Set("subscriber_name", msg.Subscriber.Name)
+	if msg.Campaign != nil {
+		v.Set("campaign_uuid", msg.Campaign.UUID)
+		v.Set("campaign_name", msg.Campaign.Name)
+	}
+	for _, a := range msg.Attachments {
+		v.Add("attachment", a.Name)
+	}
+
+	return []byte(v.Encode()), "application/x-www-form-urlencoded", nil
+}
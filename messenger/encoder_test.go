@@ -0,0 +1,111 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/listmonk/models"
+)
+
+func TestJSONEncoder(t *testing.T) {
+	msg := testMessage()
+	msg.Campaign = &models.Campaign{UUID: "c-1"}
+	msg.Attachments = []Attachment{{Name: "a.txt", Content: []byte("hi")}, {Name: "b.pdf", URL: "https://example.com/b.pdf"}}
+
+	b, ct, err := JSONEncoder{}.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct != "application/json" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "Hello" || p.Subscriber.Email != "to@example.com" || p.Campaign == nil || p.Campaign.UUID != "c-1" {
+		t.Errorf("got payload %+v", p)
+	}
+	if len(p.Attachments) != 2 || string(p.Attachments[0].Content) != "hi" || p.Attachments[1].URL != "https://example.com/b.pdf" {
+		t.Errorf("got attachments %+v", p.Attachments)
+	}
+}
+
+func TestFormEncoder(t *testing.T) {
+	msg := testMessage()
+	msg.Attachments = []Attachment{{Name: "a.txt"}, {Name: "b.pdf"}}
+
+	b, ct, err := FormEncoder{}.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct != "application/x-www-form-urlencoded" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	v, err := url.ParseQuery(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"subject":          "Hello",
+		"body":             "<p>Hello</p>",
+		"subscriber_email": "to@example.com",
+		"campaign_uuid":    "",
+	} {
+		if got := v.Get(k); got != want {
+			t.Errorf("%s: got %q, want %q", k, got, want)
+		}
+	}
+	if got := v["attachment"]; len(got) != 2 || got[0] != "a.txt" || got[1] != "b.pdf" {
+		t.Errorf("got attachments %v", got)
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	enc := MessageEncoderFunc(func(msg Message) ([]byte, string, error) {
+		return []byte(msg.Subject), "text/plain", nil
+	})
+	if err := RegisterEncoder("test-text", enc); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		encodersMu.Lock()
+		delete(encoders, "test-text")
+		encodersMu.Unlock()
+	})
+
+	for _, name := range []string{"json", "test-text"} {
+		if err := RegisterEncoder(name, enc); err == nil {
+			t.Errorf("%s: expected an error registering it again", name)
+		}
+	}
+	if _, err := lookupEncoder("xml"); err == nil {
+		t.Error("expected an error for an unknown encoder")
+	}
+
+	// Webhooks select the registered encoder by name.
+	var ct, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		ct, body = r.Header.Get("Content-Type"), string(b)
+	}))
+	defer srv.Close()
+
+	m, err := NewWebhook([]byte(fmt.Sprintf(`{"url": %q, "encoder": "test-text"}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if ct != "text/plain" || body != "Hello" {
+		t.Errorf("got %q body %q", ct, body)
+	}
+}
@@ -0,0 +1,217 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/francoispqt/onelog"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	fcmAPIURL = "https://fcm.googleapis.com"
+	fcmScope  = "https://www.googleapis.com/auth/firebase.messaging"
+
+	fcmErrorType         = "type.googleapis.com/google.firebase.fcm.v1.FcmError"
+	fcmErrorUnregistered = "UNREGISTERED"
+)
+
+type fcmCfg struct {
+	// CredentialsFile is the path to a service account JSON key. It can
+	// also be given inline as Credentials.
+	CredentialsFile string `json:"credentials_file"`
+	Credentials     string `json:"credentials"`
+
+	// TokenAttribute is the subscriber attribute holding the device
+	// token. Defaults to "fcm_token".
+	TokenAttribute string `json:"token_attribute"`
+
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+// fcmServiceAccount is the subset of a service account JSON key used to
+// authenticate with FCM.
+type fcmServiceAccount struct {
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type fcmMessenger struct {
+	cfg       fcmCfg
+	projectID string
+	client    *http.Client
+	transport *http.Transport
+
+	logger *levelLogger
+}
+
+type fcmResp struct {
+	Name  string `json:"name"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func (f fcmMessenger) Name() string {
+	return "fcm"
+}
+
+// Push sends the push notification through the FCM HTTP v1 API.
+func (f fcmMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	f.logger.DebugWith("sending message").String("email", f.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	token, ok := msg.Subscriber.Attribs[f.cfg.TokenAttribute].(string)
+	if !ok || token == "" {
+		return "", fmt.Errorf("%w: could not find subscriber device token in attribute %q", ErrInvalidRecipient, f.cfg.TokenAttribute)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": token,
+			"notification": map[string]string{
+				"title": msg.Subject,
+				"body":  string(msg.Body),
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf("%s/v1/projects/%s/messages:send", f.cfg.APIURL, f.projectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		var rErr *oauth2.RetrieveError
+		if errors.As(err, &rErr) {
+			return "", fmt.Errorf("%w: error fetching fcm access token: %v", ErrAuth, rErr)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "fcm"); err != nil {
+		return "", err
+	}
+
+	var out fcmResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding fcm response (status %d): %v", resp.StatusCode, err)
+	}
+	if out.Error != nil {
+		e := fmt.Errorf("fcm error %s: %s", out.Error.Status, out.Error.Message)
+		for _, d := range out.Error.Details {
+			if d.Type == fcmErrorType && d.ErrorCode == fcmErrorUnregistered {
+				return "", fmt.Errorf("%w: %w", ErrUnregistered, e)
+			}
+		}
+
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "", fmt.Errorf("%w: %w", ErrAuth, e)
+		}
+		return "", e
+	}
+
+	f.logger.InfoWith("successfully sent push notification").String("email", f.logger.email(msg.Subscriber.Email)).String("message_id", out.Name).Write()
+
+	return out.Name, nil
+}
+
+func (f fcmMessenger) Flush() error {
+	return nil
+}
+
+func (f fcmMessenger) Close() error {
+	f.transport.CloseIdleConnections()
+	return nil
+}
+
+// NewFCM creates new instance of fcm
+func NewFCM(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c fcmCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := []byte(c.Credentials)
+	if c.CredentialsFile != "" {
+		b, err := os.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading credentials_file: %v", err)
+		}
+		creds = b
+	}
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("invalid credentials_file or credentials")
+	}
+
+	var sa fcmServiceAccount
+	if err := json.Unmarshal(creds, &sa); err != nil {
+		return nil, fmt.Errorf("invalid credentials: %v", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" || sa.TokenURI == "" {
+		return nil, fmt.Errorf("invalid credentials: not a service account key")
+	}
+
+	if c.TokenAttribute == "" {
+		c.TokenAttribute = "fcm_token"
+	}
+	if c.APIURL == "" {
+		c.APIURL = fcmAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	// The token source fetches and caches access tokens using the same
+	// transport and timeout as the API requests.
+	base := newHTTPClient(c.httpClientCfg)
+	transport := base.Transport.(*http.Transport)
+	jc := &jwt.Config{
+		Email:        sa.ClientEmail,
+		PrivateKey:   []byte(sa.PrivateKey),
+		PrivateKeyID: sa.PrivateKeyID,
+		Scopes:       []string{fcmScope},
+		TokenURL:     sa.TokenURI,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+	client := oauth2.NewClient(ctx, jc.TokenSource(ctx))
+	client.Timeout = base.Timeout
+
+	return fcmMessenger{
+		client:    client,
+		cfg:       c,
+		transport: transport,
+		projectID: sa.ProjectID,
+		logger:    logger,
+	}, nil
+}
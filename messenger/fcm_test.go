@@ -0,0 +1,126 @@
+package messenger
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+// fcmTestCreds returns a service account key for the project "project"
+// whose tokens are fetched from tokenURL.
+func fcmTestCreds(t *testing.T, tokenURL string) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(map[string]string{
+		"project_id":   "project",
+		"client_email": "fcm@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":    tokenURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestFCMPush(t *testing.T) {
+	var (
+		tokens     atomic.Int32
+		path, auth string
+		payload    struct {
+			Message struct {
+				Token        string
+				Notification struct{ Title, Body string }
+			}
+		}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokens.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600}`))
+			return
+		}
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"name": "projects/project/messages/0:1500415314455276%31bd1c9631bd1c96"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewFCM([]byte(fmt.Sprintf(`{"credentials": %s, "api_url": %q}`, strconv.Quote(fcmTestCreds(t, srv.URL+"/token")), srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.ContentType = ContentTypePlain
+	msg.Body = []byte("You have a new message")
+	for i := 0; i < 2; i++ {
+		id, err := m.Push(context.Background(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "projects/project/messages/0:1500415314455276%31bd1c9631bd1c96" {
+			t.Errorf("got id %q", id)
+		}
+	}
+
+	if path != "/v1/projects/project/messages:send" || auth != "Bearer access-token" {
+		t.Errorf("got request to %s with Authorization %q", path, auth)
+	}
+	if p := payload.Message; p.Token != "device-token" || p.Notification.Title != "Hello" || p.Notification.Body != "You have a new message" {
+		t.Errorf("got payload %+v", payload)
+	}
+
+	// The access token is cached between sends.
+	if n := tokens.Load(); n != 1 {
+		t.Errorf("got %d token requests", n)
+	}
+}
+
+func TestFCMPushErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "Requested entity was not found.", "status": "NOT_FOUND",
+			"details": [{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "UNREGISTERED"}]}}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewFCM([]byte(fmt.Sprintf(`{"credentials": %s, "api_url": %q}`, strconv.Quote(fcmTestCreds(t, srv.URL+"/token")), srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("got %v, want ErrUnregistered", err)
+	}
+
+	msg := testMessage()
+	delete(msg.Subscriber.Attribs, "fcm_token")
+	if _, err := m.Push(context.Background(), msg); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("got %v, want ErrInvalidRecipient", err)
+	}
+}
@@ -0,0 +1,121 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+const (
+	fileFormatEML  = "eml"
+	fileFormatJSON = "json"
+)
+
+type fileCfg struct {
+	Directory string `json:"directory"`
+
+	// Format is either "eml" (default), the raw rendered email, or "json".
+	Format string `json:"format"`
+	logCfg
+}
+
+type fileMessenger struct {
+	cfg fileCfg
+
+	logger *levelLogger
+}
+
+func (f fileMessenger) Name() string {
+	return "file"
+}
+
+// Push writes the message to a timestamped file in the configured
+// directory and returns the file's path as the message ID.
+func (f fileMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	f.logger.DebugWith("sending message").String("email", f.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	var (
+		b   []byte
+		err error
+	)
+	switch f.cfg.Format {
+	case fileFormatJSON:
+		b, err = json.MarshalIndent(webhookPayload{
+			From:        msg.From,
+			Subject:     msg.Subject,
+			ContentType: msg.ContentType,
+			Body:        string(msg.Body),
+			Headers:     msg.Headers,
+			Subscriber:  msg.Subscriber,
+			Campaign:    msg.Campaign,
+		}, "", "  ")
+	default:
+		email := makeEmail(msg)
+		b, err = email.Bytes()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The random suffix added by CreateTemp keeps concurrent pushes from
+	// clobbering each other.
+	pattern := fmt.Sprintf("%s-*.%s", time.Now().Format("20060102T150405.000000000"), f.cfg.Format)
+	fp, err := os.CreateTemp(f.cfg.Directory, pattern)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	if _, err := fp.Write(b); err != nil {
+		return "", err
+	}
+
+	f.logger.InfoWith("wrote message to file").String("email", f.logger.email(msg.Subscriber.Email)).String("path", fp.Name()).Write()
+
+	return fp.Name(), fp.Close()
+}
+
+func (f fileMessenger) Flush() error {
+	return nil
+}
+
+func (f fileMessenger) Close() error {
+	return nil
+}
+
+// NewFile creates new instance of file
+func NewFile(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c fileCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Directory == "" {
+		return nil, fmt.Errorf("invalid directory")
+	}
+	switch c.Format {
+	case "":
+		c.Format = fileFormatEML
+	case fileFormatEML, fileFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid format: %s", c.Format)
+	}
+
+	if err := os.MkdirAll(c.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating directory: %v", err)
+	}
+
+	return fileMessenger{
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestFilePush(t *testing.T) {
+	// The directory is created if it doesn't exist.
+	dir := filepath.Join(t.TempDir(), "outbox")
+
+	m, err := NewFile([]byte(fmt.Sprintf(`{"directory": %q}`, dir)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := m.Push(context.Background(), testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != dir || filepath.Ext(path) != ".eml" {
+		t.Errorf("got path %s", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, parts := parseEmail(t, b)
+	if h.Get("Subject") != "Hello" || h.Get("To") != "<to@example.com>" || h.Get("From") != `"Sender" <sender@example.com>` {
+		t.Errorf("got headers %v", h)
+	}
+	var html bool
+	for _, p := range parts {
+		if strings.HasPrefix(p.header.Get("Content-Type"), "text/html") {
+			html = strings.Contains(partText(t, p), "<p>Hello</p>")
+		}
+	}
+	if !html {
+		t.Error("html body not found in the email")
+	}
+
+	// Every push writes to its own file.
+	path2, err := m.Push(context.Background(), testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path2 == path {
+		t.Errorf("second push overwrote %s", path)
+	}
+}
+
+func TestFilePushJSON(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFile([]byte(fmt.Sprintf(`{"directory": %q, "format": "json"}`, dir)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := m.Push(context.Background(), testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(path) != ".json" {
+		t.Errorf("got path %s", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.From != "Sender <sender@example.com>" || p.Subject != "Hello" || p.Body != "<p>Hello</p>" || p.Subscriber.Email != "to@example.com" {
+		t.Errorf("got payload %+v", p)
+	}
+
+	if _, err := NewFile([]byte(fmt.Sprintf(`{"directory": %q, "format": "mbox"}`, dir)), onelog.New(io.Discard, 0)); err == nil {
+		t.Error("expected an error for an invalid format")
+	}
+}
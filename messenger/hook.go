@@ -0,0 +1,59 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+)
+
+// MessageHook inspects or modifies a message before it's sent, eg: to add
+// a footer or enforce a policy. Returning an error aborts the send.
+type MessageHook func(msg *Message) error
+
+// HookMessenger wraps a Messenger and runs a chain of hooks on every
+// message before pushing it through the underlying messenger.
+type HookMessenger struct {
+	Messenger
+	hooks []MessageHook
+}
+
+// NewHookMessenger wraps m with hooks that run in the given order, each
+// seeing the changes made by the ones before it.
+func NewHookMessenger(m Messenger, hooks ...MessageHook) *HookMessenger {
+	return &HookMessenger{Messenger: m, hooks: hooks}
+}
+
+// Push runs the hooks on the message and pushes the result. The hooks work
+// on a copy of the message, but share its slices and maps with the caller,
+// so they should replace rather than modify those in place.
+func (h *HookMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	for i, hook := range h.hooks {
+		if err := hook(&msg); err != nil {
+			return "", fmt.Errorf("hook %d: %w", i, err)
+		}
+	}
+	return h.Messenger.Push(ctx, msg)
+}
+
+// UnsubscribeFooterHook returns a hook that appends text followed by the
+// message's UnsubscribeURL to plain text bodies. HTML messages and messages
+// without an UnsubscribeURL are left untouched.
+func UnsubscribeFooterHook(text string) MessageHook {
+	return func(msg *Message) error {
+		if msg.UnsubscribeURL == "" {
+			return nil
+		}
+
+		ct := msg.ContentType
+		if ct == "" {
+			ct = detectContentType(msg.Body)
+		}
+		if ct != ContentTypePlain {
+			return nil
+		}
+
+		footer := "\n\n" + text + "\n" + msg.UnsubscribeURL + "\n"
+		body := make([]byte, 0, len(msg.Body)+len(footer))
+		msg.Body = append(append(body, msg.Body...), footer...)
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHookMessenger(t *testing.T) {
+	var order []string
+	hook := func(name string) MessageHook {
+		return func(msg *Message) error {
+			order = append(order, name+":"+msg.Subject)
+			msg.Subject += " " + name
+			return nil
+		}
+	}
+
+	f := &fakeMessenger{}
+	h := NewHookMessenger(f, hook("a"), hook("b"))
+
+	msg := Message{Subject: "Hello"}
+	if _, err := h.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hooks run in order, each seeing the changes of the ones before it,
+	// and the messenger gets the result.
+	if got := order; len(got) != 2 || got[0] != "a:Hello" || got[1] != "b:Hello a" {
+		t.Errorf("got hook calls %v", got)
+	}
+	if got := f.pushed[0].Subject; got != "Hello a b" {
+		t.Errorf("got pushed subject %q", got)
+	}
+	if msg.Subject != "Hello" {
+		t.Errorf("caller's message modified: %q", msg.Subject)
+	}
+}
+
+func TestHookMessengerAbort(t *testing.T) {
+	errPolicy := errors.New("blocked by policy")
+
+	var ran bool
+	f := &fakeMessenger{}
+	h := NewHookMessenger(f,
+		func(msg *Message) error { return errPolicy },
+		func(msg *Message) error { ran = true; return nil },
+	)
+
+	if _, err := h.Push(context.Background(), Message{}); !errors.Is(err, errPolicy) {
+		t.Fatalf("got %v, want the hook's error", err)
+	}
+	if ran {
+		t.Error("hook after the failing one ran")
+	}
+	if n := f.pushes(); n != 0 {
+		t.Errorf("got %d pushes after an aborted send", n)
+	}
+}
+
+func TestUnsubscribeFooterHook(t *testing.T) {
+	hook := UnsubscribeFooterHook("Unsubscribe:")
+	for _, tc := range []struct {
+		msg  Message
+		want string
+	}{
+		{Message{ContentType: ContentTypePlain, Body: []byte("Hi"), UnsubscribeURL: "https://example.com/u"}, "Hi\n\nUnsubscribe:\nhttps://example.com/u\n"},
+		// The content type is detected when it isn't set.
+		{Message{Body: []byte("Hi"), UnsubscribeURL: "https://example.com/u"}, "Hi\n\nUnsubscribe:\nhttps://example.com/u\n"},
+		{Message{ContentType: ContentTypeHTML, Body: []byte("<p>Hi</p>"), UnsubscribeURL: "https://example.com/u"}, "<p>Hi</p>"},
+		{Message{ContentType: ContentTypePlain, Body: []byte("Hi")}, "Hi"},
+	} {
+		body := string(tc.msg.Body)
+		msg := tc.msg
+		if err := hook(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Body) != tc.want {
+			t.Errorf("%q: got %q, want %q", body, msg.Body, tc.want)
+		}
+		if string(tc.msg.Body) != body {
+			t.Errorf("%q: original body modified", body)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	httpDefaultTimeout = 10 * time.Second
+
+	// attachmentDefaultMaxBytes and attachmentDefaultTimeout are the default
+	// limits on fetching an attachment by its URL.
+	attachmentDefaultMaxBytes = 10 * 1024 * 1024
+	attachmentDefaultTimeout  = 30 * time.Second
+)
+
+// ThrottledError is returned by the HTTP messengers when the provider rate
+// limits a request. It matches ErrThrottled with errors.Is and carries the
+// delay the provider asked for, if any, in its Retry-After header.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Err == nil {
+		return ErrThrottled.Error()
+	}
+	return ErrThrottled.Error() + ": " + e.Err.Error()
+}
+
+// Is makes the error match ErrThrottled.
+func (e *ThrottledError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// newThrottledError creates a ThrottledError for a rate limited response
+// with the given headers.
+func newThrottledError(h http.Header, err error) *ThrottledError {
+	return &ThrottledError{RetryAfter: parseRetryAfter(h.Get("Retry-After"), time.Now()), Err: err}
+}
+
+// throttledBodyMaxBytes caps how much of a rate limited response's body is
+// included in its ThrottledError.
+const throttledBodyMaxBytes = 512
+
+// checkThrottled returns a ThrottledError for a 429 Too Many Requests
+// response from the provider and nil for any other response. The HTTP
+// messengers call it before parsing the body, which rate limiters in front
+// of the API don't always return in the provider's format.
+func checkThrottled(resp *http.Response, provider string) error {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, throttledBodyMaxBytes))
+	if b = bytes.TrimSpace(b); len(b) == 0 {
+		return newThrottledError(resp.Header, fmt.Errorf("rate limited by %s", provider))
+	}
+	return newThrottledError(resp.Header, fmt.Errorf("rate limited by %s: %s", provider, b))
+}
+
+// parseRetryAfter parses a Retry-After header value, either a number of
+// seconds or an HTTP date (RFC 9110), into a delay from now. It returns 0
+// for empty or invalid values and dates in the past.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// httpClientCfg is the HTTP client config shared by the HTTP based
+// messengers, embedded in their configs.
+type httpClientCfg struct {
+	// Timeout bounds a whole request including reading the response.
+	// Defaults to 10s.
+	Timeout string `json:"timeout"`
+
+	// ConnectTimeout bounds establishing a connection. Defaults to the
+	// standard library's 30s.
+	ConnectTimeout string `json:"connect_timeout"`
+
+	// MaxIdleConns is the number of idle keep-alive connections kept to
+	// the provider. Defaults to the standard library's limits.
+	MaxIdleConns int `json:"max_idle_conns"`
+
+	// AttachmentMaxBytes and AttachmentTimeout limit the size of, and the
+	// time taken fetching, each attachment sent by URL. They default to
+	// 10 MiB and 30s.
+	AttachmentMaxBytes int64  `json:"attachment_max_bytes"`
+	AttachmentTimeout  string `json:"attachment_timeout"`
+
+	// AttachmentAllowPrivate allows fetching attachments from loopback,
+	// private and link-local addresses, eg: a file server on the internal
+	// network. It's off by default as attachment URLs come from postbacks.
+	AttachmentAllowPrivate bool `json:"attachment_allow_private"`
+}
+
+// validate checks the config so that newHTTPClient can't fail.
+func (c httpClientCfg) validate() error {
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %v", err)
+		}
+	}
+	if c.ConnectTimeout != "" {
+		if _, err := time.ParseDuration(c.ConnectTimeout); err != nil {
+			return fmt.Errorf("invalid connect_timeout: %v", err)
+		}
+	}
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("invalid max_idle_conns: %d", c.MaxIdleConns)
+	}
+	if c.AttachmentMaxBytes < 0 {
+		return fmt.Errorf("invalid attachment_max_bytes: %d", c.AttachmentMaxBytes)
+	}
+	if c.AttachmentTimeout != "" {
+		if d, err := time.ParseDuration(c.AttachmentTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid attachment_timeout: %s", c.AttachmentTimeout)
+		}
+	}
+	return nil
+}
+
+// newHTTPClient creates an HTTP client with its own transport from a
+// config checked with validate.
+func newHTTPClient(cfg httpClientCfg) *http.Client {
+	timeout := httpDefaultTimeout
+	if cfg.Timeout != "" {
+		timeout, _ = time.ParseDuration(cfg.Timeout)
+	}
+
+	transport := newHTTPTransport()
+	if cfg.ConnectTimeout != "" {
+		d, _ := time.ParseDuration(cfg.ConnectTimeout)
+		transport.DialContext = (&net.Dialer{Timeout: d, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if cfg.MaxIdleConns > 0 {
+		// Messengers talk to a single provider, so the per-host limit is
+		// the one that matters.
+		transport.MaxIdleConns = cfg.MaxIdleConns
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// errPrivateAddr is returned when fetching an attachment from an address
+// that isn't publicly routable without attachment_allow_private.
+var errPrivateAddr = errors.New("address not allowed")
+
+// fetchAttachments returns the attachments with the content of the ones
+// sent by URL fetched, within the limits set in cfg. The attachments are
+// returned as is if none of them has a URL.
+func fetchAttachments(ctx context.Context, cfg httpClientCfg, files []Attachment) ([]Attachment, error) {
+	var (
+		out    []Attachment
+		client *http.Client
+	)
+	for i, a := range files {
+		if a.URL == "" {
+			continue
+		}
+		if out == nil {
+			out = append([]Attachment(nil), files...)
+			client = newAttachmentClient(cfg)
+			defer client.CloseIdleConnections()
+		}
+
+		b, ct, err := fetchAttachment(ctx, client, cfg, a.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching attachment %s: %w", a.URL, err)
+		}
+
+		out[i].Content = b
+		if out[i].Name == "" {
+			if pu, err := url.Parse(a.URL); err == nil {
+				out[i].Name = path.Base(pu.Path)
+			}
+		}
+		if out[i].Header.Get("Content-Type") == "" && ct != "" {
+			h := textproto.MIMEHeader{}
+			for k, v := range a.Header {
+				h[k] = v
+			}
+			h.Set("Content-Type", ct)
+			out[i].Header = h
+		}
+	}
+	if out == nil {
+		return files, nil
+	}
+	return out, nil
+}
+
+// fetchAttachment downloads an attachment, returning its content and
+// content type.
+func fetchAttachment(ctx context.Context, client *http.Client, cfg httpClientCfg, u string) ([]byte, string, error) {
+	maxBytes := int64(attachmentDefaultMaxBytes)
+	if cfg.AttachmentMaxBytes > 0 {
+		maxBytes = cfg.AttachmentMaxBytes
+	}
+	timeout := attachmentDefaultTimeout
+	if cfg.AttachmentTimeout != "" {
+		d, err := time.ParseDuration(cfg.AttachmentTimeout)
+		if err != nil || d <= 0 {
+			return nil, "", fmt.Errorf("invalid attachment_timeout: %s", cfg.AttachmentTimeout)
+		}
+		timeout = d
+	}
+
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, "", err
+	}
+	if pu.Scheme != "http" && pu.Scheme != "https" {
+		return nil, "", fmt.Errorf("unsupported url scheme %q", pu.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, "", fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrMessageTooLarge, resp.ContentLength, maxBytes)
+	}
+
+	// Read one byte past the limit to detect bodies without a length that
+	// are too large.
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(b)) > maxBytes {
+		return nil, "", fmt.Errorf("%w: attachment exceeds the limit of %d bytes", ErrMessageTooLarge, maxBytes)
+	}
+
+	return b, resp.Header.Get("Content-Type"), nil
+}
+
+// newAttachmentClient creates the client that attachments are fetched
+// with. Unless cfg allows private addresses, it refuses to connect to
+// addresses that aren't publicly routable, including after redirects and
+// DNS resolution, so that postbacks can't make the server fetch internal
+// resources such as cloud metadata endpoints.
+func newAttachmentClient(cfg httpClientCfg) *http.Client {
+	d := &net.Dialer{Timeout: 30 * time.Second}
+	if !cfg.AttachmentAllowPrivate {
+		d.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(ip) {
+				return fmt.Errorf("%w: %s", errPrivateAddr, ip)
+			}
+			return nil
+		}
+	}
+
+	t := newHTTPTransport()
+	// A proxy would make the dialed address that of the proxy.
+	t.Proxy = nil
+	t.DialContext = d.DialContext
+
+	return &http.Client{
+		Transport: t,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported url scheme %q", req.URL.Scheme)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// sharedAddrs is the carrier-grade NAT range (RFC 6598), which isn't
+// covered by netip's IsPrivate.
+var sharedAddrs = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddr reports whether ip is a publicly routable unicast address.
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddrs.Contains(ip)
+}
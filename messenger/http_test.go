@@ -0,0 +1,306 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+func newAttachmentServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		case "/big":
+			_, _ = w.Write(make([]byte, 2048))
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchAttachments(t *testing.T) {
+	srv := newAttachmentServer(t)
+	cfg := httpClientCfg{AttachmentAllowPrivate: true}
+
+	in := []Attachment{
+		{URL: srv.URL + "/files/report.pdf?sig=x"},
+		{Name: "inline.txt", Content: []byte("inline")},
+		{Name: "named.pdf", URL: srv.URL + "/x", Header: textproto.MIMEHeader{"Content-Type": {"application/x-custom"}}},
+	}
+	out, err := fetchAttachments(context.Background(), cfg, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out[0].Name != "report.pdf" || string(out[0].Content) != "%PDF-1.4" || out[0].Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("unexpected fetched attachment: %+v", out[0])
+	}
+	if out[1].Name != "inline.txt" || string(out[1].Content) != "inline" {
+		t.Errorf("inline attachment changed: %+v", out[1])
+	}
+	if out[2].Name != "named.pdf" || out[2].Header.Get("Content-Type") != "application/x-custom" {
+		t.Errorf("name or header of fetched attachment overridden: %+v", out[2])
+	}
+	if in[0].Content != nil {
+		t.Error("input attachments were modified")
+	}
+}
+
+func TestFetchAttachmentsNoURLs(t *testing.T) {
+	in := []Attachment{{Name: "a.txt", Content: []byte("a")}}
+	out, err := fetchAttachments(context.Background(), httpClientCfg{}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &out[0] != &in[0] {
+		t.Error("attachments without URLs were copied")
+	}
+}
+
+func TestFetchAttachmentsErrors(t *testing.T) {
+	srv := newAttachmentServer(t)
+
+	for _, tc := range []struct {
+		name string
+		cfg  httpClientCfg
+		url  string
+		want error
+	}{
+		{"size cap", httpClientCfg{AttachmentAllowPrivate: true, AttachmentMaxBytes: 1024}, srv.URL + "/big", ErrMessageTooLarge},
+		{"timeout", httpClientCfg{AttachmentAllowPrivate: true, AttachmentTimeout: "50ms"}, srv.URL + "/slow", context.DeadlineExceeded},
+		{"loopback", httpClientCfg{}, srv.URL + "/a.pdf", errPrivateAddr},
+		{"metadata", httpClientCfg{AttachmentTimeout: "1s"}, "http://169.254.169.254/latest/meta-data/", errPrivateAddr},
+		{"status", httpClientCfg{AttachmentAllowPrivate: true}, srv.URL + "/missing", nil},
+		{"scheme", httpClientCfg{AttachmentAllowPrivate: true}, "file:///etc/passwd", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fetchAttachments(context.Background(), tc.cfg, []Attachment{{URL: tc.url}})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:2800::1":     true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := isPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestHTTPClientCfgValidate(t *testing.T) {
+	for _, c := range []httpClientCfg{
+		{Timeout: "soon"},
+		{ConnectTimeout: "x"},
+		{MaxIdleConns: -1},
+		{AttachmentMaxBytes: -1},
+		{AttachmentTimeout: "x"},
+		{AttachmentTimeout: "0s"},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+
+	c := httpClientCfg{Timeout: "5s", ConnectTimeout: "1s", MaxIdleConns: 4, AttachmentTimeout: "10s"}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	client := newHTTPClient(c)
+	if client.Timeout != 5*time.Second {
+		t.Errorf("got timeout %v", client.Timeout)
+	}
+	tr := client.Transport.(*http.Transport)
+	if tr.MaxIdleConns != 4 || tr.MaxIdleConnsPerHost != 4 {
+		t.Errorf("got idle conns %d/%d", tr.MaxIdleConns, tr.MaxIdleConnsPerHost)
+	}
+	if tr == http.DefaultTransport {
+		t.Error("transport is shared with http.DefaultTransport")
+	}
+}
+
+// testMessage returns a message with the subscriber attributes that the
+// messengers read their recipients from.
+func testMessage() Message {
+	msg := Message{
+		From:        "Sender <sender@example.com>",
+		Subject:     "Hello",
+		ContentType: ContentTypeHTML,
+		Body:        []byte("<p>Hello</p>"),
+	}
+	msg.Subscriber.Email = "to@example.com"
+	msg.Subscriber.Name = "Subscriber"
+	msg.Subscriber.Attribs = map[string]interface{}{
+		"phone":            "+15551234567",
+		"telegram_chat_id": "12345",
+		"pushover_key":     "user-key",
+		"matrix_room_id":   "!room:example.com",
+		"fcm_token":        "device-token",
+	}
+	return msg
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for v, want := range map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-5":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Jan 2024 11:59:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestThrottledError(t *testing.T) {
+	var err error = fmt.Errorf("sending: %w", newThrottledError(http.Header{"Retry-After": {"3"}}, errors.New("slow down")))
+	if !errors.Is(err, ErrThrottled) {
+		t.Error("ThrottledError doesn't match ErrThrottled")
+	}
+	var te *ThrottledError
+	if !errors.As(err, &te) || te.RetryAfter != 3*time.Second {
+		t.Errorf("got %v", err)
+	}
+	if got := te.Error(); got != "throttled: slow down" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCheckThrottled(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok"))}
+	if err := checkThrottled(resp, "test"); err != nil {
+		t.Fatalf("got %v for a 200", err)
+	}
+
+	resp = &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"9"}},
+		Body:       io.NopCloser(strings.NewReader(" <html>Too many requests</html>\n")),
+	}
+	err := checkThrottled(resp, "test")
+	var te *ThrottledError
+	if !errors.As(err, &te) || te.RetryAfter != 9*time.Second {
+		t.Fatalf("got %v", err)
+	}
+	if got := err.Error(); got != "throttled: rate limited by test: <html>Too many requests</html>" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// TestHTTPMessengersThrottled checks that every HTTP messenger maps a 429
+// response, whatever its body, to a ThrottledError.
+func TestHTTPMessengersThrottled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("rate limit exceeded"))
+	}))
+	defer srv.Close()
+
+	for name, cfg := range map[string]string{
+		"brevo":       `{"api_key": "k", "api_url": %q}`,
+		"discord":     `{"webhook_url": %q}`,
+		"mailgun":     `{"domain": "example.com", "api_key": "k", "api_url": %q}`,
+		"mailjet":     `{"api_key": "k", "api_secret": "s", "api_url": %q}`,
+		"matrix":      `{"homeserver_url": %q, "access_token": "t"}`,
+		"messagebird": `{"access_key": "k", "originator": "Sender", "api_url": %q}`,
+		"postmark":    `{"server_token": "t", "api_url": %q}`,
+		"pushover":    `{"app_token": "t", "api_url": %q}`,
+		"resend":      `{"api_key": "k", "api_url": %q}`,
+		"sendgrid":    `{"api_key": "k", "api_url": %q}`,
+		"slack":       `{"webhook_url": %q}`,
+		"sparkpost":   `{"api_key": "k", "api_url": %q}`,
+		"teams":       `{"webhook_url": %q}`,
+		"telegram":    `{"bot_token": "t", "api_url": %q}`,
+		"vonage":      `{"api_key": "k", "api_secret": "s", "from": "Sender", "api_url": %q}`,
+		"webhook":     `{"url": %q}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := NewRegistry().New(name, []byte(fmt.Sprintf(cfg, srv.URL)), onelog.New(io.Discard, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			_, err = m.Push(context.Background(), testMessage())
+			var te *ThrottledError
+			if !errors.As(err, &te) {
+				t.Fatalf("got %v, want a ThrottledError", err)
+			}
+			if te.RetryAfter != 7*time.Second {
+				t.Errorf("got RetryAfter %v", te.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connection is only watched for the client going away once
+		// the body has been read.
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	m, err := NewWebhook([]byte(fmt.Sprintf(`{"url": %q, "timeout": "50ms"}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	start := time.Now()
+	if _, err := m.Push(context.Background(), testMessage()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("request took %v with a 50ms timeout", d)
+	}
+}
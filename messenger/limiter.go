@@ -0,0 +1,39 @@
+package messenger
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// LimitedMessenger wraps a Messenger and caps its concurrent pushes with a
+// semaphore that may be shared with other messengers.
+type LimitedMessenger struct {
+	Messenger
+	sem *semaphore.Weighted
+}
+
+// NewLimiter returns a function that wraps messengers so that there are at
+// most max pushes in flight across all of them, eg: a single cap on
+// provider calls for SES and Pinpoint running on the same host.
+func NewLimiter(max int) func(Messenger) *LimitedMessenger {
+	if max < 1 {
+		max = 1
+	}
+
+	sem := semaphore.NewWeighted(int64(max))
+	return func(m Messenger) *LimitedMessenger {
+		return &LimitedMessenger{Messenger: m, sem: sem}
+	}
+}
+
+// Push waits for a free slot, or for ctx to be done, and pushes the
+// message through the underlying messenger.
+func (l *LimitedMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	if err := l.sem.Acquire(ctx, 1); err != nil {
+		return "", err
+	}
+	defer l.sem.Release(1)
+
+	return l.Messenger.Push(ctx, msg)
+}
@@ -0,0 +1,81 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	var active, peak atomic.Int32
+	push := func(ctx context.Context, msg Message) (string, error) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		active.Add(-1)
+		return "id", nil
+	}
+
+	// The cap is shared by every messenger wrapped by the limiter.
+	limit := NewLimiter(2)
+	msgrs := []*LimitedMessenger{
+		limit(&fakeMessenger{push: push}),
+		limit(&fakeMessenger{push: push}),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(m *LimitedMessenger) {
+			defer wg.Done()
+			if _, err := m.Push(context.Background(), Message{}); err != nil {
+				t.Error(err)
+			}
+		}(msgrs[i%2])
+	}
+	wg.Wait()
+
+	if n := peak.Load(); n != 2 {
+		t.Errorf("got %d concurrent sends, want 2", n)
+	}
+}
+
+func TestLimiterContext(t *testing.T) {
+	release := make(chan struct{})
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		<-release
+		return "id", nil
+	}}
+	l := NewLimiter(0)(f)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = l.Push(context.Background(), Message{})
+	}()
+	for f.pushes() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A max below 1 still allows one push, and waiting for the slot ends
+	// with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Push(ctx, Message{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if n := f.pushes(); n != 1 {
+		t.Errorf("got %d sends, want 1", n)
+	}
+
+	close(release)
+	<-done
+}
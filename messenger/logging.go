@@ -0,0 +1,141 @@
+package messenger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/francoispqt/onelog"
+)
+
+// logLevels maps the log_level config values to the onelog levels they
+// enable. Errors are always logged, so "off" only silences the others.
+var logLevels = map[string]uint8{
+	"debug": onelog.DEBUG | onelog.INFO | onelog.WARN,
+	"info":  onelog.INFO | onelog.WARN,
+	"warn":  onelog.WARN,
+	"error": 0,
+	"off":   0,
+}
+
+// nopLogger has no levels enabled, so its entries are no-ops.
+var nopLogger = onelog.New(io.Discard, 0)
+
+// logCfg is the logging config shared by the messengers, embedded in their
+// configs.
+type logCfg struct {
+	// Log is the legacy switch for logging sent messages. When LogLevel
+	// isn't set, it's equivalent to "info" and its absence to "off".
+	Log bool `json:"log"`
+
+	// LogLevel is one of "debug", "info", "warn", "error" or "off". Debug
+	// entries are only written if the app's log_level is also "debug".
+	LogLevel string `json:"log_level"`
+
+	// RedactPII masks email addresses and phone numbers in log entries.
+	// Message IDs are left as is for tracing.
+	RedactPII bool `json:"redact_pii"`
+}
+
+// levelLogger filters a messenger's log entries by its configured level
+// before handing them to the app's logger.
+type levelLogger struct {
+	l      *onelog.Logger
+	levels uint8
+	redact bool
+}
+
+// newLevelLogger creates a levelLogger writing to l at the level in c.
+func newLevelLogger(l *onelog.Logger, c logCfg) (*levelLogger, error) {
+	level := strings.ToLower(c.LogLevel)
+	if level == "" {
+		level = "off"
+		if c.Log {
+			level = "info"
+		}
+	}
+
+	levels, ok := logLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("invalid log_level: %s", c.LogLevel)
+	}
+	return &levelLogger{l: l, levels: levels | onelog.ERROR, redact: c.RedactPII}, nil
+}
+
+// enabled reports whether entries of the given level are written, for
+// skipping work only needed for logging.
+func (l *levelLogger) enabled(level uint8) bool {
+	return l.l != nil && l.levels&level != 0
+}
+
+func (l *levelLogger) logger(level uint8) *onelog.Logger {
+	if !l.enabled(level) {
+		return nopLogger
+	}
+	return l.l
+}
+
+// DebugWith returns a ChainEntry with DEBUG level.
+func (l *levelLogger) DebugWith(msg string) onelog.ChainEntry {
+	return l.logger(onelog.DEBUG).DebugWith(msg)
+}
+
+// InfoWith returns a ChainEntry with INFO level.
+func (l *levelLogger) InfoWith(msg string) onelog.ChainEntry {
+	return l.logger(onelog.INFO).InfoWith(msg)
+}
+
+// WarnWith returns a ChainEntry with WARN level.
+func (l *levelLogger) WarnWith(msg string) onelog.ChainEntry {
+	return l.logger(onelog.WARN).WarnWith(msg)
+}
+
+// ErrorWith returns a ChainEntry with ERROR level.
+func (l *levelLogger) ErrorWith(msg string) onelog.ChainEntry {
+	return l.logger(onelog.ERROR).ErrorWith(msg)
+}
+
+// email returns the address for logging, masked if redaction is on.
+func (l *levelLogger) email(addr string) string {
+	if !l.redact {
+		return addr
+	}
+	return maskEmail(addr)
+}
+
+// phone returns the number for logging, masked if redaction is on.
+func (l *levelLogger) phone(num string) string {
+	if !l.redact {
+		return num
+	}
+	return maskPhone(num)
+}
+
+// maskEmail keeps the first character of the local part and the domain of
+// an address, eg: "a***@example.com".
+func maskEmail(addr string) string {
+	i := strings.LastIndexByte(addr, '@')
+	if i < 1 {
+		return "***"
+	}
+	_, n := utf8.DecodeRuneInString(addr)
+	return addr[:n] + "***" + addr[i:]
+}
+
+// maskPhone keeps the last four digits of a number, eg: "+*******0123".
+func maskPhone(num string) string {
+	const keep = 4
+
+	b := []byte(num)
+	digits := 0
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < '0' || b[i] > '9' {
+			continue
+		}
+		if digits++; digits > keep {
+			b[i] = '*'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,110 @@
+package messenger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestLevelLogger(t *testing.T) {
+	all := onelog.DEBUG | onelog.INFO | onelog.WARN | onelog.ERROR
+
+	for _, tc := range []struct {
+		name string
+		cfg  logCfg
+		want string
+	}{
+		{"default", logCfg{}, "error"},
+		{"legacy log", logCfg{Log: true}, "info warn error"},
+		{"level overrides log", logCfg{Log: true, LogLevel: "warn"}, "warn error"},
+		{"debug", logCfg{LogLevel: "DEBUG"}, "debug info warn error"},
+		{"info", logCfg{LogLevel: "info"}, "info warn error"},
+		{"error", logCfg{LogLevel: "error"}, "error"},
+		{"off", logCfg{LogLevel: "off"}, "error"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l, err := newLevelLogger(onelog.New(&buf, all), tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l.DebugWith("debug").Write()
+			l.InfoWith("info").Write()
+			l.WarnWith("warn").Write()
+			l.ErrorWith("error").Write()
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				for _, level := range []string{"debug", "info", "warn", "error"} {
+					if strings.Contains(line, `"message":"`+level+`"`) {
+						got = append(got, level)
+					}
+				}
+			}
+			if strings.Join(got, " ") != tc.want {
+				t.Errorf("got %q, want %q", strings.Join(got, " "), tc.want)
+			}
+		})
+	}
+}
+
+func TestLevelLoggerAppLevel(t *testing.T) {
+	// Debug entries are only written if the app's logger has them enabled.
+	var buf bytes.Buffer
+	l, err := newLevelLogger(onelog.New(&buf, onelog.INFO|onelog.WARN|onelog.ERROR), logCfg{LogLevel: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.DebugWith("debug").Write()
+	if buf.Len() != 0 {
+		t.Errorf("debug entry written: %s", buf.String())
+	}
+}
+
+func TestNewLevelLoggerInvalid(t *testing.T) {
+	if _, err := newLevelLogger(onelog.New(nil, 0), logCfg{LogLevel: "verbose"}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestRedactPII(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLevelLogger(onelog.New(&buf, onelog.INFO), logCfg{LogLevel: "info", RedactPII: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.InfoWith("sent").String("email", l.email("alice@example.com")).String("phone", l.phone("+15551230123")).Write()
+
+	out := buf.String()
+	if strings.Contains(out, "alice") || strings.Contains(out, "555123") {
+		t.Errorf("PII not redacted: %s", out)
+	}
+	if !strings.Contains(out, "a***@example.com") || !strings.Contains(out, "+*******0123") {
+		t.Errorf("unexpected masks: %s", out)
+	}
+}
+
+func TestMask(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice@example.com": "a***@example.com",
+		"élan@example.com":  "é***@example.com",
+		"@example.com":      "***",
+		"not-an-email":      "***",
+	} {
+		if got := maskEmail(in); got != want {
+			t.Errorf("maskEmail(%q) = %q, want %q", in, got, want)
+		}
+	}
+	for in, want := range map[string]string{
+		"+15551230123":    "+*******0123",
+		"+1 555 123 0123": "+* *** *** 0123",
+		"123":             "123",
+	} {
+		if got := maskPhone(in); got != want {
+			t.Errorf("maskPhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+var mailgunAPIURLs = map[string]string{
+	"us": "https://api.mailgun.net",
+	"eu": "https://api.eu.mailgun.net",
+}
+
+type mailgunCfg struct {
+	Domain string `json:"domain"`
+	APIKey string `json:"api_key"`
+
+	// Region is either "us" (default) or "eu". APIURL, if set, overrides
+	// the regional base URL.
+	Region string `json:"region"`
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type mailgunMessenger struct {
+	cfg    mailgunCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+func (m mailgunMessenger) Name() string {
+	return "mailgun"
+}
+
+// Push sends the email through the Mailgun messages API.
+func (m mailgunMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	m.logger.DebugWith("sending message").String("email", m.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	files, err := fetchAttachments(ctx, m.cfg.httpClientCfg, msg.Attachments)
+	if err != nil {
+		return "", err
+	}
+	msg.Attachments = files
+
+	var (
+		buf = &bytes.Buffer{}
+		w   = multipart.NewWriter(buf)
+	)
+
+	fields := [][2]string{
+		{"from", messageFrom(msg)},
+		{"to", msg.Subscriber.Email},
+		{"subject", msg.Subject},
+	}
+	if msg.ContentType == ContentTypePlain {
+		fields = append(fields, [2]string{"text", string(msg.Body)})
+	} else {
+		fields = append(fields, [2]string{"html", string(msg.Body)})
+	}
+	for _, a := range msg.Cc {
+		fields = append(fields, [2]string{"cc", a})
+	}
+	for _, a := range msg.Bcc {
+		fields = append(fields, [2]string{"bcc", a})
+	}
+	if len(msg.ReplyTo) > 0 {
+		fields = append(fields, [2]string{"h:Reply-To", strings.Join(msg.ReplyTo, ", ")})
+	}
+	for k, v := range msg.Headers {
+		for _, val := range v {
+			fields = append(fields, [2]string{"h:" + k, val})
+		}
+	}
+	for _, f := range fields {
+		if err := w.WriteField(f[0], f[1]); err != nil {
+			return "", err
+		}
+	}
+
+	for _, a := range msg.Attachments {
+		field := "attachment"
+		if a.ContentID != "" {
+			field = "inline"
+		}
+
+		fw, err := w.CreateFormFile(field, a.Name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := fw.Write(a.Content); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf("%s/v3/%s/messages", m.cfg.APIURL, m.cfg.Domain)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.SetBasicAuth("api", m.cfg.APIKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "mailgun"); err != nil {
+		return "", err
+	}
+
+	var out struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("error decoding mailgun response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mailgun returned status %d: %s", resp.StatusCode, out.Message)
+	}
+
+	m.logger.InfoWith("successfully sent email").String("email", m.logger.email(msg.Subscriber.Email)).String("message_id", out.ID).Write()
+
+	return out.ID, nil
+}
+
+func (m mailgunMessenger) Flush() error {
+	return nil
+}
+
+func (m mailgunMessenger) Close() error {
+	m.client.CloseIdleConnections()
+	return nil
+}
+
+// NewMailgun creates new instance of mailgun
+func NewMailgun(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c mailgunCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Domain == "" {
+		return nil, fmt.Errorf("invalid domain")
+	}
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("invalid api_key")
+	}
+	if c.APIURL == "" {
+		if c.Region == "" {
+			c.Region = "us"
+		}
+		u, ok := mailgunAPIURLs[strings.ToLower(c.Region)]
+		if !ok {
+			return nil, fmt.Errorf("invalid region: %s", c.Region)
+		}
+		c.APIURL = u
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return mailgunMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestMailgunPush(t *testing.T) {
+	var (
+		path, user, pass string
+		form             map[string][]string
+		files            map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+		}
+		path, form = r.URL.Path, r.MultipartForm.Value
+		user, pass, _ = r.BasicAuth()
+		files = make(map[string]string)
+		for field, fhs := range r.MultipartForm.File {
+			for _, fh := range fhs {
+				files[field] = fh.Filename
+			}
+		}
+		_, _ = w.Write([]byte(`{"id": "<m-1@example.com>", "message": "Queued. Thank you."}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewMailgun([]byte(fmt.Sprintf(`{"domain": "mg.example.com", "api_key": "key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.Cc = []string{"cc@example.com"}
+	msg.ReplyTo = []string{"reply@example.com"}
+	msg.Attachments = []Attachment{{Name: "a.pdf", Content: []byte("%PDF")}, {Name: "logo.png", ContentID: "logo", Content: []byte("png")}}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "<m-1@example.com>" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/v3/mg.example.com/messages" || user != "api" || pass != "key" {
+		t.Errorf("got request to %s as %s:%s", path, user, pass)
+	}
+	for field, want := range map[string]string{
+		"from":       "Sender <sender@example.com>",
+		"to":         "to@example.com",
+		"subject":    "Hello",
+		"html":       "<p>Hello</p>",
+		"cc":         "cc@example.com",
+		"h:Reply-To": "reply@example.com",
+	} {
+		if got := form[field]; len(got) != 1 || got[0] != want {
+			t.Errorf("got %s %v, want %q", field, got, want)
+		}
+	}
+	if files["attachment"] != "a.pdf" || files["inline"] != "logo.png" {
+		t.Errorf("got files %v", files)
+	}
+}
+
+func TestMailgunPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message": "'to' parameter is not a valid address"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewMailgun([]byte(fmt.Sprintf(`{"domain": "mg.example.com", "api_key": "key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || err.Error() != "mailgun returned status 400: 'to' parameter is not a valid address" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestNewMailgunRegion(t *testing.T) {
+	for region, want := range map[string]string{"": mailgunAPIURLs["us"], "EU": mailgunAPIURLs["eu"]} {
+		m, err := NewMailgun([]byte(fmt.Sprintf(`{"domain": "mg.example.com", "api_key": "key", "region": %q}`, region)), onelog.New(io.Discard, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.(mailgunMessenger).cfg.APIURL; got != want {
+			t.Errorf("region %q: got %s, want %s", region, got, want)
+		}
+	}
+
+	if _, err := NewMailgun([]byte(`{"domain": "mg.example.com", "api_key": "key", "region": "ap"}`), onelog.New(io.Discard, 0)); err == nil {
+		t.Error("expected an error for an unknown region")
+	}
+}
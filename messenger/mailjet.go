@@ -0,0 +1,247 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/smtppool"
+)
+
+const mailjetAPIURL = "https://api.mailjet.com"
+
+type mailjetCfg struct {
+	APIKey    string `json:"api_key"`
+	APISecret string `json:"api_secret"`
+
+	// TemplateID, if set, sends messages with a Mailjet template instead
+	// of the message body. The subscriber's attributes are passed as the
+	// template's variables.
+	TemplateID       int  `json:"template_id"`
+	TemplateLanguage bool `json:"template_language"`
+
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type mailjetMessenger struct {
+	cfg    mailjetCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type mailjetAddress struct {
+	Email string `json:"Email"`
+	Name  string `json:"Name,omitempty"`
+}
+
+type mailjetAttachment struct {
+	ContentType   string `json:"ContentType"`
+	Filename      string `json:"Filename"`
+	ContentID     string `json:"ContentID,omitempty"`
+	Base64Content string `json:"Base64Content"`
+}
+
+type mailjetMessage struct {
+	From               mailjetAddress         `json:"From"`
+	To                 []mailjetAddress       `json:"To"`
+	Cc                 []mailjetAddress       `json:"Cc,omitempty"`
+	Bcc                []mailjetAddress       `json:"Bcc,omitempty"`
+	ReplyTo            *mailjetAddress        `json:"ReplyTo,omitempty"`
+	Subject            string                 `json:"Subject,omitempty"`
+	TextPart           string                 `json:"TextPart,omitempty"`
+	HTMLPart           string                 `json:"HTMLPart,omitempty"`
+	TemplateID         int                    `json:"TemplateID,omitempty"`
+	TemplateLanguage   bool                   `json:"TemplateLanguage,omitempty"`
+	Variables          map[string]interface{} `json:"Variables,omitempty"`
+	Headers            map[string]string      `json:"Headers,omitempty"`
+	Attachments        []mailjetAttachment    `json:"Attachments,omitempty"`
+	InlinedAttachments []mailjetAttachment    `json:"InlinedAttachments,omitempty"`
+}
+
+type mailjetResp struct {
+	Messages []struct {
+		Status string `json:"Status"`
+		To     []struct {
+			Email     string `json:"Email"`
+			MessageID int64  `json:"MessageID"`
+		} `json:"To"`
+		Errors []struct {
+			ErrorCode    string `json:"ErrorCode"`
+			StatusCode   int    `json:"StatusCode"`
+			ErrorMessage string `json:"ErrorMessage"`
+		} `json:"Errors"`
+	} `json:"Messages"`
+}
+
+func (m mailjetMessenger) Name() string {
+	return "mailjet"
+}
+
+// Push sends the email through the Mailjet v3.1 Send API.
+func (m mailjetMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	m.logger.DebugWith("sending message").String("email", m.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	files, err := fetchAttachments(ctx, m.cfg.httpClientCfg, msg.Attachments)
+	if err != nil {
+		return "", err
+	}
+	msg.Attachments = files
+
+	name, addr := splitAddress(messageFrom(msg))
+	e := mailjetMessage{
+		From:    mailjetAddress{Email: addr, Name: name},
+		To:      mailjetAddresses([]string{msg.Subscriber.Email}),
+		Cc:      mailjetAddresses(msg.Cc),
+		Bcc:     mailjetAddresses(msg.Bcc),
+		Subject: msg.Subject,
+	}
+	if len(msg.ReplyTo) > 0 {
+		name, addr := splitAddress(msg.ReplyTo[0])
+		e.ReplyTo = &mailjetAddress{Email: addr, Name: name}
+	}
+
+	if m.cfg.TemplateID != 0 {
+		e.TemplateID = m.cfg.TemplateID
+		e.TemplateLanguage = m.cfg.TemplateLanguage
+		e.Variables = msg.Subscriber.Attribs
+	} else if msg.ContentType == ContentTypePlain {
+		e.TextPart = string(msg.Body)
+	} else {
+		e.HTMLPart = string(msg.Body)
+		e.TextPart = string(msg.AltBody)
+	}
+
+	if len(msg.Headers) > 0 {
+		e.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			e.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	for _, a := range msg.Attachments {
+		att := mailjetAttachment{
+			ContentType:   attachmentHeader(a).Get(smtppool.HdrContentType),
+			Filename:      a.Name,
+			Base64Content: base64.StdEncoding.EncodeToString(a.Content),
+		}
+		if a.ContentID != "" {
+			att.ContentID = a.ContentID
+			e.InlinedAttachments = append(e.InlinedAttachments, att)
+			continue
+		}
+		e.Attachments = append(e.Attachments, att)
+	}
+
+	b, err := json.Marshal(map[string][]mailjetMessage{"Messages": {e}})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.APIURL+"/v3.1/send", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(m.cfg.APIKey, m.cfg.APISecret)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "mailjet"); err != nil {
+		return "", err
+	}
+
+	// Validation errors are returned per message alongside a 400.
+	var out mailjetResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding mailjet response (status %d): %v", resp.StatusCode, err)
+	}
+	if len(out.Messages) == 0 {
+		return "", fmt.Errorf("mailjet returned status %d with no messages", resp.StatusCode)
+	}
+	res := out.Messages[0]
+	if res.Status != "success" {
+		if len(res.Errors) > 0 {
+			e := res.Errors[0]
+			return "", fmt.Errorf("mailjet error %s (%d): %s", e.ErrorCode, e.StatusCode, e.ErrorMessage)
+		}
+		return "", fmt.Errorf("mailjet returned status %s", res.Status)
+	}
+	if len(res.To) == 0 {
+		return "", fmt.Errorf("mailjet returned no message id")
+	}
+
+	msgID := strconv.FormatInt(res.To[0].MessageID, 10)
+	m.logger.InfoWith("successfully sent email").String("email", m.logger.email(msg.Subscriber.Email)).String("message_id", msgID).Write()
+
+	return msgID, nil
+}
+
+func (m mailjetMessenger) Flush() error {
+	return nil
+}
+
+func (m mailjetMessenger) Close() error {
+	m.client.CloseIdleConnections()
+	return nil
+}
+
+// mailjetAddresses converts a list of RFC 5322 addresses to Mailjet's
+// address objects.
+func mailjetAddresses(addrs []string) []mailjetAddress {
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	out := make([]mailjetAddress, 0, len(addrs))
+	for _, a := range addrs {
+		name, addr := splitAddress(a)
+		out = append(out, mailjetAddress{Email: addr, Name: name})
+	}
+	return out
+}
+
+// NewMailjet creates new instance of mailjet
+func NewMailjet(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c mailjetCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("invalid api_key")
+	}
+	if c.APISecret == "" {
+		return nil, fmt.Errorf("invalid api_secret")
+	}
+	if c.APIURL == "" {
+		c.APIURL = mailjetAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return mailjetMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
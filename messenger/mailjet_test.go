@@ -0,0 +1,108 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+// newMailjetServer returns a server that accepts every message and
+// stores the last one sent in got.
+func newMailjetServer(t *testing.T, got *mailjetMessage) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ Messages []mailjetMessage }
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || len(in.Messages) != 1 {
+			t.Errorf("got %d messages: %v", len(in.Messages), err)
+			return
+		}
+		if user, pass, _ := r.BasicAuth(); r.URL.Path != "/v3.1/send" || user != "key" || pass != "secret" {
+			t.Errorf("got request to %s as %s:%s", r.URL.Path, user, pass)
+		}
+		*got = in.Messages[0]
+		_, _ = w.Write([]byte(`{"Messages": [{"Status": "success", "To": [{"Email": "to@example.com", "MessageID": 1152921504}]}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMailjetPush(t *testing.T) {
+	var got mailjetMessage
+	srv := newMailjetServer(t, &got)
+
+	m, err := NewMailjet([]byte(fmt.Sprintf(`{"api_key": "key", "api_secret": "secret", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.AltBody = []byte("Hello")
+	msg.Attachments = []Attachment{{Name: "a.pdf", Content: []byte("%PDF")}, {Name: "logo.png", ContentID: "logo", Content: []byte("png")}}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1152921504" {
+		t.Errorf("got id %q", id)
+	}
+
+	if got.From != (mailjetAddress{Email: "sender@example.com", Name: "Sender"}) || len(got.To) != 1 || got.To[0].Email != "to@example.com" {
+		t.Errorf("got from %+v to %+v", got.From, got.To)
+	}
+	if got.Subject != "Hello" || got.HTMLPart != "<p>Hello</p>" || got.TextPart != "Hello" || got.TemplateID != 0 {
+		t.Errorf("got message %+v", got)
+	}
+	if len(got.Attachments) != 1 || got.Attachments[0].Filename != "a.pdf" || got.Attachments[0].Base64Content != "JVBERg==" {
+		t.Errorf("got attachments %+v", got.Attachments)
+	}
+	if len(got.InlinedAttachments) != 1 || got.InlinedAttachments[0].ContentID != "logo" {
+		t.Errorf("got inlined attachments %+v", got.InlinedAttachments)
+	}
+}
+
+func TestMailjetPushTemplate(t *testing.T) {
+	var got mailjetMessage
+	srv := newMailjetServer(t, &got)
+
+	m, err := NewMailjet([]byte(fmt.Sprintf(`{"api_key": "key", "api_secret": "secret", "template_id": 4242, "template_language": true, "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.TemplateID != 4242 || !got.TemplateLanguage {
+		t.Errorf("got template %d with language %v", got.TemplateID, got.TemplateLanguage)
+	}
+	if got.HTMLPart != "" || got.TextPart != "" {
+		t.Errorf("body sent with a template: %+v", got)
+	}
+	if got.Variables["telegram_chat_id"] != "12345" || got.Variables["phone"] != "+15551234567" {
+		t.Errorf("got variables %v", got.Variables)
+	}
+}
+
+func TestMailjetPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"Messages": [{"Status": "error", "Errors": [{"ErrorCode": "mj-0013", "StatusCode": 400, "ErrorMessage": "\"to@\" is an invalid email address."}]}]}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewMailjet([]byte(fmt.Sprintf(`{"api_key": "key", "api_secret": "secret", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "mj-0013") {
+		t.Errorf("got %v, want the mailjet error", err)
+	}
+}
@@ -0,0 +1,167 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+const matrixFormatHTML = "org.matrix.custom.html"
+
+// reHTMLTag matches HTML tags for building the plain text fallback of HTML
+// messages.
+var reHTMLTag = regexp.MustCompile(`<[^>]*>`)
+
+type matrixCfg struct {
+	HomeserverURL string `json:"homeserver_url"`
+	AccessToken   string `json:"access_token"`
+
+	// RoomAttribute is the subscriber attribute holding the room ID.
+	// Defaults to "matrix_room_id".
+	RoomAttribute string `json:"room_attribute"`
+
+	httpClientCfg
+	logCfg
+}
+
+type matrixMessenger struct {
+	cfg    matrixCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+type matrixResp struct {
+	EventID string `json:"event_id"`
+	ErrCode string `json:"errcode"`
+	Error   string `json:"error"`
+}
+
+func (m matrixMessenger) Name() string {
+	return "matrix"
+}
+
+// Push sends the message to the subscriber's room through the Matrix
+// client-server API.
+func (m matrixMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	m.logger.DebugWith("sending message").String("email", m.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	room, ok := msg.Subscriber.Attribs[m.cfg.RoomAttribute].(string)
+	if !ok || room == "" {
+		return "", fmt.Errorf("%w: could not find subscriber room in attribute %q", ErrInvalidRecipient, m.cfg.RoomAttribute)
+	}
+
+	mm := matrixMessage{MsgType: "m.text", Body: string(msg.Body)}
+	if msg.ContentType != ContentTypePlain {
+		mm.Format = matrixFormatHTML
+		mm.FormattedBody = string(msg.Body)
+		if len(msg.AltBody) > 0 {
+			mm.Body = string(msg.AltBody)
+		} else {
+			mm.Body = htmlToText(msg.Body)
+		}
+	}
+
+	b, err := json.Marshal(mm)
+	if err != nil {
+		return "", err
+	}
+
+	// The transaction ID makes retries of the same request idempotent.
+	txn := make([]byte, 16)
+	_, _ = rand.Read(txn)
+
+	u := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.cfg.HomeserverURL, url.PathEscape(room), hex.EncodeToString(txn))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.cfg.AccessToken)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "matrix"); err != nil {
+		return "", err
+	}
+
+	var out matrixResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding matrix response (status %d): %v", resp.StatusCode, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("%w: matrix error %s: %s", ErrAuth, out.ErrCode, out.Error)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return "", fmt.Errorf("matrix error %s (status %d): %s", out.ErrCode, resp.StatusCode, out.Error)
+	}
+
+	m.logger.InfoWith("successfully sent message").String("room", room).String("message_id", out.EventID).Write()
+
+	return out.EventID, nil
+}
+
+func (m matrixMessenger) Flush() error {
+	return nil
+}
+
+func (m matrixMessenger) Close() error {
+	m.client.CloseIdleConnections()
+	return nil
+}
+
+// NewMatrix creates new instance of matrix
+func NewMatrix(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c matrixCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.HomeserverURL == "" {
+		return nil, fmt.Errorf("invalid homeserver_url")
+	}
+	if c.AccessToken == "" {
+		return nil, fmt.Errorf("invalid access_token")
+	}
+	c.HomeserverURL = strings.TrimRight(c.HomeserverURL, "/")
+	if c.RoomAttribute == "" {
+		c.RoomAttribute = "matrix_room_id"
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return matrixMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestMatrixPush(t *testing.T) {
+	var (
+		method, path, auth string
+		mm                 matrixMessage
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		mm = matrixMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&mm); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"event_id": "$YUwRidLecu:example.com"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewMatrix([]byte(fmt.Sprintf(`{"homeserver_url": %q, "access_token": "token"}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HTML bodies are sent as formatted messages with a plain text body.
+	msg := testMessage()
+	msg.Body = []byte("<p>Hello <b>world</b></p>")
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "$YUwRidLecu:example.com" {
+		t.Errorf("got id %q", id)
+	}
+	prefix := "/_matrix/client/v3/rooms/!room:example.com/send/m.room.message/"
+	if method != http.MethodPut || !strings.HasPrefix(path, prefix) || auth != "Bearer token" {
+		t.Errorf("got %s %s with Authorization %q", method, path, auth)
+	}
+	txn := strings.TrimPrefix(path, prefix)
+	if mm.MsgType != "m.text" || mm.Format != matrixFormatHTML || mm.FormattedBody != "<p>Hello <b>world</b></p>" || strings.Contains(mm.Body, "<") {
+		t.Errorf("got html message %+v", mm)
+	}
+
+	msg.ContentType = ContentTypePlain
+	msg.Body = []byte("Hello world")
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if mm.MsgType != "m.text" || mm.Body != "Hello world" || mm.Format != "" || mm.FormattedBody != "" {
+		t.Errorf("got plain message %+v", mm)
+	}
+	// Every send has its own transaction ID.
+	if strings.TrimPrefix(path, prefix) == txn {
+		t.Errorf("transaction ID %s reused", txn)
+	}
+}
+
+func TestMatrixPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"errcode": "M_UNKNOWN_TOKEN", "error": "Invalid access token passed."}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewMatrix([]byte(fmt.Sprintf(`{"homeserver_url": %q, "access_token": "token"}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); !errors.Is(err, ErrAuth) || !strings.Contains(err.Error(), "M_UNKNOWN_TOKEN") {
+		t.Errorf("got %v, want ErrAuth", err)
+	}
+}
@@ -0,0 +1,166 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+const messagebirdAPIURL = "https://rest.messagebird.com"
+
+// messagebirdErrors maps MessageBird API error codes to the package's
+// error sentinels.
+var messagebirdErrors = map[int]error{
+	2:  ErrAuth,
+	21: ErrInvalidRecipient,
+}
+
+type messagebirdCfg struct {
+	AccessKey string `json:"access_key"`
+
+	// Originator is the sender, either an alphanumeric sender ID or a number.
+	Originator string `json:"originator"`
+
+	// PhoneAttribute is the subscriber attribute holding the phone
+	// number. Defaults to "phone".
+	PhoneAttribute string `json:"phone_attribute"`
+
+	// DefaultRegion is the ISO country code used to normalize phone
+	// numbers that aren't in international format, eg: "US".
+	DefaultRegion string `json:"default_region"`
+
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type messagebirdMessenger struct {
+	cfg    messagebirdCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type messagebirdResp struct {
+	ID     string `json:"id"`
+	Errors []struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+		Parameter   string `json:"parameter"`
+	} `json:"errors"`
+}
+
+func (m messagebirdMessenger) Name() string {
+	return "messagebird"
+}
+
+// Push sends the sms through the MessageBird messages API.
+func (m messagebirdMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	m.logger.DebugWith("sending message").String("email", m.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	phone, err := subscriberPhone(msg, m.cfg.PhoneAttribute, m.cfg.DefaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"originator": m.cfg.Originator,
+		"recipients": []string{strings.TrimPrefix(phone, "+")},
+		"body":       string(msg.Body),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.APIURL+"/messages", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "AccessKey "+m.cfg.AccessKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "messagebird"); err != nil {
+		return "", err
+	}
+
+	var out messagebirdResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding messagebird response (status %d): %v", resp.StatusCode, err)
+	}
+	if len(out.Errors) > 0 {
+		errs := make([]error, 0, len(out.Errors))
+		for _, e := range out.Errors {
+			err := fmt.Errorf("messagebird error %d: %s", e.Code, e.Description)
+			if s, ok := messagebirdErrors[e.Code]; ok {
+				err = fmt.Errorf("%w: %w", s, err)
+			}
+			errs = append(errs, err)
+		}
+		return "", errors.Join(errs...)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("messagebird returned status %d", resp.StatusCode)
+	}
+
+	m.logger.InfoWith("successfully sent sms").String("phone", m.logger.phone(phone)).String("message_id", out.ID).Write()
+
+	return out.ID, nil
+}
+
+func (m messagebirdMessenger) Flush() error {
+	return nil
+}
+
+func (m messagebirdMessenger) Close() error {
+	m.client.CloseIdleConnections()
+	return nil
+}
+
+// NewMessageBird creates new instance of messagebird
+func NewMessageBird(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c messagebirdCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.AccessKey == "" {
+		return nil, fmt.Errorf("invalid access_key")
+	}
+	if c.Originator == "" {
+		return nil, fmt.Errorf("invalid originator")
+	}
+	if c.PhoneAttribute == "" {
+		c.PhoneAttribute = "phone"
+	}
+	if c.APIURL == "" {
+		c.APIURL = messagebirdAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return messagebirdMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,73 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestMessageBirdPush(t *testing.T) {
+	var (
+		path, auth string
+		payload    struct {
+			Originator string
+			Recipients []string
+			Body       string
+		}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "e8077d803532c0b5937c639b60216938", "recipients": {"totalCount": 1}}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewMessageBird([]byte(fmt.Sprintf(`{"access_key": "key", "originator": "Listmonk", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.Body = []byte("Your code is 1234")
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "e8077d803532c0b5937c639b60216938" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/messages" || auth != "AccessKey key" {
+		t.Errorf("got request to %s with Authorization %q", path, auth)
+	}
+	if payload.Originator != "Listmonk" || fmt.Sprint(payload.Recipients) != "[15551234567]" || payload.Body != "Your code is 1234" {
+		t.Errorf("got payload %+v", payload)
+	}
+}
+
+func TestMessageBirdPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"errors": [{"code": 21, "description": "recipients is invalid", "parameter": "recipients"}]}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewMessageBird([]byte(fmt.Sprintf(`{"access_key": "key", "originator": "Listmonk", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Push(context.Background(), testMessage())
+	if !errors.Is(err, ErrInvalidRecipient) || !strings.Contains(err.Error(), "recipients is invalid") {
+		t.Errorf("got %v, want ErrInvalidRecipient with the messagebird error", err)
+	}
+}
@@ -1,39 +1,289 @@
 package messenger
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/textproto"
+	"sync"
+	"time"
 
 	"github.com/knadh/listmonk/models"
 )
 
+var (
+	// ErrClosed is returned by Push when the messenger has already been closed.
+	ErrClosed = errors.New("messenger closed")
+
+	// ErrMessageTooLarge is returned by Push when the rendered message
+	// exceeds the provider's size limit.
+	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrThrottled is returned by Push when the provider rejects the
+	// message due to rate limiting.
+	ErrThrottled = errors.New("throttled")
+
+	// ErrInvalidRecipient is returned by Push when the recipient is missing
+	// or rejected by the provider.
+	ErrInvalidRecipient = errors.New("invalid recipient")
+
+	// ErrSuppressed is returned by Push when the recipient is on the
+	// provider's suppression list.
+	ErrSuppressed = errors.New("recipient suppressed")
+
+	// ErrOptedOut is returned by Push when the recipient has opted out of
+	// SMS messages, eg: by replying STOP.
+	ErrOptedOut = errors.New("recipient opted out")
+
+	// ErrAuth is returned by Push when the provider rejects the configured
+	// credentials.
+	ErrAuth = errors.New("authentication failed")
+
+	// ErrUnregistered is returned by Push when the recipient's device token
+	// is no longer valid and should be removed.
+	ErrUnregistered = errors.New("device token unregistered")
+
+	// ErrFlushTimeout is returned by Flush when the buffered messages
+	// weren't all attempted within the flush timeout.
+	ErrFlushTimeout = errors.New("flush timed out")
+)
+
 type Messenger interface {
 	Name() string
-	Push(Message) (string, error)
+	Push(context.Context, Message) (string, error)
+
+	// Flush blocks until all buffered and in-flight messages have been
+	// attempted and returns the joined errors of the ones that failed.
+	// Messengers that send synchronously have nothing to flush.
 	Flush() error
 	Close() error
 }
 
+// DetailedPusher is optionally implemented by messengers that can report
+// more about a sent message than its ID.
+type DetailedPusher interface {
+	PushDetailed(context.Context, Message) (Result, error)
+}
+
+// Result describes a sent message.
+type Result struct {
+	MessageID string `json:"message_id"`
+
+	// Provider is the name of the messenger that sent the message.
+	Provider string `json:"provider"`
+
+	// Recipients are the addresses the provider accepted the message for,
+	// when it reports them, and Accepted is their number.
+	Recipients []string `json:"recipients"`
+	Accepted   int      `json:"accepted"`
+
+	// Raw is the provider's response.
+	Raw json.RawMessage `json:"raw,omitempty"`
+
+	// Timestamp is when the provider accepted the message.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PushResult pushes the message through m and returns a Result, using
+// PushDetailed for messengers that implement DetailedPusher. For the
+// others, the Result is built from the message ID and counts the message
+// as accepted by a single recipient.
+func PushResult(ctx context.Context, m Messenger, msg Message) (Result, error) {
+	if d, ok := m.(DetailedPusher); ok {
+		return d.PushDetailed(ctx, msg)
+	}
+
+	id, err := m.Push(ctx, msg)
+	if err != nil {
+		return Result{MessageID: id, Provider: m.Name()}, err
+	}
+	return Result{MessageID: id, Provider: m.Name(), Accepted: 1, Timestamp: time.Now()}, nil
+}
+
+// HealthChecker is optionally implemented by messengers that can verify
+// that their provider is reachable with the configured credentials.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
 // Message is the message pushed to a Messenger.
 type Message struct {
-	From        string
+	From string
+
+	// To is an optional list of phone numbers that SMS messengers send to
+	// instead of the subscriber's phone.
 	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     []string
 	Subject     string
 	ContentType string
 	Body        []byte
-	AltBody     []byte
+
+	// AltBody is an optional plain text alternative to an HTML Body.
+	AltBody []byte
+
+	// AMPBody is an optional AMP for Email (text/x-amp-html) alternative to
+	// an HTML Body.
+	AMPBody string
+
 	Headers     textproto.MIMEHeader
 	Attachments []Attachment
 
+	// UnsubscribeURL and UnsubscribeMailto are rendered into the
+	// List-Unsubscribe headers of emails (RFC 2369, RFC 8058).
+	UnsubscribeURL    string
+	UnsubscribeMailto string
+
+	// Template is the name of a provider-side template to render the message
+	// with instead of Body, eg: an SES template, with TemplateData as its
+	// variables.
+	Template     string
+	TemplateData map[string]interface{}
+
+	// IdempotencyKey identifies the message for DedupeMessenger. When empty,
+	// a key is derived from the recipient, subject and body.
+	IdempotencyKey string
+
+	// Priority orders the messages queued in a PoolMessenger, higher
+	// first, eg: to send transactional messages ahead of campaigns.
+	Priority int
+
+	// Tags are provider specific key/value pairs attached to the message
+	// for reporting, eg: SES message tags.
+	Tags map[string]string
+
 	Subscriber models.Subscriber
 
 	// Campaign is generally the same instance for a large number of subscribers.
 	Campaign *models.Campaign
 }
 
+// EstimatedBytes estimates the size of the message once rendered as an
+// email without building it: the headers, the bodies and the attachments
+// with their base64 encoding overhead.
+func (m Message) EstimatedBytes() int {
+	n := len(m.Body) + len(m.AltBody) + len(m.AMPBody)
+
+	// "Name: value\r\n" for the custom and the standard headers.
+	for k, vals := range m.Headers {
+		for _, v := range vals {
+			n += len(k) + len(v) + 4
+		}
+	}
+	n += len(m.From) + len(m.Subject) + len(m.Subscriber.Email)
+	for _, addrs := range [][]string{m.Cc, m.ReplyTo} {
+		for _, a := range addrs {
+			n += len(a) + 2
+		}
+	}
+
+	// Base64 encodes 57 bytes per 76 character line plus CRLF.
+	for _, a := range m.Attachments {
+		c := len(a.Content)
+		n += base64.StdEncoding.EncodedLen(c) + (c/57+1)*2
+	}
+
+	return n
+}
+
+// AttachmentBytes returns the total size of the attachments' content.
+func (m Message) AttachmentBytes() int64 {
+	var n int64
+	for _, a := range m.Attachments {
+		n += int64(len(a.Content))
+	}
+	return n
+}
+
 // Attachment represents a file or blob attachment that can be
 // sent along with a message by a Messenger.
 type Attachment struct {
 	Name    string
 	Header  textproto.MIMEHeader
 	Content []byte
+
+	// URL, if set instead of Content, is where the HTTP messengers fetch
+	// the attachment's content from at send time.
+	URL string
+
+	// ContentID, if set, embeds the attachment inline in HTML emails so
+	// that it can be referenced from the body as "cid:<ContentID>".
+	ContentID string
+}
+
+// pending counts work in progress, eg: sends, so that Flush can wait for
+// it. Unlike a sync.WaitGroup, work may be added while another goroutine
+// is waiting.
+type pending struct {
+	mu sync.Mutex
+	n  int
+
+	// idle is closed whenever n drops to zero and replaced when it rises
+	// again.
+	idle chan struct{}
+}
+
+func newPending() *pending {
+	idle := make(chan struct{})
+	close(idle)
+	return &pending{idle: idle}
+}
+
+func (p *pending) add() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.n == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.n++
+}
+
+func (p *pending) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.n--
+	if p.n == 0 {
+		close(p.idle)
+	}
+}
+
+// wait blocks until there is no work in progress, giving up with
+// ErrFlushTimeout after d. A zero d waits indefinitely.
+func (p *pending) wait(d time.Duration) error {
+	p.mu.Lock()
+	idle := p.idle
+	p.mu.Unlock()
+
+	if d == 0 {
+		<-idle
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-idle:
+		return nil
+	case <-t.C:
+		return ErrFlushTimeout
+	}
+}
+
+// dryRunID returns a synthetic message ID, eg: "dryrun-<uuid>", for
+// messages that are rendered but not sent in the dry-run mode.
+func dryRunID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	// Set the UUID v4 version and variant bits.
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("dryrun-%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
@@ -0,0 +1,230 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+// fakeMessenger records the messages pushed to it for testing the
+// wrappers. push, if set, is called to send each message.
+type fakeMessenger struct {
+	push func(ctx context.Context, msg Message) (string, error)
+
+	mu      sync.Mutex
+	pushed  []Message
+	flushes int
+	closes  int
+}
+
+func (f *fakeMessenger) Name() string {
+	return "fake"
+}
+
+func (f *fakeMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	f.mu.Lock()
+	f.pushed = append(f.pushed, msg)
+	n := len(f.pushed)
+	f.mu.Unlock()
+
+	if f.push != nil {
+		return f.push(ctx, msg)
+	}
+	return fmt.Sprintf("id-%d", n), nil
+}
+
+func (f *fakeMessenger) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushes++
+	return nil
+}
+
+func (f *fakeMessenger) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closes++
+	return nil
+}
+
+func (f *fakeMessenger) pushes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pushed)
+}
+
+// messengerCase is a registered messenger with a config pointing it at a
+// test server that responds to its sends with resp.
+type messengerCase struct {
+	cfg    string
+	resp   string
+	wantID string
+}
+
+// newMessengerCases returns a case for every built-in messenger. {url} in
+// cfg is replaced with the test server's URL and {addr} with the port or
+// directory the messengers that don't talk HTTP use.
+func newMessengerCases(t *testing.T) map[string]messengerCase {
+	t.Helper()
+
+	const awsConn = `"region": "us-east-1", "access_key": "a", "secret_key": "s", "max_retries": 0, "endpoint": "{url}"`
+	return map[string]messengerCase{
+		"brevo":       {`{"api_key": "k", "api_url": "{url}"}`, `{"messageId": "m-1"}`, "m-1"},
+		"discord":     {`{"webhook_url": "{url}"}`, `{"id": "m-1"}`, "m-1"},
+		"fcm":         {`{"credentials": ` + strconv.Quote(fcmTestCreds(t, "{url}/token")) + `, "api_url": "{url}"}`, `{"name": "projects/project/messages/m-1"}`, "projects/project/messages/m-1"},
+		"file":        {`{"directory": "{addr}"}`, "", ""},
+		"mailgun":     {`{"domain": "example.com", "api_key": "k", "api_url": "{url}"}`, `{"id": "<m-1>", "message": "Queued"}`, "<m-1>"},
+		"mailjet":     {`{"api_key": "k", "api_secret": "s", "api_url": "{url}"}`, `{"Messages": [{"Status": "success", "To": [{"MessageID": 1}]}]}`, "1"},
+		"matrix":      {`{"homeserver_url": "{url}", "access_token": "t"}`, `{"event_id": "m-1"}`, "m-1"},
+		"messagebird": {`{"access_key": "k", "originator": "Sender", "api_url": "{url}"}`, `{"id": "m-1"}`, "m-1"},
+		"null":        {`{}`, "", ""},
+		"pinpoint":    {`{"app_id": "app", ` + awsConn + `}`, `{"ApplicationId": "app", "Result": {"+15551234567": {"DeliveryStatus": "SUCCESSFUL", "StatusCode": 200, "MessageId": "m-1"}}}`, "m-1"},
+		"postmark":    {`{"server_token": "t", "api_url": "{url}"}`, `{"ErrorCode": 0, "MessageID": "m-1"}`, "m-1"},
+		"pushover":    {`{"app_token": "t", "api_url": "{url}"}`, `{"status": 1, "request": "m-1"}`, "m-1"},
+		"resend":      {`{"api_key": "k", "api_url": "{url}"}`, `{"id": "m-1"}`, "m-1"},
+		"sendgrid":    {`{"api_key": "k", "api_url": "{url}"}`, "", "m-1"},
+		"ses":         {`{` + awsConn + `}`, `<SendRawEmailResponse><SendRawEmailResult><MessageId>m-1</MessageId></SendRawEmailResult></SendRawEmailResponse>`, "m-1"},
+		"sesv2":       {`{` + awsConn + `}`, `{"MessageId": "m-1"}`, "m-1"},
+		"slack":       {`{"webhook_url": "{url}"}`, "ok", ""},
+		"smtp":        {`{"host": "127.0.0.1", "port": {addr}}`, "", ""},
+		"sns":         {`{` + awsConn + `}`, `<PublishResponse><PublishResult><MessageId>m-1</MessageId></PublishResult></PublishResponse>`, "m-1"},
+		"sparkpost":   {`{"api_key": "k", "api_url": "{url}"}`, `{"results": {"id": "m-1"}}`, "m-1"},
+		"teams":       {`{"webhook_url": "{url}"}`, "1", ""},
+		"telegram":    {`{"bot_token": "t", "api_url": "{url}"}`, `{"ok": true, "result": {"message_id": 1}}`, "1"},
+		"twilio":      {`{"account_id": "AC1", "auth_token": "t", "sender_id": "+15550000000", "upload_path": "https://example.com"}`, `{"sid": "m-1"}`, "m-1"},
+		"vonage":      {`{"api_key": "k", "api_secret": "s", "from": "Sender", "api_url": "{url}"}`, `{"messages": [{"status": "0", "message-id": "m-1"}]}`, "m-1"},
+		"webhook":     {`{"url": "{url}"}`, `{"id": "m-1"}`, "m-1"},
+	}
+}
+
+// TestMessengers builds every registered messenger and sends a message
+// through it to a test server.
+func TestMessengers(t *testing.T) {
+	cases := newMessengerCases(t)
+
+	r := NewRegistry()
+	for name := range r.factories {
+		if _, ok := cases[name]; !ok {
+			t.Errorf("no test case for messenger %s", name)
+		}
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" {
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(`{"access_token": "token", "token_type": "Bearer", "expires_in": 3600}`))
+					return
+				}
+				w.Header().Set("X-Message-Id", "m-1")
+				_, _ = w.Write([]byte(tc.resp))
+			}))
+			defer srv.Close()
+
+			var arg string
+			switch name {
+			case "file":
+				arg = t.TempDir()
+			case "smtp":
+				arg = strconv.Itoa(newFakeSMTPServer(t).port())
+			}
+
+			cfg := strings.NewReplacer("{url}", srv.URL, "{addr}", arg).Replace(tc.cfg)
+			m, err := r.New(name, []byte(cfg), onelog.New(io.Discard, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Twilio's API URL is fixed, so its requests are sent to the
+			// test server instead.
+			if tm, ok := m.(twilioMessenger); ok {
+				redirectTwilio(tm, srv)
+			}
+
+			if got := m.Name(); got != name {
+				t.Errorf("got Name %q", got)
+			}
+			id, err := m.Push(context.Background(), testMessage())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantID != "" && id != tc.wantID {
+				t.Errorf("got message id %q, want %q", id, tc.wantID)
+			}
+			if err := m.Flush(); err != nil {
+				t.Errorf("flush: %v", err)
+			}
+			if err := m.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		})
+	}
+}
+
+func TestPending(t *testing.T) {
+	p := newPending()
+	if err := p.wait(time.Millisecond); err != nil {
+		t.Fatalf("idle wait: %v", err)
+	}
+
+	p.add()
+	if err := p.wait(10 * time.Millisecond); err != ErrFlushTimeout {
+		t.Fatalf("got %v, want ErrFlushTimeout", err)
+	}
+
+	// Work added while waiting is waited for too.
+	done := make(chan error)
+	go func() { done <- p.wait(0) }()
+	p.add()
+	p.done()
+	select {
+	case <-done:
+		t.Fatal("wait returned with work in progress")
+	case <-time.After(10 * time.Millisecond):
+	}
+	p.done()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPushResult(t *testing.T) {
+	p, _ := newTestPinpoint(t, "")
+	res, err := PushResult(context.Background(), p, pinpointTestMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MessageID != "m-1" || res.Provider != "pinpoint" || res.Accepted != 1 || len(res.Raw) == 0 || res.Timestamp.IsZero() {
+		t.Errorf("got result %+v", res)
+	}
+	if len(res.Recipients) != 1 || res.Recipients[0] != "+15551234567" {
+		t.Errorf("got recipients %v", res.Recipients)
+	}
+
+	// Messengers without PushDetailed get a Result built from Push.
+	f := &fakeMessenger{}
+	res, err = PushResult(context.Background(), f, Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MessageID != "id-1" || res.Provider != "fake" || res.Accepted != 1 || res.Timestamp.IsZero() {
+		t.Errorf("got result %+v", res)
+	}
+
+	f.push = func(context.Context, Message) (string, error) { return "", ErrThrottled }
+	res, err = PushResult(context.Background(), f, Message{})
+	if !errors.Is(err, ErrThrottled) || res.Accepted != 0 || res.Provider != "fake" {
+		t.Errorf("got %+v, %v", res, err)
+	}
+}
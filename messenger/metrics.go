@@ -0,0 +1,81 @@
+package messenger
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	statusSuccess = "success"
+	statusError   = "error"
+)
+
+// PushMetrics holds the Prometheus collectors shared by MetricsMessengers.
+// A single instance should be registered and shared across messengers as
+// the series are labelled by the messenger's name.
+type PushMetrics struct {
+	total    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	bytes    *prometheus.HistogramVec
+}
+
+// NewPushMetrics creates the push metrics and registers them with reg.
+func NewPushMetrics(reg prometheus.Registerer) (*PushMetrics, error) {
+	m := &PushMetrics{
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "messenger_push_total",
+			Help: "Number of messages pushed, by messenger and status.",
+		}, []string{"name", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "messenger_push_duration_seconds",
+			Help:    "Time taken to push a message, by messenger.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"name"}),
+		bytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "messenger_push_bytes",
+			Help:    "Estimated size of pushed messages, by messenger.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 8),
+		}, []string{"name"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.total, m.duration, m.bytes} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// MetricsMessenger wraps a Messenger and records Prometheus metrics for
+// every Push.
+type MetricsMessenger struct {
+	Messenger
+	metrics *PushMetrics
+}
+
+// NewMetricsMessenger wraps m, recording its pushes in metrics.
+func NewMetricsMessenger(m Messenger, metrics *PushMetrics) *MetricsMessenger {
+	return &MetricsMessenger{Messenger: m, metrics: metrics}
+}
+
+// Push pushes the message through the underlying messenger and records
+// its outcome, duration and size.
+func (m *MetricsMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	name := m.Messenger.Name()
+
+	start := time.Now()
+	id, err := m.Messenger.Push(ctx, msg)
+	m.metrics.duration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+	status := statusSuccess
+	if err != nil {
+		status = statusError
+	}
+	m.metrics.total.WithLabelValues(name, status).Inc()
+	m.metrics.bytes.WithLabelValues(name).Observe(float64(msg.EstimatedBytes()))
+
+	return id, err
+}
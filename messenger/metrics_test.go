@@ -0,0 +1,45 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMessenger(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := NewPushMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errSend := errors.New("send failed")
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		if msg.Subject == "fail" {
+			return "", errSend
+		}
+		return "id", nil
+	}}
+	m := NewMetricsMessenger(f, metrics)
+
+	for _, subj := range []string{"ok", "ok", "fail"} {
+		_, _ = m.Push(context.Background(), Message{Subject: subj, Body: []byte("Hello")})
+	}
+
+	for status, want := range map[string]float64{statusSuccess: 2, statusError: 1} {
+		if got := testutil.ToFloat64(metrics.total.WithLabelValues("fake", status)); got != want {
+			t.Errorf("got %v %s pushes, want %v", got, status, want)
+		}
+	}
+	if n := testutil.CollectAndCount(reg, "messenger_push_duration_seconds", "messenger_push_bytes"); n != 2 {
+		t.Errorf("got %d duration and size series, want 2", n)
+	}
+
+	// The metrics can only be registered once per registry.
+	if _, err := NewPushMetrics(reg); err == nil {
+		t.Error("expected an error registering the metrics twice")
+	}
+}
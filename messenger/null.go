@@ -0,0 +1,77 @@
+package messenger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/francoispqt/onelog"
+)
+
+type nullCfg struct {
+	// FailureRate is the fraction (0-1) of pushes that fail with
+	// ErrThrottled, eg: to exercise retries.
+	FailureRate float64 `json:"failure_rate"`
+	logCfg
+}
+
+type nullMessenger struct {
+	cfg nullCfg
+
+	logger *levelLogger
+}
+
+func (n nullMessenger) Name() string {
+	return "null"
+}
+
+// Push discards the message and returns a fake ID derived from the
+// subscriber and subject so that it's stable across pushes.
+func (n nullMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	n.logger.DebugWith("sending message").String("email", n.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	if n.cfg.FailureRate > 0 && rand.Float64() < n.cfg.FailureRate {
+		return "", fmt.Errorf("%w: injected failure", ErrThrottled)
+	}
+
+	h := sha256.Sum256([]byte(msg.Subscriber.UUID + msg.Subject))
+	id := fmt.Sprintf("null-%x", h[:8])
+
+	n.logger.InfoWith("discarded message").String("email", n.logger.email(msg.Subscriber.Email)).String("message_id", id).Write()
+
+	return id, nil
+}
+
+func (n nullMessenger) Flush() error {
+	return nil
+}
+
+func (n nullMessenger) Close() error {
+	return nil
+}
+
+// NewNull creates new instance of null
+func NewNull(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c nullCfg
+	if len(cfg) > 0 {
+		if err := json.Unmarshal(cfg, &c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return nil, fmt.Errorf("invalid failure_rate: %v", c.FailureRate)
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return nullMessenger{
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/pinpointsmsvoicev2"
+)
+
+// defaultOptOutList is the name of the account's default SMS opt-out list.
+const defaultOptOutList = "Default"
+
+// OptOutStore reports whether phone numbers have opted out of SMS
+// messages, eg: by replying STOP.
+type OptOutStore interface {
+	OptedOut(ctx context.Context, phone string) (bool, error)
+}
+
+// awsOptOutStore checks numbers against an AWS End User Messaging SMS
+// opt-out list, which Pinpoint adds numbers to when they reply STOP.
+type awsOptOutStore struct {
+	client *pinpointsmsvoicev2.PinpointSMSVoiceV2
+	list   string
+}
+
+// newAWSOptOutStore returns a store for the named opt-out list, checking
+// that the list exists so that a misnamed list isn't mistaken for one
+// without any opted out numbers.
+func newAWSOptOutStore(ctx context.Context, client *pinpointsmsvoicev2.PinpointSMSVoiceV2, list string) (awsOptOutStore, error) {
+	out, err := client.DescribeOptOutListsWithContext(ctx, &pinpointsmsvoicev2.DescribeOptOutListsInput{
+		OptOutListNames: []*string{aws.String(list)},
+	})
+	if err != nil {
+		return awsOptOutStore{}, fmt.Errorf("error checking opt_out_list %s: %w", list, wrapAWSError(err))
+	}
+	for _, l := range out.OptOutLists {
+		if aws.StringValue(l.OptOutListName) == list {
+			return awsOptOutStore{client: client, list: list}, nil
+		}
+	}
+	return awsOptOutStore{}, fmt.Errorf("invalid opt_out_list: %s not found", list)
+}
+
+// OptedOut looks up the number in the opt-out list.
+func (s awsOptOutStore) OptedOut(ctx context.Context, phone string) (bool, error) {
+	out, err := s.client.DescribeOptedOutNumbersWithContext(ctx, &pinpointsmsvoicev2.DescribeOptedOutNumbersInput{
+		OptOutListName:  aws.String(s.list),
+		OptedOutNumbers: []*string{aws.String(phone)},
+	})
+	if err != nil {
+		// Numbers that aren't on the list are reported as not found. Any
+		// other missing resource, eg: the list having been deleted, fails
+		// the check rather than letting the message through.
+		var nf *pinpointsmsvoicev2.ResourceNotFoundException
+		if errors.As(err, &nf) && aws.StringValue(nf.ResourceType) == pinpointsmsvoicev2.ResourceTypeOptedOutNumber {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking opt-out list: %w", wrapAWSError(err))
+	}
+
+	for _, n := range out.OptedOutNumbers {
+		if aws.StringValue(n.OptedOutNumber) == phone {
+			return true, nil
+		}
+	}
+	return false, nil
+}
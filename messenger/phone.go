@@ -0,0 +1,93 @@
+package messenger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// countryCodes maps ISO 3166-1 alpha-2 regions to their calling codes for
+// normalizing national phone numbers.
+var countryCodes = map[string]string{
+	"US": "1", "CA": "1", "GB": "44", "IE": "353", "IN": "91", "AU": "61",
+	"NZ": "64", "DE": "49", "FR": "33", "ES": "34", "IT": "39", "NL": "31",
+	"BE": "32", "CH": "41", "AT": "43", "SE": "46", "NO": "47", "DK": "45",
+	"FI": "358", "PL": "48", "PT": "351", "BR": "55", "MX": "52", "AR": "54",
+	"ZA": "27", "NG": "234", "KE": "254", "AE": "971", "SA": "966", "SG": "65",
+	"MY": "60", "ID": "62", "PH": "63", "TH": "66", "VN": "84", "JP": "81",
+	"KR": "82", "CN": "86", "HK": "852", "PK": "92", "BD": "880", "LK": "94",
+}
+
+// keepTrunkPrefix lists regions whose leading 0 is part of the number in
+// international format.
+var keepTrunkPrefix = map[string]bool{
+	"IT": true,
+}
+
+// normalizePhone converts a phone number in international or national
+// format, eg: "(555) 123-4567", "+44 20 7946 0958", to E.164. National
+// numbers are resolved using the given default region and rejected with
+// ErrInvalidRecipient when there is none.
+func normalizePhone(raw, region string) (string, error) {
+	s := strings.TrimSpace(raw)
+
+	intl := false
+	switch {
+	case strings.HasPrefix(s, "+"):
+		intl = true
+		s = s[1:]
+	case strings.HasPrefix(s, "00"):
+		intl = true
+		s = s[2:]
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ', r == '-', r == '.', r == '(', r == ')':
+		default:
+			return "", fmt.Errorf("%w: invalid phone number %q", ErrInvalidRecipient, raw)
+		}
+	}
+	digits := b.String()
+
+	if !intl {
+		if region == "" {
+			return "", fmt.Errorf("%w: phone number %q isn't in international format and no default_region is set", ErrInvalidRecipient, raw)
+		}
+
+		region = strings.ToUpper(region)
+		cc, ok := countryCodes[region]
+		if !ok {
+			return "", fmt.Errorf("unknown phone region %q", region)
+		}
+
+		switch {
+		// NANP numbers are often written with the country code but no "+".
+		case cc == "1" && len(digits) == 11 && digits[0] == '1':
+			digits = digits[1:]
+		case strings.HasPrefix(digits, "0") && !keepTrunkPrefix[region]:
+			digits = digits[1:]
+		}
+		digits = cc + digits
+	}
+
+	// E.164 numbers have at most 15 digits. The lower bound rules out
+	// obviously truncated numbers.
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("%w: invalid phone number %q", ErrInvalidRecipient, raw)
+	}
+
+	return "+" + digits, nil
+}
+
+// subscriberPhone returns the subscriber's phone number from the given
+// attribute, normalized to E.164.
+func subscriberPhone(msg Message, attr, region string) (string, error) {
+	phone, ok := msg.Subscriber.Attribs[attr].(string)
+	if !ok || phone == "" {
+		return "", fmt.Errorf("%w: could not find subscriber phone in attribute %q", ErrInvalidRecipient, attr)
+	}
+	return normalizePhone(phone, region)
+}
@@ -0,0 +1,71 @@
+package messenger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	for _, tc := range []struct {
+		raw, region, want string
+	}{
+		{"+44 20 7946 0958", "", "+442079460958"},
+		{"0044 20 7946 0958", "US", "+442079460958"},
+		{"(555) 123-4567", "US", "+15551234567"},
+		{"1-555-123-4567", "us", "+15551234567"},
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"06 1234 5678", "IT", "+390612345678"},
+		{"98765.43210", "IN", "+919876543210"},
+	} {
+		got, err := normalizePhone(tc.raw, tc.region)
+		if err != nil {
+			t.Errorf("normalizePhone(%q, %q): %v", tc.raw, tc.region, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("normalizePhone(%q, %q) = %q, want %q", tc.raw, tc.region, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizePhoneErrors(t *testing.T) {
+	for _, tc := range []struct {
+		raw, region string
+		invalid     bool
+	}{
+		{"5551234567", "", true},
+		{"+1 555 CALL-NOW", "", true},
+		{"+1234", "", true},
+		{"+1234567890123456", "", true},
+		{"+0123456789", "", true},
+		{"5551234567", "XX", false},
+	} {
+		_, err := normalizePhone(tc.raw, tc.region)
+		if err == nil {
+			t.Errorf("normalizePhone(%q, %q): expected an error", tc.raw, tc.region)
+			continue
+		}
+		if errors.Is(err, ErrInvalidRecipient) != tc.invalid {
+			t.Errorf("normalizePhone(%q, %q): got %v, ErrInvalidRecipient %v", tc.raw, tc.region, err, tc.invalid)
+		}
+	}
+}
+
+func TestSubscriberPhone(t *testing.T) {
+	msg := Message{}
+	msg.Subscriber.Attribs = map[string]interface{}{"mobile": "(555) 123-4567", "phone": 5551234567}
+
+	got, err := subscriberPhone(msg, "mobile", "US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "+15551234567" {
+		t.Errorf("got %q", got)
+	}
+
+	for _, attr := range []string{"phone", "missing"} {
+		if _, err := subscriberPhone(msg, attr, "US"); !errors.Is(err, ErrInvalidRecipient) {
+			t.Errorf("attribute %q: got %v, want ErrInvalidRecipient", attr, err)
+		}
+	}
+}
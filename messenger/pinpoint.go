@@ -1,120 +1,464 @@
 package messenger
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/pinpoint"
+	"github.com/aws/aws-sdk-go/service/pinpointsmsvoicev2"
 	"github.com/francoispqt/onelog"
 )
 
-var (
-	channelType = "SMS"
-)
+// deliveryStatusPending isn't part of the SDK's DeliveryStatus enum but
+// is returned by Pinpoint for messages that are queued for delivery.
+const deliveryStatusPending = "PENDING"
+
+// hdrSMSType overrides the configured message type of an SMS, eg: to send
+// a transactional OTP through a messenger configured for promotions.
+const hdrSMSType = "X-SMS-Type"
 
 type pinpointCfg struct {
-	AppID       string `json:"app_id"`
-	AccessKey   string `json:"access_key"`
-	SecretKey   string `json:"secret_key"`
-	Region      string `json:"region"`
+	awsCfg
+
+	AppID    string `json:"app_id"`
+	SenderID string `json:"sender_id"`
+
+	// MessageType is either "TRANSACTIONAL" (default) or "PROMOTIONAL".
 	MessageType string `json:"message_type"`
-	SenderID    string `json:"sender_id"`
-	Log         bool   `json:"log"`
+
+	// OriginationNumber is the number, or pool, to send from, eg: a 10DLC
+	// or toll-free number. Pinpoint picks one when it's empty.
+	OriginationNumber string `json:"origination_number"`
+
+	// ChannelType is either "SMS" (default) or "EMAIL". In the email mode,
+	// FromAddress is used as the sender.
+	ChannelType string `json:"channel_type"`
+	FromAddress string `json:"from_address"`
+
+	// PhoneAttribute is the subscriber attribute holding the phone
+	// number. Defaults to "phone".
+	PhoneAttribute string `json:"phone_attribute"`
+
+	// DefaultRegion is the ISO country code used to normalize phone
+	// numbers that aren't in international format, eg: "US".
+	DefaultRegion string `json:"default_region"`
+
+	// CheckOptOut looks up SMS recipients in OptOutList, defaulting to the
+	// account's "Default" list, before sending and skips the ones that
+	// have opted out. It's off by default as it adds a request per
+	// recipient.
+	CheckOptOut bool   `json:"check_opt_out"`
+	OptOutList  string `json:"opt_out_list"`
+
+	// DryRun builds messages and logs them instead of sending.
+	DryRun bool `json:"dry_run"`
+	logCfg
 }
 
 type pinpointMessenger struct {
-	cfg    pinpointCfg
-	client *pinpoint.Pinpoint
+	cfg       pinpointCfg
+	client    *pinpoint.Pinpoint
+	transport *http.Transport
+
+	// receipts verifies the SNS notifications that deliver receipts.
+	receipts *snsReceiver
+
+	// optOut, if set, is checked for opted out SMS recipients.
+	optOut OptOutStore
+
+	// ctx is cancelled when the messenger is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
 
-	logger *onelog.Logger
+	logger *levelLogger
 }
 
 func (p pinpointMessenger) Name() string {
 	return "pinpoint"
 }
 
-// Push sends the sms through pinpoint API.
-func (p pinpointMessenger) Push(msg Message) (string, error) {
-	phone, ok := msg.Subscriber.Attribs["phone"].(string)
-	if !ok {
-		return "", fmt.Errorf("could not find subscriber phone")
+// Push sends the sms, or email in the email channel mode, through pinpoint API.
+func (p pinpointMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	res, err := p.PushDetailed(ctx, msg)
+	return res.MessageID, err
+}
+
+// PushDetailed sends the message through pinpoint API and returns the
+// message ID along with the recipients that it was accepted for.
+func (p pinpointMessenger) PushDetailed(ctx context.Context, msg Message) (Result, error) {
+	if p.ctx.Err() != nil {
+		return Result{}, ErrClosed
+	}
+
+	var (
+		addrs []string
+		conf  *pinpoint.DirectMessageConfiguration
+		errs  []error
+		err   error
+	)
+	if p.cfg.ChannelType == pinpoint.ChannelTypeEmail {
+		addrs = []string{msg.Subscriber.Email}
+		conf = p.emailConfig(msg)
+		p.logger.DebugWith("sending message").String("email", p.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+	} else {
+		addrs, err = p.recipients(msg)
+		if err != nil {
+			return Result{}, err
+		}
+		if p.logger.enabled(onelog.DEBUG) {
+			phones := make([]string, len(addrs))
+			for i, a := range addrs {
+				phones[i] = p.logger.phone(a)
+			}
+			p.logger.DebugWith("sending message").String("phone", strings.Join(phones, ",")).Int("bytes", msg.EstimatedBytes()).Write()
+		}
+		if p.optOut != nil {
+			if addrs, errs, err = p.filterOptedOut(ctx, addrs); err != nil {
+				return Result{}, err
+			}
+			if len(addrs) == 0 {
+				return Result{}, errors.Join(errs...)
+			}
+		}
+		conf, err = p.smsConfig(msg)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	addrConf := make(map[string]*pinpoint.AddressConfiguration, len(addrs))
+	for _, a := range addrs {
+		addrConf[a] = &pinpoint.AddressConfiguration{ChannelType: &p.cfg.ChannelType}
 	}
 
-	body := string(msg.Body)
 	payload := &pinpoint.SendMessagesInput{
 		ApplicationId: &p.cfg.AppID,
 		MessageRequest: &pinpoint.MessageRequest{
-			Addresses: map[string]*pinpoint.AddressConfiguration{
-				phone: {
-					ChannelType: &channelType,
-				},
-			},
-			MessageConfiguration: &pinpoint.DirectMessageConfiguration{
-				SMSMessage: &pinpoint.SMSMessage{
-					Body:        &body,
-					MessageType: &p.cfg.MessageType,
-					SenderId:    &p.cfg.SenderID,
-				},
-			},
+			Addresses:            addrConf,
+			MessageConfiguration: conf,
 		},
 	}
 
-	out, err := p.client.SendMessages(payload)
+	if p.cfg.DryRun {
+		id := dryRunID()
+		e := p.logger.WarnWith("dry run: skipped sending message").String("message_id", id)
+		// The payload has the addresses in full.
+		if !p.cfg.RedactPII {
+			e = e.String("payload", payload.String())
+		}
+		e.Write()
+		return Result{MessageID: id, Provider: p.Name(), Timestamp: time.Now()}, errors.Join(errs...)
+	}
+
+	out, err := p.client.SendMessagesWithContext(ctx, payload)
 	if err != nil {
-		return "", err
+		if ctx.Err() != nil {
+			return Result{}, fmt.Errorf("error sending message: %w", ctx.Err())
+		}
+		return Result{}, wrapAWSError(err)
+	}
+
+	var (
+		ids      []string
+		accepted []string
+	)
+	for _, addr := range addrs {
+		result, ok := out.MessageResponse.Result[addr]
+		if !ok {
+			errs = append(errs, fmt.Errorf("error sending message to %s: no result returned", addr))
+			continue
+		}
+
+		status := aws.StringValue(result.DeliveryStatus)
+		if status != pinpoint.DeliveryStatusSuccessful && status != deliveryStatusPending {
+			errs = append(errs, fmt.Errorf("%w: error sending message to %s: %s (%d): %s", deliveryStatusError(status), addr, status,
+				aws.Int64Value(result.StatusCode), aws.StringValue(result.StatusMessage)))
+			continue
+		}
+
+		id := aws.StringValue(result.MessageId)
+		if len(addrs) > 1 {
+			id = addr + ":" + id
+		}
+		ids = append(ids, id)
+		accepted = append(accepted, addr)
+
+		if p.logger.enabled(onelog.INFO) {
+			p.logResult(msg, addr, result)
+		}
+	}
+
+	// With multiple recipients, the IDs are returned as "address:id" pairs
+	// alongside errors for the ones that failed.
+	rawOut, _ := json.Marshal(out)
+	res := Result{
+		MessageID:  strings.Join(ids, ","),
+		Provider:   p.Name(),
+		Recipients: accepted,
+		Accepted:   len(accepted),
+		Raw:        rawOut,
+		Timestamp:  time.Now(),
+	}
+	return res, errors.Join(errs...)
+}
+
+// filterOptedOut returns the numbers that haven't opted out along with an
+// ErrOptedOut error for each of the ones that have.
+func (p pinpointMessenger) filterOptedOut(ctx context.Context, phones []string) ([]string, []error, error) {
+	var (
+		ok   = make([]string, 0, len(phones))
+		errs []error
+	)
+	for _, ph := range phones {
+		out, err := p.optOut.OptedOut(ctx, ph)
+		if err != nil {
+			return nil, nil, err
+		}
+		if out {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrOptedOut, ph))
+			continue
+		}
+		ok = append(ok, ph)
+	}
+	return ok, errs, nil
+}
+
+// deliveryStatusError maps a failed Pinpoint delivery status to an error
+// sentinel.
+func deliveryStatusError(status string) error {
+	switch status {
+	case pinpoint.DeliveryStatusThrottled:
+		return ErrThrottled
+	case pinpoint.DeliveryStatusPermanentFailure, pinpoint.DeliveryStatusOptOut:
+		return ErrInvalidRecipient
+	default:
+		return errors.New("delivery failed")
+	}
+}
+
+// smsConfig returns the SMS message configuration for the message.
+func (p pinpointMessenger) smsConfig(msg Message) (*pinpoint.DirectMessageConfiguration, error) {
+	msgType := p.cfg.MessageType
+	if t := msg.Headers.Get(hdrSMSType); t != "" {
+		msgType = strings.ToUpper(t)
+		if !isPinpointMessageType(msgType) {
+			return nil, fmt.Errorf("invalid %s header: %s", hdrSMSType, t)
+		}
+	}
+
+	sms := &pinpoint.SMSMessage{
+		Body:        aws.String(string(msg.Body)),
+		MessageType: aws.String(msgType),
+		SenderId:    &p.cfg.SenderID,
+	}
+	if p.cfg.OriginationNumber != "" {
+		sms.OriginationNumber = aws.String(p.cfg.OriginationNumber)
+	}
+
+	return &pinpoint.DirectMessageConfiguration{SMSMessage: sms}, nil
+}
+
+// isPinpointMessageType reports whether t is one of Pinpoint's SMS message
+// types.
+func isPinpointMessageType(t string) bool {
+	for _, v := range pinpoint.MessageType_Values() {
+		if t == v {
+			return true
+		}
+	}
+	return false
+}
+
+// emailConfig returns the email message configuration for the message.
+func (p pinpointMessenger) emailConfig(msg Message) *pinpoint.DirectMessageConfiguration {
+	email := &pinpoint.SimpleEmail{
+		Subject: &pinpoint.SimpleEmailPart{Charset: aws.String("UTF-8"), Data: aws.String(msg.Subject)},
+	}
+	part := &pinpoint.SimpleEmailPart{Charset: aws.String("UTF-8"), Data: aws.String(string(msg.Body))}
+	if msg.ContentType == ContentTypePlain {
+		email.TextPart = part
+	} else {
+		email.HtmlPart = part
+	}
+
+	from := messageFrom(msg)
+	if from == "" {
+		from = p.cfg.FromAddress
+	}
+
+	return &pinpoint.DirectMessageConfiguration{
+		EmailMessage: &pinpoint.EmailMessage{
+			FromAddress: aws.String(from),
+			SimpleEmail: email,
+		},
+	}
+}
+
+// logResult logs a successful send to addr.
+func (p pinpointMessenger) logResult(msg Message, addr string, result *pinpoint.MessageResult) {
+	// The provider's status message may include the address.
+	res := fmt.Sprintf("%#+v", result)
+	if p.cfg.RedactPII {
+		res = aws.StringValue(result.MessageId)
+	}
+
+	if p.cfg.ChannelType == pinpoint.ChannelTypeEmail {
+		p.logger.InfoWith("successfully sent email").String("email", p.logger.email(addr)).
+			String("result", res).Write()
+		return
+	}
+
+	segments, encoding := smsSegments(string(msg.Body))
+	p.logger.InfoWith("successfully sent sms").String("phone", p.logger.phone(addr)).
+		Int("segments", segments).String("encoding", encoding).
+		String("result", res).Write()
+}
+
+// recipients returns the normalized phone numbers to send the message to.
+// msg.To, if set, takes precedence over the subscriber's phone attribute.
+func (p pinpointMessenger) recipients(msg Message) ([]string, error) {
+	if len(msg.To) == 0 {
+		phone, err := subscriberPhone(msg, p.cfg.PhoneAttribute, p.cfg.DefaultRegion)
+		if err != nil {
+			return nil, err
+		}
+		return []string{phone}, nil
 	}
 
-	if p.cfg.Log {
-		for phone, result := range out.MessageResponse.Result {
-			p.logger.InfoWith("successfully sent sms").String("phone", phone).String("result", fmt.Sprintf("%#+v", result)).Write()
+	phones := make([]string, 0, len(msg.To))
+	for _, r := range msg.To {
+		ph, err := normalizePhone(r, p.cfg.DefaultRegion)
+		if err != nil {
+			return nil, err
 		}
+		phones = append(phones, ph)
 	}
 
-	return "", nil
+	return phones, nil
+}
+
+// HealthCheck verifies that Pinpoint is reachable by fetching the
+// configured app.
+func (p pinpointMessenger) HealthCheck(ctx context.Context) error {
+	_, err := p.client.GetAppWithContext(ctx, &pinpoint.GetAppInput{ApplicationId: &p.cfg.AppID})
+	return wrapAWSError(err)
+}
+
+// HandleDeliveryReceipt parses a delivery receipt, a Pinpoint SMS event
+// delivered by an SNS HTTP subscription, for a previously sent message.
+// The notification's signature is verified first, and subscription
+// confirmations are confirmed and returned as ErrSubscriptionConfirmed.
+func (p pinpointMessenger) HandleDeliveryReceipt(ctx context.Context, raw []byte) (DeliveryStatus, error) {
+	env, err := p.receipts.receive(ctx, raw)
+	if err != nil {
+		if errors.Is(err, ErrSubscriptionConfirmed) {
+			p.logger.InfoWith("confirmed sns subscription").String("topic_arn", env.TopicArn).Write()
+		}
+		return DeliveryStatus{}, err
+	}
+
+	st, err := parseDeliveryReceipt(env)
+	if err != nil {
+		return st, err
+	}
+
+	p.logger.InfoWith("received delivery receipt").String("message_id", st.MessageID).
+		String("status", st.Status).String("provider_status", st.ProviderStatus).Write()
+	return st, nil
 }
 
 func (p pinpointMessenger) Flush() error {
 	return nil
 }
 
+// Close marks the messenger as closed and releases idle connections
+// held by the underlying HTTP transport.
 func (p pinpointMessenger) Close() error {
+	p.cancel()
+	p.transport.CloseIdleConnections()
 	return nil
 }
 
 // NewPinpoint creates new instance of pinpoint
 func NewPinpoint(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	return newPinpoint(cfg, l, nil)
+}
+
+// NewPinpointWithOptOutStore creates new instance of pinpoint that checks
+// SMS recipients against store instead of the AWS opt-out list.
+func NewPinpointWithOptOutStore(cfg []byte, l *onelog.Logger, store OptOutStore) (Messenger, error) {
+	return newPinpoint(cfg, l, store)
+}
+
+func newPinpoint(cfg []byte, l *onelog.Logger, store OptOutStore) (Messenger, error) {
 	var c pinpointCfg
 	if err := json.Unmarshal(cfg, &c); err != nil {
 		return nil, err
 	}
 
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// app_id is validated even with a custom endpoint as it's part of
+	// every SendMessages request.
 	if c.AppID == "" {
 		return nil, fmt.Errorf("invalid app_id")
 	}
+	if c.PhoneAttribute == "" {
+		c.PhoneAttribute = "phone"
+	}
+	if c.OptOutList == "" {
+		c.OptOutList = defaultOptOutList
+	}
 
-	config := &aws.Config{
-		MaxRetries: aws.Int(3),
+	c.MessageType = strings.ToUpper(c.MessageType)
+	if c.MessageType == "" {
+		c.MessageType = pinpoint.MessageTypeTransactional
 	}
-	if c.AccessKey != "" && c.SecretKey != "" {
-		config.Credentials = credentials.NewStaticCredentials(c.AccessKey, c.SecretKey, "")
+	if !isPinpointMessageType(c.MessageType) {
+		return nil, fmt.Errorf("invalid message_type: %s", c.MessageType)
 	}
-	if c.Region != "" {
-		config.Region = &c.Region
+
+	switch c.ChannelType {
+	case "":
+		c.ChannelType = pinpoint.ChannelTypeSms
+	case pinpoint.ChannelTypeSms, pinpoint.ChannelTypeEmail:
+	default:
+		return nil, fmt.Errorf("invalid channel_type: %s", c.ChannelType)
 	}
 
-	var sess = session.Must(session.NewSession(config))
-	err := checkCredentials(sess)
+	transport := newHTTPTransport()
+	sess, err := newAWSSession(c.awsCfg, transport)
 	if err != nil {
 		return nil, err
 	}
 	svc := pinpoint.New(sess)
 
+	if store == nil && c.CheckOptOut {
+		s, err := newAWSOptOutStore(context.Background(), pinpointsmsvoicev2.New(sess), c.OptOutList)
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return pinpointMessenger{
-		client: svc,
-		cfg:    c,
-		logger: l,
+		client:    svc,
+		cfg:       c,
+		transport: transport,
+		receipts:  newSNSReceiver(aws.StringValue(sess.Config.Region), transport),
+		optOut:    store,
+		ctx:       ctx,
+		cancel:    cancel,
+		logger:    logger,
 	}, nil
 }
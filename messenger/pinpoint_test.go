@@ -0,0 +1,416 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/pinpointsmsvoicev2"
+	"github.com/francoispqt/onelog"
+)
+
+func TestPinpointRecipients(t *testing.T) {
+	p := pinpointMessenger{cfg: pinpointCfg{PhoneAttribute: "mobile", DefaultRegion: "GB"}}
+
+	msg := Message{}
+	msg.Subscriber.Attribs = map[string]interface{}{"mobile": "020 7946 0958"}
+	got, err := p.recipients(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "+442079460958" {
+		t.Errorf("got %v", got)
+	}
+
+	// msg.To takes precedence over the attribute.
+	msg.To = []string{"+1 555 123 4567", "07700 900123"}
+	got, err = p.recipients(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "+15551234567,+447700900123" {
+		t.Errorf("got %v", got)
+	}
+
+	p.cfg.DefaultRegion = ""
+	if _, err := p.recipients(Message{To: []string{"07700 900123"}}); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("got %v, want ErrInvalidRecipient", err)
+	}
+	if _, err := p.recipients(Message{}); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("got %v, want ErrInvalidRecipient", err)
+	}
+}
+
+// newOptOutServer emulates the AWS SMS opt-out list API with a single list
+// named "stop" holding one number.
+func newOptOutServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	notFound := func(w http.ResponseWriter, typ string) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"__type":"ResourceNotFoundException","message":"not found","ResourceType":%q}`, typ)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			OptOutListName  string
+			OptOutListNames []string
+			OptedOutNumbers []string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "PinpointSMSVoiceV2.DescribeOptOutLists":
+			if len(in.OptOutListNames) != 1 || in.OptOutListNames[0] != "stop" {
+				notFound(w, pinpointsmsvoicev2.ResourceTypeOptOutList)
+				return
+			}
+			_, _ = w.Write([]byte(`{"OptOutLists":[{"OptOutListName":"stop"}]}`))
+		case "PinpointSMSVoiceV2.DescribeOptedOutNumbers":
+			switch {
+			case in.OptOutListName != "stop":
+				notFound(w, pinpointsmsvoicev2.ResourceTypeOptOutList)
+			case len(in.OptedOutNumbers) != 1 || in.OptedOutNumbers[0] != "+15551234567":
+				notFound(w, pinpointsmsvoicev2.ResourceTypeOptedOutNumber)
+			default:
+				_, _ = w.Write([]byte(`{"OptOutListName":"stop","OptedOutNumbers":[{"OptedOutNumber":"+15551234567"}]}`))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAWSOptOutStore(t *testing.T) {
+	srv := newOptOutServer(t)
+	cfg := func(list string) []byte {
+		return []byte(fmt.Sprintf(`{"app_id":"app","region":"us-east-1","access_key":"a","secret_key":"b","max_retries":0,"endpoint":%q,"check_opt_out":true,"opt_out_list":%q}`, srv.URL, list))
+	}
+
+	if _, err := NewPinpoint(cfg("missing"), onelog.New(io.Discard, 0)); err == nil || !strings.Contains(err.Error(), "opt_out_list") {
+		t.Fatalf("got %v, want an opt_out_list error", err)
+	}
+
+	m, err := NewPinpoint(cfg("stop"), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := m.(pinpointMessenger).optOut.(awsOptOutStore)
+
+	for phone, want := range map[string]bool{"+15551234567": true, "+15557654321": false} {
+		got, err := store.OptedOut(context.Background(), phone)
+		if err != nil {
+			t.Fatalf("%s: %v", phone, err)
+		}
+		if got != want {
+			t.Errorf("%s: got opted out %v, want %v", phone, got, want)
+		}
+	}
+
+	// A list that has gone missing since fails closed.
+	store.list = "deleted"
+	if _, err := store.OptedOut(context.Background(), "+15557654321"); err == nil {
+		t.Error("expected an error for a missing list")
+	}
+}
+
+func TestPinpointMessageType(t *testing.T) {
+	cfg := func(typ string) []byte {
+		return []byte(fmt.Sprintf(`{"app_id":"app","region":"us-east-1","access_key":"a","secret_key":"b","endpoint":"http://127.0.0.1:1","message_type":%q}`, typ))
+	}
+
+	for typ, want := range map[string]string{
+		"":              "TRANSACTIONAL",
+		"promotional":   "PROMOTIONAL",
+		"Transactional": "TRANSACTIONAL",
+	} {
+		m, err := NewPinpoint(cfg(typ), onelog.New(io.Discard, 0))
+		if err != nil {
+			t.Fatalf("%q: %v", typ, err)
+		}
+		if got := m.(pinpointMessenger).cfg.MessageType; got != want {
+			t.Errorf("%q: got %s, want %s", typ, got, want)
+		}
+	}
+
+	if _, err := NewPinpoint(cfg("marketing"), onelog.New(io.Discard, 0)); err == nil {
+		t.Error("expected an error for an invalid message_type")
+	}
+}
+
+func TestPinpointDebugLog(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := pinpointCfg{ChannelType: "SMS", MessageType: "TRANSACTIONAL", PhoneAttribute: "phone", DefaultRegion: "US", DryRun: true}
+	cfg.logCfg = logCfg{LogLevel: "debug", RedactPII: true}
+	logger, err := newLevelLogger(onelog.New(&buf, onelog.ALL), cfg.logCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pinpointMessenger{
+		cfg:    cfg,
+		logger: logger,
+		ctx:    context.Background(),
+	}
+
+	msg := Message{Body: []byte("hi")}
+	msg.Subscriber.Email = "subscriber@example.com"
+	msg.Subscriber.Attribs = map[string]interface{}{"phone": "(555) 123-4567"}
+	if _, err := p.PushDetailed(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	line := strings.SplitN(buf.String(), "\n", 2)[0]
+	if !strings.Contains(line, `"sending message"`) || !strings.Contains(line, `"phone":"`+maskPhone("+15551234567")+`"`) {
+		t.Errorf("got %s", line)
+	}
+	if strings.Contains(buf.String(), "subscriber") || strings.Contains(buf.String(), "5551234567") {
+		t.Errorf("recipient logged in full: %s", buf.String())
+	}
+}
+
+func TestPinpointEndpoint(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		_, _ = w.Write([]byte(`{"ApplicationId": "app", "Result": {"+15551234567": {"DeliveryStatus": "SUCCESSFUL", "StatusCode": 200, "MessageId": "m-1"}}}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewPinpoint([]byte(fmt.Sprintf(`{"app_id": "app", "region": "us-east-1", "access_key": "a", "secret_key": "s", "endpoint": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	msg := Message{Body: []byte("hi")}
+	msg.Subscriber.Attribs = map[string]interface{}{"phone": "+15551234567"}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "m-1" {
+		t.Errorf("got message id %q", id)
+	}
+	// No credentials check is made against the custom endpoint.
+	if strings.Join(paths, ",") != "POST /v1/apps/app/messages" {
+		t.Errorf("got requests %v", paths)
+	}
+}
+
+// fakePinpoint is a Pinpoint endpoint that accepts every message for the
+// app "app" and records the requests it receives.
+type fakePinpoint struct {
+	srv *httptest.Server
+
+	mu   sync.Mutex
+	reqs []fakePinpointRequest
+}
+
+type fakePinpointRequest struct {
+	method, path string
+	body         []byte
+}
+
+func (f *fakePinpoint) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	f.reqs = append(f.reqs, fakePinpointRequest{method: r.Method, path: r.URL.Path, body: body})
+	id := fmt.Sprintf("m-%d", len(f.reqs))
+	f.mu.Unlock()
+
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/apps/app/messages":
+		var in struct {
+			Addresses map[string]json.RawMessage
+		}
+		if err := json.Unmarshal(body, &in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		res := map[string]any{}
+		for addr := range in.Addresses {
+			res[addr] = map[string]any{"DeliveryStatus": "SUCCESSFUL", "MessageId": id, "StatusCode": 200}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ApplicationId": "app", "Result": res})
+	case "GET /v1/apps/app":
+		fmt.Fprint(w, `{"Id": "app", "Name": "listmonk"}`)
+	default:
+		w.Header().Set("X-Amzn-Errortype", "NotFoundException")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"Message": "not found"}`)
+	}
+}
+
+func (f *fakePinpoint) requests() []fakePinpointRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakePinpointRequest(nil), f.reqs...)
+}
+
+// newTestPinpoint returns a Pinpoint messenger for the app "app" sending
+// to a fakePinpoint. cfg is additional JSON config fields.
+func newTestPinpoint(t *testing.T, cfg string) (pinpointMessenger, *fakePinpoint) {
+	t.Helper()
+
+	f := &fakePinpoint{}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+
+	if cfg != "" {
+		cfg = ", " + cfg
+	}
+	m, err := NewPinpoint([]byte(fmt.Sprintf(`{"app_id": "app", "region": "us-east-1", "access_key": "a", "secret_key": "s", "max_retries": 0, "endpoint": %q%s}`, f.srv.URL, cfg)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.(pinpointMessenger), f
+}
+
+// pinpointTestMessage returns a message to a subscriber with a phone
+// number.
+func pinpointTestMessage() Message {
+	msg := Message{From: "sender@example.com", Subject: "Hello", ContentType: ContentTypePlain, Body: []byte("Hello")}
+	msg.Subscriber.Email = "to@example.com"
+	msg.Subscriber.Attribs = map[string]interface{}{"phone": "+15551234567"}
+	return msg
+}
+
+func TestPinpointDryRun(t *testing.T) {
+	for _, channel := range []string{"SMS", "EMAIL"} {
+		m, f := newTestPinpoint(t, fmt.Sprintf(`"dry_run": true, "channel_type": %q, "from_address": "sender@example.com"`, channel))
+
+		res, err := m.PushDetailed(context.Background(), pinpointTestMessage())
+		if err != nil {
+			t.Fatalf("%s: %v", channel, err)
+		}
+		if !strings.HasPrefix(res.MessageID, "dryrun-") {
+			t.Errorf("%s: got message ID %q", channel, res.MessageID)
+		}
+		if n := len(f.requests()); n != 0 {
+			t.Errorf("%s: got %d requests in dry run mode", channel, n)
+		}
+	}
+}
+
+func TestPinpointHealthCheck(t *testing.T) {
+	m, f := newTestPinpoint(t, "")
+
+	if err := m.HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := f.requests(); len(reqs) != 1 || reqs[0].method != http.MethodGet || reqs[0].path != "/v1/apps/app" {
+		t.Errorf("got requests %+v, want GET /v1/apps/app", reqs)
+	}
+
+	m.cfg.AppID = "deleted"
+	var awsErr awserr.Error
+	if err := m.HealthCheck(context.Background()); !errors.As(err, &awsErr) || awsErr.Code() != "NotFoundException" {
+		t.Errorf("got %v, want NotFoundException", err)
+	}
+}
+
+func TestPinpointOriginationNumber(t *testing.T) {
+	for _, number := range []string{"", "+18005550100"} {
+		m, f := newTestPinpoint(t, fmt.Sprintf(`"origination_number": %q`, number))
+		if _, err := m.Push(context.Background(), pinpointTestMessage()); err != nil {
+			t.Fatal(err)
+		}
+
+		var in struct {
+			MessageConfiguration struct {
+				SMSMessage map[string]any
+			}
+		}
+		if err := json.Unmarshal(f.requests()[0].body, &in); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := in.MessageConfiguration.SMSMessage["OriginationNumber"]
+		if number == "" {
+			if ok {
+				t.Errorf("got OriginationNumber %v, want it unset", got)
+			}
+		} else if got != number {
+			t.Errorf("got OriginationNumber %v, want %s", got, number)
+		}
+	}
+}
+
+func TestPinpointEmailChannel(t *testing.T) {
+	m, f := newTestPinpoint(t, `"channel_type": "EMAIL", "from_address": "default@example.com"`)
+
+	type emailRequest struct {
+		Addresses            map[string]struct{ ChannelType string }
+		MessageConfiguration struct {
+			SMSMessage   *struct{}
+			EmailMessage struct {
+				FromAddress string
+				SimpleEmail struct {
+					Subject, HtmlPart, TextPart *struct{ Data string }
+				}
+			}
+		}
+	}
+
+	html := pinpointTestMessage()
+	html.From = ""
+	html.ContentType = ContentTypeHTML
+	html.Body = []byte("<p>Hello</p>")
+
+	res, err := m.PushDetailed(context.Background(), html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Recipients) != 1 || res.Recipients[0] != "to@example.com" {
+		t.Errorf("got recipients %v", res.Recipients)
+	}
+
+	var in emailRequest
+	if err := json.Unmarshal(f.requests()[0].body, &in); err != nil {
+		t.Fatal(err)
+	}
+	if in.Addresses["to@example.com"].ChannelType != "EMAIL" || len(in.Addresses) != 1 {
+		t.Errorf("got addresses %+v", in.Addresses)
+	}
+	conf := in.MessageConfiguration
+	if conf.SMSMessage != nil {
+		t.Error("SMS message set in the email channel")
+	}
+	if conf.EmailMessage.FromAddress != "default@example.com" {
+		t.Errorf("got FromAddress %q", conf.EmailMessage.FromAddress)
+	}
+	e := conf.EmailMessage.SimpleEmail
+	if e.Subject == nil || e.Subject.Data != "Hello" || e.HtmlPart == nil || e.HtmlPart.Data != "<p>Hello</p>" || e.TextPart != nil {
+		t.Errorf("got email %+v", e)
+	}
+
+	// Plain text bodies are sent as the text part, from the message's
+	// sender.
+	if _, err := m.Push(context.Background(), pinpointTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+	in = emailRequest{}
+	if err := json.Unmarshal(f.requests()[1].body, &in); err != nil {
+		t.Fatal(err)
+	}
+	e = in.MessageConfiguration.EmailMessage.SimpleEmail
+	if e.TextPart == nil || e.TextPart.Data != "Hello" || e.HtmlPart != nil {
+		t.Errorf("got email %+v", e)
+	}
+	if in.MessageConfiguration.EmailMessage.FromAddress != "sender@example.com" {
+		t.Errorf("got FromAddress %q", in.MessageConfiguration.EmailMessage.FromAddress)
+	}
+}
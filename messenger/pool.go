@@ -0,0 +1,199 @@
+package messenger
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PoolMessenger wraps a Messenger and pushes messages asynchronously
+// through a fixed number of workers, capping the number of concurrent
+// sends to the underlying messenger. Queued messages are sent in order of
+// their Priority and, for equal priorities, in the order they were pushed.
+type PoolMessenger struct {
+	Messenger
+
+	// FlushTimeout, if set, bounds how long Flush waits for the queue to
+	// drain so that a stuck send can't hang shutdown.
+	FlushTimeout time.Duration
+
+	// slots caps the number of queued messages.
+	slots   chan struct{}
+	workers sync.WaitGroup
+	pending *pending
+
+	mu     sync.RWMutex
+	closed bool
+
+	qmu   sync.Mutex
+	cond  *sync.Cond
+	queue poolQueue
+	seq   uint64
+	done  bool
+
+	errMu sync.Mutex
+	errs  []error
+}
+
+type poolJob struct {
+	ctx context.Context
+	msg Message
+	seq uint64
+}
+
+// poolQueue is a heap of jobs ordered by priority and then by push order.
+type poolQueue []poolJob
+
+func (q poolQueue) Len() int { return len(q) }
+
+func (q poolQueue) Less(i, j int) bool {
+	if q[i].msg.Priority != q[j].msg.Priority {
+		return q[i].msg.Priority > q[j].msg.Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q poolQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *poolQueue) Push(x any) { *q = append(*q, x.(poolJob)) }
+
+func (q *poolQueue) Pop() any {
+	old := *q
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = poolJob{}
+	*q = old[:n-1]
+	return job
+}
+
+// NewPoolMessenger wraps m with a pool of the given number of workers
+// and a queue that holds up to bufSize messages.
+func NewPoolMessenger(m Messenger, workers, bufSize int) *PoolMessenger {
+	if workers < 1 {
+		workers = 1
+	}
+	if bufSize < 1 {
+		bufSize = 1
+	}
+
+	p := &PoolMessenger{
+		Messenger: m,
+		slots:     make(chan struct{}, bufSize),
+		pending:   newPending(),
+	}
+	p.cond = sync.NewCond(&p.qmu)
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+
+	return p
+}
+
+// Push enqueues the message, blocking if the queue is full. As the message
+// is sent asynchronously, the returned ID is always empty and send errors
+// are reported by Flush.
+func (p *PoolMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return "", ErrClosed
+	}
+
+	p.pending.add()
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		p.pending.done()
+		return "", ctx.Err()
+	}
+
+	// The send outlives the caller (eg: an HTTP request), so only the
+	// context's values are carried over.
+	p.qmu.Lock()
+	p.seq++
+	heap.Push(&p.queue, poolJob{ctx: context.WithoutCancel(ctx), msg: msg, seq: p.seq})
+	p.cond.Signal()
+	p.qmu.Unlock()
+
+	return "", nil
+}
+
+// Flush blocks until all queued messages have been attempted, flushes the
+// underlying messenger and returns the errors, if any, that occurred since
+// the last Flush.
+func (p *PoolMessenger) Flush() error {
+	if err := p.pending.wait(p.FlushTimeout); err != nil {
+		return err
+	}
+
+	p.errMu.Lock()
+	errs := p.errs
+	p.errs = nil
+	p.errMu.Unlock()
+
+	if err := p.Messenger.Flush(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops accepting new messages, waits for the queued and in-flight
+// sends to finish and closes the underlying messenger.
+func (p *PoolMessenger) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.qmu.Lock()
+	p.done = true
+	p.cond.Broadcast()
+	p.qmu.Unlock()
+
+	p.workers.Wait()
+	return p.Messenger.Close()
+}
+
+func (p *PoolMessenger) worker() {
+	defer p.workers.Done()
+
+	for {
+		job, ok := p.next()
+		if !ok {
+			return
+		}
+
+		if _, err := p.Messenger.Push(job.ctx, job.msg); err != nil {
+			p.errMu.Lock()
+			p.errs = append(p.errs, err)
+			p.errMu.Unlock()
+		}
+		p.pending.done()
+	}
+}
+
+// next blocks until a job is queued and returns the one with the highest
+// priority. It returns false once the pool is closed and the queue drained.
+func (p *PoolMessenger) next() (poolJob, bool) {
+	p.qmu.Lock()
+	defer p.qmu.Unlock()
+
+	for len(p.queue) == 0 && !p.done {
+		p.cond.Wait()
+	}
+	if len(p.queue) == 0 {
+		return poolJob{}, false
+	}
+
+	job := heap.Pop(&p.queue).(poolJob)
+	<-p.slots
+	return job, true
+}
@@ -0,0 +1,190 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolMessengerConcurrency(t *testing.T) {
+	var active, peak atomic.Int32
+	release := make(chan struct{})
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		active.Add(-1)
+		return "id", nil
+	}}
+	p := NewPoolMessenger(f, 2, 10)
+
+	for i := 0; i < 6; i++ {
+		if id, err := p.Push(context.Background(), Message{}); err != nil || id != "" {
+			t.Fatalf("got %q, %v", id, err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.pushes(); n != 6 {
+		t.Errorf("got %d sends, want 6", n)
+	}
+	if n := peak.Load(); n != 2 {
+		t.Errorf("got %d concurrent sends, want 2", n)
+	}
+	if f.flushes != 1 {
+		t.Errorf("underlying messenger flushed %d times", f.flushes)
+	}
+}
+
+func TestPoolMessengerFlushErrors(t *testing.T) {
+	errSend := errors.New("send failed")
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		if msg.Subject == "fail" {
+			return "", errSend
+		}
+		return "id", nil
+	}}
+	p := NewPoolMessenger(f, 1, 10)
+
+	for _, subj := range []string{"ok", "fail", "ok", "fail"} {
+		if _, err := p.Push(context.Background(), Message{Subject: subj}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := p.Flush()
+	if !errors.Is(err, errSend) {
+		t.Fatalf("got %v", err)
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 2 {
+		t.Errorf("got %d errors, want 2", n)
+	}
+
+	// The errors are only reported once.
+	if err := p.Flush(); err != nil {
+		t.Errorf("got %v on the second flush", err)
+	}
+}
+
+func TestPoolMessengerFlushTimeout(t *testing.T) {
+	release := make(chan struct{})
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		<-release
+		return "id", nil
+	}}
+	p := NewPoolMessenger(f, 1, 1)
+	p.FlushTimeout = 10 * time.Millisecond
+	defer close(release)
+
+	if _, err := p.Push(context.Background(), Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); !errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("got %v, want ErrFlushTimeout", err)
+	}
+}
+
+func TestPoolMessengerClose(t *testing.T) {
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		time.Sleep(time.Millisecond)
+		return "id", nil
+	}}
+	p := NewPoolMessenger(f, 1, 10)
+
+	for i := 0; i < 5; i++ {
+		if _, err := p.Push(context.Background(), Message{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Close sends what's queued before closing the underlying messenger.
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.pushes(); n != 5 {
+		t.Errorf("got %d sends, want 5", n)
+	}
+	if f.closes != 1 {
+		t.Errorf("underlying messenger closed %d times", f.closes)
+	}
+
+	if _, err := p.Push(context.Background(), Message{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+	if err := p.Close(); err != nil || f.closes != 1 {
+		t.Errorf("second close: %v, closed %d times", err, f.closes)
+	}
+}
+
+func TestPoolMessengerQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		<-release
+		return "id", nil
+	}}
+	p := NewPoolMessenger(f, 1, 1)
+	defer close(release)
+
+	// One message is being sent and one fills the queue.
+	for i := 0; i < 2; i++ {
+		if _, err := p.Push(context.Background(), Message{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Push(ctx, Message{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestPoolMessengerPriority(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		if msg.Subject == "first" {
+			close(started)
+			<-release
+		}
+		return "id", nil
+	}}
+	p := NewPoolMessenger(f, 1, 10)
+
+	// The worker is held on the first message while the rest are queued.
+	if _, err := p.Push(context.Background(), Message{Subject: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	for _, msg := range []Message{
+		{Subject: "low", Priority: -1},
+		{Subject: "normal-1"},
+		{Subject: "high", Priority: 5},
+		{Subject: "normal-2"},
+	} {
+		if _, err := p.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(release)
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"first", "high", "normal-1", "normal-2", "low"}
+	for i, msg := range f.pushed {
+		if msg.Subject != want[i] {
+			t.Errorf("send %d: got %q, want %q", i, msg.Subject, want[i])
+		}
+	}
+}
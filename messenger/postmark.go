@@ -0,0 +1,200 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/smtppool"
+)
+
+const postmarkAPIURL = "https://api.postmarkapp.com"
+
+// postmarkErrors maps Postmark API error codes to the package's error
+// sentinels.
+var postmarkErrors = map[int]error{
+	10:  ErrAuth,
+	406: ErrInvalidRecipient,
+}
+
+type postmarkCfg struct {
+	ServerToken   string `json:"server_token"`
+	MessageStream string `json:"message_stream"`
+	TrackOpens    bool   `json:"track_opens"`
+	APIURL        string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type postmarkMessenger struct {
+	cfg    postmarkCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type postmarkHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type postmarkAttachment struct {
+	Name        string `json:"Name"`
+	Content     string `json:"Content"`
+	ContentType string `json:"ContentType"`
+	ContentID   string `json:"ContentID,omitempty"`
+}
+
+type postmarkEmail struct {
+	From          string               `json:"From"`
+	To            string               `json:"To"`
+	Cc            string               `json:"Cc,omitempty"`
+	Bcc           string               `json:"Bcc,omitempty"`
+	Subject       string               `json:"Subject"`
+	HtmlBody      string               `json:"HtmlBody,omitempty"`
+	TextBody      string               `json:"TextBody,omitempty"`
+	ReplyTo       string               `json:"ReplyTo,omitempty"`
+	Headers       []postmarkHeader     `json:"Headers,omitempty"`
+	TrackOpens    bool                 `json:"TrackOpens"`
+	MessageStream string               `json:"MessageStream"`
+	Attachments   []postmarkAttachment `json:"Attachments,omitempty"`
+}
+
+type postmarkResp struct {
+	ErrorCode int    `json:"ErrorCode"`
+	Message   string `json:"Message"`
+	MessageID string `json:"MessageID"`
+}
+
+func (p postmarkMessenger) Name() string {
+	return "postmark"
+}
+
+// Push sends the email through the Postmark email API.
+func (p postmarkMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	p.logger.DebugWith("sending message").String("email", p.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	files, err := fetchAttachments(ctx, p.cfg.httpClientCfg, msg.Attachments)
+	if err != nil {
+		return "", err
+	}
+	msg.Attachments = files
+
+	e := postmarkEmail{
+		From:          messageFrom(msg),
+		To:            msg.Subscriber.Email,
+		Cc:            strings.Join(msg.Cc, ","),
+		Bcc:           strings.Join(msg.Bcc, ","),
+		Subject:       msg.Subject,
+		ReplyTo:       strings.Join(msg.ReplyTo, ","),
+		TrackOpens:    p.cfg.TrackOpens,
+		MessageStream: p.cfg.MessageStream,
+	}
+	if msg.ContentType == ContentTypePlain {
+		e.TextBody = string(msg.Body)
+	} else {
+		e.HtmlBody = string(msg.Body)
+	}
+	for k, v := range msg.Headers {
+		for _, val := range v {
+			e.Headers = append(e.Headers, postmarkHeader{Name: k, Value: val})
+		}
+	}
+	for _, a := range msg.Attachments {
+		att := postmarkAttachment{
+			Name:        a.Name,
+			Content:     base64.StdEncoding.EncodeToString(a.Content),
+			ContentType: attachmentHeader(a).Get(smtppool.HdrContentType),
+		}
+		if a.ContentID != "" {
+			att.ContentID = "cid:" + a.ContentID
+		}
+		e.Attachments = append(e.Attachments, att)
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.APIURL+"/email", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", p.cfg.ServerToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "postmark"); err != nil {
+		return "", err
+	}
+
+	var out postmarkResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding postmark response (status %d): %v", resp.StatusCode, err)
+	}
+	if out.ErrorCode != 0 {
+		err := fmt.Errorf("postmark error %d: %s", out.ErrorCode, out.Message)
+		if s, ok := postmarkErrors[out.ErrorCode]; ok {
+			err = fmt.Errorf("%w: %w", s, err)
+		}
+		return "", err
+	}
+
+	p.logger.InfoWith("successfully sent email").String("email", p.logger.email(msg.Subscriber.Email)).String("message_id", out.MessageID).Write()
+
+	return out.MessageID, nil
+}
+
+func (p postmarkMessenger) Flush() error {
+	return nil
+}
+
+func (p postmarkMessenger) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+// NewPostmark creates new instance of postmark
+func NewPostmark(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c postmarkCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ServerToken == "" {
+		return nil, fmt.Errorf("invalid server_token")
+	}
+	if c.MessageStream == "" {
+		c.MessageStream = "outbound"
+	}
+	if c.APIURL == "" {
+		c.APIURL = postmarkAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return postmarkMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
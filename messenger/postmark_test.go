@@ -0,0 +1,69 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestPostmarkPush(t *testing.T) {
+	var (
+		path, token string
+		email       postmarkEmail
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, token = r.URL.Path, r.Header.Get("X-Postmark-Server-Token")
+		if err := json.NewDecoder(r.Body).Decode(&email); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"ErrorCode": 0, "Message": "OK", "MessageID": "pm-1"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewPostmark([]byte(fmt.Sprintf(`{"server_token": "token", "track_opens": true, "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.Push(context.Background(), testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "pm-1" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/email" || token != "token" {
+		t.Errorf("got request to %s with token %q", path, token)
+	}
+	if email.From != "Sender <sender@example.com>" || email.To != "to@example.com" || email.HtmlBody != "<p>Hello</p>" || email.TextBody != "" {
+		t.Errorf("got email %+v", email)
+	}
+	if !email.TrackOpens || email.MessageStream != "outbound" {
+		t.Errorf("got TrackOpens %v and MessageStream %q", email.TrackOpens, email.MessageStream)
+	}
+}
+
+func TestPostmarkPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"ErrorCode": 406, "Message": "You tried to send to a recipient that has been marked as inactive."}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewPostmark([]byte(fmt.Sprintf(`{"server_token": "token", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Push(context.Background(), testMessage())
+	if !errors.Is(err, ErrInvalidRecipient) || !strings.Contains(err.Error(), "406") || !strings.Contains(err.Error(), "inactive") {
+		t.Errorf("got %v, want ErrInvalidRecipient with the postmark error", err)
+	}
+}
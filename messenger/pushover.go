@@ -0,0 +1,153 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+const (
+	pushoverAPIURL = "https://api.pushover.net"
+
+	// pushoverPriorityEmergency repeats the notification every
+	// pushoverRetry until it's acknowledged or pushoverExpire passes.
+	pushoverPriorityEmergency = 2
+	pushoverRetry             = "60"
+	pushoverExpire            = "3600"
+)
+
+type pushoverCfg struct {
+	AppToken string `json:"app_token"`
+
+	// Priority is the notification priority from -2 (lowest) to 2
+	// (emergency). Sound is one of Pushover's sound names.
+	Priority int    `json:"priority"`
+	Sound    string `json:"sound"`
+
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type pushoverMessenger struct {
+	cfg    pushoverCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type pushoverResp struct {
+	Status  int      `json:"status"`
+	Request string   `json:"request"`
+	Errors  []string `json:"errors"`
+}
+
+func (p pushoverMessenger) Name() string {
+	return "pushover"
+}
+
+// Push sends the notification through the Pushover messages API.
+func (p pushoverMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	p.logger.DebugWith("sending message").String("email", p.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	key, ok := msg.Subscriber.Attribs["pushover_key"].(string)
+	if !ok || key == "" {
+		return "", fmt.Errorf("%w: could not find subscriber pushover_key", ErrInvalidRecipient)
+	}
+
+	form := url.Values{
+		"token":   {p.cfg.AppToken},
+		"user":    {key},
+		"title":   {msg.Subject},
+		"message": {string(msg.Body)},
+	}
+	if msg.ContentType != ContentTypePlain {
+		form.Set("html", "1")
+	}
+	if p.cfg.Priority != 0 {
+		form.Set("priority", strconv.Itoa(p.cfg.Priority))
+	}
+	if p.cfg.Priority == pushoverPriorityEmergency {
+		form.Set("retry", pushoverRetry)
+		form.Set("expire", pushoverExpire)
+	}
+	if p.cfg.Sound != "" {
+		form.Set("sound", p.cfg.Sound)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.APIURL+"/1/messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "pushover"); err != nil {
+		return "", err
+	}
+
+	var out pushoverResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding pushover response (status %d): %v", resp.StatusCode, err)
+	}
+	if out.Status != 1 {
+		return "", fmt.Errorf("pushover error (status %d): %s", resp.StatusCode, strings.Join(out.Errors, "; "))
+	}
+
+	p.logger.InfoWith("successfully sent push notification").String("email", p.logger.email(msg.Subscriber.Email)).String("message_id", out.Request).Write()
+
+	return out.Request, nil
+}
+
+func (p pushoverMessenger) Flush() error {
+	return nil
+}
+
+func (p pushoverMessenger) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+// NewPushover creates new instance of pushover
+func NewPushover(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c pushoverCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.AppToken == "" {
+		return nil, fmt.Errorf("invalid app_token")
+	}
+	if c.Priority < -2 || c.Priority > pushoverPriorityEmergency {
+		return nil, fmt.Errorf("invalid priority: %d", c.Priority)
+	}
+	if c.APIURL == "" {
+		c.APIURL = pushoverAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return pushoverMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestPushoverPush(t *testing.T) {
+	var (
+		path string
+		form url.Values
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		path, form = r.URL.Path, r.PostForm
+		_, _ = w.Write([]byte(`{"status": 1, "request": "647d2300-702c-4b38-8b2f-d56326ae460b"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewPushover([]byte(fmt.Sprintf(`{"app_token": "app", "priority": 2, "sound": "siren", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.Push(context.Background(), testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "647d2300-702c-4b38-8b2f-d56326ae460b" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/1/messages.json" {
+		t.Errorf("got request to %s", path)
+	}
+	for k, want := range map[string]string{
+		"token":    "app",
+		"user":     "user-key",
+		"title":    "Hello",
+		"message":  "<p>Hello</p>",
+		"html":     "1",
+		"priority": "2",
+		"sound":    "siren",
+	} {
+		if got := form.Get(k); got != want {
+			t.Errorf("got %s %q, want %q", k, got, want)
+		}
+	}
+	// Emergency priority requires retry and expire.
+	if form.Get("retry") == "" || form.Get("expire") == "" {
+		t.Errorf("got retry %q and expire %q", form.Get("retry"), form.Get("expire"))
+	}
+}
+
+func TestPushoverPushErrors(t *testing.T) {
+	status := http.StatusTooManyRequests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "30")
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"status": 0, "errors": ["user identifier is invalid"], "request": "r-1"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewPushover([]byte(fmt.Sprintf(`{"app_token": "app", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Push(context.Background(), testMessage())
+	var te *ThrottledError
+	if !errors.Is(err, ErrThrottled) || !errors.As(err, &te) || te.RetryAfter != 30*time.Second {
+		t.Errorf("got %v, want ErrThrottled with a 30s Retry-After", err)
+	}
+
+	status = http.StatusBadRequest
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || errors.Is(err, ErrThrottled) || !strings.Contains(err.Error(), "user identifier is invalid") {
+		t.Errorf("got %v, want the pushover error", err)
+	}
+}
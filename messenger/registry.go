@@ -0,0 +1,125 @@
+package messenger
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/francoispqt/onelog"
+)
+
+// Compile time checks that the messengers implement Messenger and the
+// optional interfaces the handlers look for.
+var (
+	_ Messenger = brevoMessenger{}
+	_ Messenger = discordMessenger{}
+	_ Messenger = fcmMessenger{}
+	_ Messenger = fileMessenger{}
+	_ Messenger = mailgunMessenger{}
+	_ Messenger = mailjetMessenger{}
+	_ Messenger = matrixMessenger{}
+	_ Messenger = messagebirdMessenger{}
+	_ Messenger = nullMessenger{}
+	_ Messenger = pinpointMessenger{}
+	_ Messenger = postmarkMessenger{}
+	_ Messenger = pushoverMessenger{}
+	_ Messenger = resendMessenger{}
+	_ Messenger = sendgridMessenger{}
+	_ Messenger = sesMessenger{}
+	_ Messenger = slackMessenger{}
+	_ Messenger = smtpMessenger{}
+	_ Messenger = snsMessenger{}
+	_ Messenger = sparkpostMessenger{}
+	_ Messenger = teamsMessenger{}
+	_ Messenger = telegramMessenger{}
+	_ Messenger = twilioMessenger{}
+	_ Messenger = vonageMessenger{}
+	_ Messenger = webhookMessenger{}
+
+	_ Messenger = (*CircuitBreakerMessenger)(nil)
+	_ Messenger = (*DedupeMessenger)(nil)
+	_ Messenger = (*HookMessenger)(nil)
+	_ Messenger = (*LimitedMessenger)(nil)
+	_ Messenger = (*MetricsMessenger)(nil)
+	_ Messenger = (*PoolMessenger)(nil)
+	_ Messenger = (*RetryMessenger)(nil)
+	_ Messenger = (*TracingMessenger)(nil)
+
+	_ DetailedPusher = pinpointMessenger{}
+	_ DetailedPusher = sesMessenger{}
+
+	_ HealthChecker = pinpointMessenger{}
+	_ HealthChecker = sesMessenger{}
+	_ HealthChecker = smtpMessenger{}
+	_ HealthChecker = snsMessenger{}
+
+	_ DeliveryReporter = pinpointMessenger{}
+	_ DeliveryReporter = snsMessenger{}
+)
+
+// Factory creates a Messenger from its raw JSON config.
+type Factory func(cfg []byte, l *onelog.Logger) (Messenger, error)
+
+// Registry maps messenger names to their factories so that messengers can
+// be instantiated by name from config.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+// NewRegistry returns a Registry pre-populated with the built-in messengers.
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]Factory)}
+
+	r.factories["pinpoint"] = NewPinpoint
+	r.factories["ses"] = NewAWSSES
+	r.factories["sesv2"] = NewAWSSESv2
+	r.factories["sns"] = NewSNS
+	r.factories["twilio"] = NewTwilio
+	r.factories["smtp"] = NewSMTP
+	r.factories["webhook"] = NewWebhook
+	r.factories["telegram"] = NewTelegram
+	r.factories["slack"] = NewSlack
+	r.factories["discord"] = NewDiscord
+	r.factories["teams"] = NewTeams
+	r.factories["mailgun"] = NewMailgun
+	r.factories["sendgrid"] = NewSendGrid
+	r.factories["postmark"] = NewPostmark
+	r.factories["mailjet"] = NewMailjet
+	r.factories["brevo"] = NewBrevo
+	r.factories["resend"] = NewResend
+	r.factories["sparkpost"] = NewSparkPost
+	r.factories["vonage"] = NewVonage
+	r.factories["messagebird"] = NewMessageBird
+	r.factories["fcm"] = NewFCM
+	r.factories["pushover"] = NewPushover
+	r.factories["matrix"] = NewMatrix
+	r.factories["file"] = NewFile
+	r.factories["null"] = NewNull
+
+	return r
+}
+
+// Register adds a factory under the given name. It returns an error if
+// the name is already registered.
+func (r *Registry) Register(name string, f Factory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("messenger %s is already registered", name)
+	}
+	r.factories[name] = f
+	return nil
+}
+
+// New creates a messenger using the factory registered under name.
+func (r *Registry) New(name string, cfg []byte, l *onelog.Logger) (Messenger, error) {
+	r.mu.RLock()
+	f, ok := r.factories[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown messenger: %s", name)
+	}
+	return f(cfg, l)
+}
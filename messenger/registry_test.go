@@ -0,0 +1,58 @@
+package messenger
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	m, err := r.New("null", []byte(`{}`), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name() != "null" {
+		t.Errorf("got %s", m.Name())
+	}
+
+	if _, err := r.New("carrier-pigeon", []byte(`{}`), onelog.New(io.Discard, 0)); err == nil || !strings.Contains(err.Error(), "unknown messenger") {
+		t.Errorf("got %v", err)
+	}
+
+	// Config errors are returned by the factory.
+	if _, err := r.New("webhook", []byte(`{}`), onelog.New(io.Discard, 0)); err == nil {
+		t.Error("expected a config error")
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+
+	fake := &fakeMessenger{}
+	if err := r.Register("fake", func(cfg []byte, l *onelog.Logger) (Messenger, error) { return fake, nil }); err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.New("fake", nil, onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != fake {
+		t.Errorf("got %v", m)
+	}
+
+	// Built-in and already registered names can't be replaced.
+	for _, name := range []string{"fake", "ses"} {
+		if err := r.Register(name, NewNull); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Registries are independent.
+	if _, err := NewRegistry().New("fake", nil, onelog.New(io.Discard, 0)); err == nil {
+		t.Error("fake registered in a new registry")
+	}
+}
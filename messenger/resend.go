@@ -0,0 +1,174 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+const resendAPIURL = "https://api.resend.com"
+
+type resendCfg struct {
+	APIKey string `json:"api_key"`
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type resendMessenger struct {
+	cfg    resendCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type resendAttachment struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+type resendEmail struct {
+	From        string             `json:"from"`
+	To          []string           `json:"to"`
+	Cc          []string           `json:"cc,omitempty"`
+	Bcc         []string           `json:"bcc,omitempty"`
+	ReplyTo     []string           `json:"reply_to,omitempty"`
+	Subject     string             `json:"subject"`
+	HTML        string             `json:"html,omitempty"`
+	Text        string             `json:"text,omitempty"`
+	Headers     map[string]string  `json:"headers,omitempty"`
+	Attachments []resendAttachment `json:"attachments,omitempty"`
+}
+
+type resendResp struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (r resendMessenger) Name() string {
+	return "resend"
+}
+
+// Push sends the email through the Resend emails API.
+func (r resendMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	r.logger.DebugWith("sending message").String("email", r.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	files, err := fetchAttachments(ctx, r.cfg.httpClientCfg, msg.Attachments)
+	if err != nil {
+		return "", err
+	}
+	msg.Attachments = files
+
+	e := resendEmail{
+		From:    messageFrom(msg),
+		To:      []string{msg.Subscriber.Email},
+		Cc:      msg.Cc,
+		Bcc:     msg.Bcc,
+		ReplyTo: msg.ReplyTo,
+		Subject: msg.Subject,
+	}
+	if msg.ContentType == ContentTypePlain {
+		e.Text = string(msg.Body)
+	} else {
+		e.HTML = string(msg.Body)
+		e.Text = string(msg.AltBody)
+	}
+
+	if len(msg.Headers) > 0 {
+		e.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			e.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	for _, a := range msg.Attachments {
+		e.Attachments = append(e.Attachments, resendAttachment{
+			Filename: a.Name,
+			Content:  base64.StdEncoding.EncodeToString(a.Content),
+		})
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.APIURL+"/emails", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.cfg.APIKey)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "resend"); err != nil {
+		return "", err
+	}
+
+	var out resendResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding resend response (status %d): %v", resp.StatusCode, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnprocessableEntity:
+		return "", fmt.Errorf("resend validation error: %s", out.Message)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return "", fmt.Errorf("resend error %s (status %d): %s", out.Name, resp.StatusCode, out.Message)
+	}
+
+	r.logger.InfoWith("successfully sent email").String("email", r.logger.email(msg.Subscriber.Email)).String("message_id", out.ID).Write()
+
+	return out.ID, nil
+}
+
+func (r resendMessenger) Flush() error {
+	return nil
+}
+
+func (r resendMessenger) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+// NewResend creates new instance of resend
+func NewResend(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c resendCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("invalid api_key")
+	}
+	if c.APIURL == "" {
+		c.APIURL = resendAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return resendMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestResendPush(t *testing.T) {
+	var (
+		path, auth string
+		email      resendEmail
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&email); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"id": "49a3999c-0ce1-4ea6-ab68-afcd6dc2e794"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewResend([]byte(fmt.Sprintf(`{"api_key": "re_key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.ContentType = ContentTypePlain
+	msg.Body = []byte("Hello")
+	msg.ReplyTo = []string{"reply@example.com"}
+	msg.Attachments = []Attachment{{Name: "a.pdf", Content: []byte("%PDF")}}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "49a3999c-0ce1-4ea6-ab68-afcd6dc2e794" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/emails" || auth != "Bearer re_key" {
+		t.Errorf("got request to %s with Authorization %q", path, auth)
+	}
+	if email.From != "Sender <sender@example.com>" || fmt.Sprint(email.To, email.ReplyTo) != "[to@example.com] [reply@example.com]" {
+		t.Errorf("got email %+v", email)
+	}
+	if email.Text != "Hello" || email.HTML != "" {
+		t.Errorf("got text %q and html %q", email.Text, email.HTML)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0] != (resendAttachment{Filename: "a.pdf", Content: "JVBERg=="}) {
+		t.Errorf("got attachments %+v", email.Attachments)
+	}
+}
+
+func TestResendPushErrors(t *testing.T) {
+	status := http.StatusUnprocessableEntity
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"statusCode": 422, "name": "validation_error", "message": "Invalid ` + "`to`" + ` field."}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewResend([]byte(fmt.Sprintf(`{"api_key": "re_key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "Invalid `to` field.") {
+		t.Errorf("got %v, want the validation error", err)
+	}
+
+	status = http.StatusTooManyRequests
+	if _, err := m.Push(context.Background(), testMessage()); !errors.Is(err, ErrThrottled) {
+		t.Errorf("got %v, want ErrThrottled", err)
+	}
+}
@@ -0,0 +1,134 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// RetryPolicy configures how RetryMessenger retries failed pushes.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry which doubles on every
+	// subsequent retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is the fraction (0-1) of the delay that is randomly added to
+	// it to avoid retries from multiple senders lining up.
+	Jitter float64
+}
+
+// RetryMessenger wraps a Messenger and retries Push on transient errors
+// with exponential backoff.
+type RetryMessenger struct {
+	Messenger
+	policy RetryPolicy
+}
+
+// retryableAWSCodes are AWS error codes that indicate throttling.
+var retryableAWSCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+}
+
+// NewRetryMessenger wraps m with the given retry policy.
+func NewRetryMessenger(m Messenger, p RetryPolicy) *RetryMessenger {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+
+	return &RetryMessenger{Messenger: m, policy: p}
+}
+
+// Push pushes the message through the underlying messenger, retrying
+// retryable errors until the attempts are exhausted or ctx is done.
+func (r *RetryMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	var (
+		id  string
+		err error
+	)
+	for attempt := 1; ; attempt++ {
+		id, err = r.Messenger.Push(ctx, msg)
+		if err == nil || attempt >= r.policy.MaxAttempts || !isRetryable(err) {
+			return id, err
+		}
+
+		// Wait at least as long as the provider asked to.
+		d := r.delay(attempt)
+		var te *ThrottledError
+		if errors.As(err, &te) && te.RetryAfter > d {
+			d = te.RetryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
+
+// delay returns the backoff before the given retry attempt (1 indexed).
+func (r *RetryMessenger) delay(attempt int) time.Duration {
+	d := r.policy.BaseDelay << uint(attempt-1)
+	if d > r.policy.MaxDelay || d <= 0 {
+		d = r.policy.MaxDelay
+	}
+	if r.policy.Jitter > 0 {
+		d += time.Duration(rand.Float64() * r.policy.Jitter * float64(d))
+	}
+	return d
+}
+
+// isRetryable reports whether err is a transient error worth retrying.
+// Throttling, 5xx and connection errors are retryable while 4xx
+// (validation) errors, cancellations and other network errors are
+// permanent.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrThrottled) {
+		return true
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		if retryableAWSCodes[reqErr.Code()] {
+			return true
+		}
+		return reqErr.StatusCode() >= 500
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return retryableAWSCodes[awsErr.Code()]
+	}
+
+	return isDialError(err)
+}
+
+// isDialError reports whether err failed to reach the provider at all, so
+// the message can't have been sent. Other network errors, eg: a timeout
+// waiting for the response, may have come after the provider accepted the
+// message and retrying them could send it twice.
+func isDialError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,146 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestRetryMessengerDelay(t *testing.T) {
+	r := NewRetryMessenger(&fakeMessenger{}, RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+
+	for attempt, want := range map[int]time.Duration{
+		1:  10 * time.Millisecond,
+		2:  20 * time.Millisecond,
+		3:  40 * time.Millisecond,
+		4:  50 * time.Millisecond,
+		5:  50 * time.Millisecond,
+		70: 50 * time.Millisecond,
+	} {
+		if got := r.delay(attempt); got != want {
+			t.Errorf("attempt %d: got %v, want %v", attempt, got, want)
+		}
+	}
+
+	r.policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := r.delay(1); d < 10*time.Millisecond || d > 15*time.Millisecond {
+			t.Fatalf("got jittered delay %v", d)
+		}
+	}
+}
+
+func TestNewRetryMessengerDefaults(t *testing.T) {
+	r := NewRetryMessenger(&fakeMessenger{}, RetryPolicy{BaseDelay: time.Second})
+	if r.policy.MaxAttempts != 1 || r.policy.MaxDelay != time.Second {
+		t.Errorf("got %+v", r.policy)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	dial := &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	read := &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"throttled", fmt.Errorf("sending: %w", ErrThrottled), true},
+		{"throttled error", &ThrottledError{RetryAfter: time.Second}, true},
+		{"aws throttling", awserr.New("Throttling", "rate exceeded", nil), true},
+		{"aws 5xx", awserr.NewRequestFailure(awserr.New("InternalFailure", "", nil), 503, "id"), true},
+		{"aws 4xx", awserr.NewRequestFailure(awserr.New("MessageRejected", "", nil), 400, "id"), false},
+		{"aws throttling 4xx", awserr.NewRequestFailure(awserr.New("ThrottlingException", "", nil), 400, "id"), true},
+		{"dial", dial, true},
+		{"dns", &net.DNSError{Err: "no such host", Name: "example.com"}, true},
+		{"read", read, false},
+		{"timeout", &url.Error{Op: "Post", URL: "https://example.com", Err: context.DeadlineExceeded}, false},
+		{"canceled", context.Canceled, false},
+		{"invalid recipient", ErrInvalidRecipient, false},
+	} {
+		if got := isRetryable(tc.err); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRetryMessengerPush(t *testing.T) {
+	fails := 2
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		if fails > 0 {
+			fails--
+			return "", ErrThrottled
+		}
+		return "id", nil
+	}}
+	r := NewRetryMessenger(f, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	id, err := r.Push(context.Background(), Message{})
+	if err != nil || id != "id" {
+		t.Fatalf("got %q, %v", id, err)
+	}
+	if n := f.pushes(); n != 3 {
+		t.Errorf("got %d attempts", n)
+	}
+
+	// Attempts run out.
+	fails = 5
+	f = &fakeMessenger{push: f.push}
+	r = NewRetryMessenger(f, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+	if _, err := r.Push(context.Background(), Message{}); !errors.Is(err, ErrThrottled) {
+		t.Errorf("got %v, want ErrThrottled", err)
+	}
+	if n := f.pushes(); n != 2 {
+		t.Errorf("got %d attempts", n)
+	}
+
+	// Permanent errors aren't retried.
+	f = &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		return "", ErrInvalidRecipient
+	}}
+	r = NewRetryMessenger(f, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	if _, err := r.Push(context.Background(), Message{}); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("got %v", err)
+	}
+	if n := f.pushes(); n != 1 {
+		t.Errorf("got %d attempts", n)
+	}
+}
+
+func TestRetryMessengerRetryAfter(t *testing.T) {
+	first := true
+	f := &fakeMessenger{push: func(ctx context.Context, msg Message) (string, error) {
+		if first {
+			first = false
+			return "", &ThrottledError{RetryAfter: 50 * time.Millisecond, Err: errors.New("429")}
+		}
+		return "id", nil
+	}}
+	r := NewRetryMessenger(f, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+
+	start := time.Now()
+	if _, err := r.Push(context.Background(), Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("retried after %v, before Retry-After", d)
+	}
+}
+
+func TestRetryMessengerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &fakeMessenger{push: func(context.Context, Message) (string, error) {
+		cancel()
+		return "", ErrThrottled
+	}}
+	r := NewRetryMessenger(f, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour})
+	if _, err := r.Push(ctx, Message{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,213 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/smtppool"
+)
+
+const sendgridAPIURL = "https://api.sendgrid.com"
+
+type sendgridCfg struct {
+	APIKey string `json:"api_key"`
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type sendgridMessenger struct {
+	cfg    sendgridCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type sendgridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendgridPersonalization struct {
+	To  []sendgridAddress `json:"to"`
+	Cc  []sendgridAddress `json:"cc,omitempty"`
+	Bcc []sendgridAddress `json:"bcc,omitempty"`
+}
+
+type sendgridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendgridAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+	Disposition string `json:"disposition,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type sendgridMail struct {
+	Personalizations []sendgridPersonalization `json:"personalizations"`
+	From             sendgridAddress           `json:"from"`
+	ReplyTo          *sendgridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject"`
+	Content          []sendgridContent         `json:"content"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	Attachments      []sendgridAttachment      `json:"attachments,omitempty"`
+}
+
+func (s sendgridMessenger) Name() string {
+	return "sendgrid"
+}
+
+// Push sends the email through the SendGrid v3 mail/send API.
+func (s sendgridMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	s.logger.DebugWith("sending message").String("email", s.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	files, err := fetchAttachments(ctx, s.cfg.httpClientCfg, msg.Attachments)
+	if err != nil {
+		return "", err
+	}
+	msg.Attachments = files
+
+	p := sendgridPersonalization{
+		To:  sendgridAddresses([]string{msg.Subscriber.Email}),
+		Cc:  sendgridAddresses(msg.Cc),
+		Bcc: sendgridAddresses(msg.Bcc),
+	}
+
+	name, addr := splitAddress(messageFrom(msg))
+	m := sendgridMail{
+		Personalizations: []sendgridPersonalization{p},
+		From:             sendgridAddress{Email: addr, Name: name},
+		Subject:          msg.Subject,
+	}
+	if len(msg.ReplyTo) > 0 {
+		name, addr := splitAddress(msg.ReplyTo[0])
+		m.ReplyTo = &sendgridAddress{Email: addr, Name: name}
+	}
+
+	if msg.ContentType == ContentTypePlain {
+		m.Content = []sendgridContent{{Type: "text/plain", Value: string(msg.Body)}}
+	} else {
+		m.Content = []sendgridContent{{Type: "text/html", Value: string(msg.Body)}}
+	}
+
+	if len(msg.Headers) > 0 {
+		m.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			m.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	for _, a := range msg.Attachments {
+		att := sendgridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Content),
+			Filename:    a.Name,
+			Type:        attachmentHeader(a).Get(smtppool.HdrContentType),
+			Disposition: "attachment",
+		}
+		if a.ContentID != "" {
+			att.Disposition = "inline"
+			att.ContentID = a.ContentID
+		}
+		m.Attachments = append(m.Attachments, att)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.APIURL+"/v3/mail/send", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "sendgrid"); err != nil {
+		return "", err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return "", fmt.Errorf("%w: rejected by sendgrid", ErrMessageTooLarge)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("sendgrid returned status %d: %s", resp.StatusCode, body)
+	}
+
+	msgID := resp.Header.Get("X-Message-Id")
+	s.logger.InfoWith("successfully sent email").String("email", s.logger.email(msg.Subscriber.Email)).String("message_id", msgID).Write()
+
+	return msgID, nil
+}
+
+func (s sendgridMessenger) Flush() error {
+	return nil
+}
+
+func (s sendgridMessenger) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// sendgridAddresses converts a list of RFC 5322 addresses to SendGrid's
+// address objects.
+func sendgridAddresses(addrs []string) []sendgridAddress {
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	out := make([]sendgridAddress, 0, len(addrs))
+	for _, a := range addrs {
+		name, addr := splitAddress(a)
+		out = append(out, sendgridAddress{Email: addr, Name: name})
+	}
+	return out
+}
+
+// NewSendGrid creates new instance of sendgrid
+func NewSendGrid(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c sendgridCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("invalid api_key")
+	}
+	if c.APIURL == "" {
+		c.APIURL = sendgridAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return sendgridMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestSendGridPush(t *testing.T) {
+	var (
+		path, auth string
+		mail       sendgridMail
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&mail); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("X-Message-Id", "sg-1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	m, err := NewSendGrid([]byte(fmt.Sprintf(`{"api_key": "key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.Bcc = []string{"Audit <audit@example.com>"}
+	msg.ReplyTo = []string{"reply@example.com"}
+	msg.Attachments = []Attachment{{Name: "logo.png", ContentID: "logo", Content: []byte("png")}}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "sg-1" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/v3/mail/send" || auth != "Bearer key" {
+		t.Errorf("got request to %s with Authorization %q", path, auth)
+	}
+
+	p := mail.Personalizations[0]
+	if fmt.Sprint(p.To, p.Bcc) != "[{to@example.com }] [{audit@example.com Audit}]" {
+		t.Errorf("got personalization %+v", p)
+	}
+	if mail.From != (sendgridAddress{Email: "sender@example.com", Name: "Sender"}) || mail.ReplyTo.Email != "reply@example.com" {
+		t.Errorf("got from %+v and reply to %+v", mail.From, mail.ReplyTo)
+	}
+	if len(mail.Content) != 1 || mail.Content[0].Type != "text/html" {
+		t.Errorf("got content %+v", mail.Content)
+	}
+	if a := mail.Attachments[0]; a.Disposition != "inline" || a.ContentID != "logo" || a.Type != "image/png" || a.Content != "cG5n" {
+		t.Errorf("got attachment %+v", a)
+	}
+}
+
+func TestSendGridPushErrors(t *testing.T) {
+	status := http.StatusRequestEntityTooLarge
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"errors": [{"message": "bad request"}]}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewSendGrid([]byte(fmt.Sprintf(`{"api_key": "key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("got %v, want ErrMessageTooLarge", err)
+	}
+
+	status = http.StatusBadRequest
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("got %v", err)
+	}
+}
@@ -1,148 +1,587 @@
 package messenger
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ses"
-	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sesv2"
 	"github.com/francoispqt/onelog"
 	"github.com/knadh/smtppool"
+	"golang.org/x/time/rate"
 )
 
 const (
 	ContentTypeHTML  = "html"
 	ContentTypePlain = "plain"
+
+	hdrSESConfigurationSet = "X-SES-CONFIGURATION-SET"
+
+	// sesMaxMessageBytes is the maximum size of a raw message accepted
+	// by SES, including attachments and their encoding overhead.
+	sesMaxMessageBytes = 10 * 1024 * 1024
+
+	// sesMaxAttachments and sesMaxTotalAttachmentBytes are the default
+	// limits on the attachments of a message.
+	sesMaxAttachments          = 20
+	sesMaxTotalAttachmentBytes = 15 * 1024 * 1024
 )
 
+// reSESTag matches the characters SES allows in message tag names and values.
+var reSESTag = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 type sesCfg struct {
-	AccessKey string `json:"access_key"`
-	SecretKey string `json:"secret_key"`
-	Region    string `json:"region"`
-	Log       bool   `json:"log"`
+	awsCfg
+
+	ConfigurationSet string            `json:"configuration_set"`
+	DefaultFromName  string            `json:"default_from_name"`
+	Charset          string            `json:"charset"`
+	DefaultTags      map[string]string `json:"default_tags"`
+	MaxMessageBytes  int               `json:"max_message_bytes"`
+
+	// FromRotation is a list of verified From addresses that are used in
+	// turn for messages whose campaign doesn't set a from address, to
+	// spread the sending reputation across them.
+	FromRotation []string `json:"from_rotation"`
+
+	// MaxAttachments and MaxTotalAttachmentBytes limit the number and the
+	// total size, before encoding, of a message's attachments.
+	MaxAttachments          int   `json:"max_attachments"`
+	MaxTotalAttachmentBytes int64 `json:"max_total_attachment_bytes"`
+
+	// IPPoolName is the dedicated IP pool that mail is sent from. SES routes
+	// mail by the pool of its configuration set, so it requires
+	// ConfigurationSet. The messenger fails to start, and the health check
+	// fails, unless the set is assigned to the pool. Mail uses the default
+	// routing when it's empty.
+	IPPoolName string `json:"ip_pool_name"`
+
+	// ReturnPath is the envelope sender that bounces are sent to, eg: for
+	// VERP. The From header is left untouched.
+	ReturnPath string `json:"return_path"`
+
+	// RateLimit is the maximum number of sends per second, eg: the
+	// account's SES max send rate. 0 disables limiting.
+	RateLimit float64 `json:"rate_limit"`
+
+	// CheckSuppression looks up the recipient in the account's suppression
+	// list before sending. It's off by default as it adds a round trip.
+	CheckSuppression bool `json:"check_suppression"`
+
+	// RenderTemplates renders the body as a template with the subscriber
+	// as its data for bodies that listmonk hasn't rendered.
+	RenderTemplates bool `json:"render_templates"`
+
+	// TemplateName is the SES template that messages are sent with, using
+	// SendTemplatedEmail with the message's TemplateData, when they don't
+	// name a Template of their own. Messages are sent raw when neither is
+	// set.
+	TemplateName string `json:"template_name"`
+
+	// TrackingPixelURL is a text/template for the URL of an open tracking
+	// pixel added to HTML emails, with .SubscriberUUID and .CampaignUUID.
+	TrackingPixelURL string `json:"tracking_pixel_url"`
+
+	// ClickTrackBaseURL, if set, rewrites the links in HTML emails to go
+	// through it with the original URL in the "url" query param and the
+	// subscriber and campaign UUIDs in "s" and "c".
+	ClickTrackBaseURL string `json:"click_track_base_url"`
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout tune the pool
+	// of keep-alive connections to SES. All sends go to a single host, for
+	// which the standard library only keeps 2 idle connections by default,
+	// so raise MaxIdleConnsPerHost for highly concurrent sending.
+	MaxIdleConns        int    `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int    `json:"max_idle_conns_per_host"`
+	IdleConnTimeout     string `json:"idle_conn_timeout"`
+
+	// DryRun renders messages and logs them instead of sending.
+	DryRun bool `json:"dry_run"`
+	logCfg
 }
 
 type sesMessenger struct {
-	cfg    sesCfg
-	client *ses.SES
+	cfg       sesCfg
+	client    *ses.SES
+	transport *http.Transport
+
+	// clientV2 is set when the messenger sends through the SESv2 API
+	// instead of the v1 SendRawEmail.
+	clientV2 *sesv2.SESV2
+
+	// suppression is the client used to check the suppression list when
+	// CheckSuppression is enabled.
+	suppression *sesv2.SESV2
 
-	logger *onelog.Logger
+	// pools is the client used to check the configuration set's IP pool
+	// when IPPoolName is set.
+	pools *sesv2.SESV2
+
+	// pixel is the parsed TrackingPixelURL, nil when it isn't set.
+	pixel *template.Template
+
+	// clickBase is the parsed ClickTrackBaseURL, nil when it isn't set.
+	clickBase *url.URL
+
+	// limiter is nil when no rate limit is configured.
+	limiter *rate.Limiter
+
+	// fromIdx is the number of From addresses taken from FromRotation. It's
+	// shared by the copies of the messenger.
+	fromIdx *atomic.Uint64
+
+	// ctx is cancelled when the messenger is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger *levelLogger
 }
 
 func (s sesMessenger) Name() string {
+	if s.clientV2 != nil {
+		return "sesv2"
+	}
 	return "ses"
 }
 
-// Push sends the sms through pinpoint API.
-func (s sesMessenger) Push(msg Message) (string, error) {
-	// convert attachments to smtppool.Attachments
-	var files []smtppool.Attachment
-	if msg.Attachments != nil {
-		files = make([]smtppool.Attachment, 0, len(msg.Attachments))
-		for _, f := range msg.Attachments {
-			a := smtppool.Attachment{
-				Filename: f.Name,
-				Header:   f.Header,
-				Content:  make([]byte, len(f.Content)),
-			}
-			copy(a.Content, f.Content)
-			files = append(files, a)
+// Push sends the email through SES.
+func (s sesMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	res, err := s.PushDetailed(ctx, msg)
+	return res.MessageID, err
+}
+
+// PushDetailed sends the email through SES and returns the message ID along
+// with the accepted recipients and the raw SES response.
+func (s sesMessenger) PushDetailed(ctx context.Context, msg Message) (Result, error) {
+	if s.ctx.Err() != nil {
+		return Result{}, ErrClosed
+	}
+	if err := validateRecipient(msg.Subscriber.Email); err != nil {
+		return Result{}, err
+	}
+
+	if s.limiter != nil {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return Result{}, fmt.Errorf("error waiting for rate limit: %w", err)
+		}
+	}
+
+	if s.suppression != nil {
+		if err := s.checkSuppressed(ctx, msg.Subscriber.Email); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if tpl := s.templateName(msg); tpl != "" {
+		return s.pushTemplated(ctx, msg, tpl)
+	}
+
+	if err := validateHeaders(msg.Headers); err != nil {
+		return Result{}, err
+	}
+	if err := s.checkAttachments(msg.Attachments); err != nil {
+		return Result{}, err
+	}
+
+	if msg.ContentType == "" {
+		msg.ContentType = detectContentType(msg.Body)
+	}
+	if s.cfg.RenderTemplates {
+		body, err := renderBody(msg)
+		if err != nil {
+			return Result{}, err
 		}
+		msg.Body = []byte(body)
+	}
+	if s.clickBase != nil && msg.ContentType != ContentTypePlain {
+		msg.Body = rewriteLinks(msg.Body, s.clickBase, msg)
+	}
+	if s.pixel != nil && msg.ContentType != ContentTypePlain {
+		body, err := injectPixel(msg.Body, s.pixel, msg)
+		if err != nil {
+			return Result{}, err
+		}
+		msg.Body = body
+	}
+
+	email := makeEmail(msg)
+	email.From = s.messageFrom(msg)
+	if email.From == "" {
+		return Result{}, errMissingFrom
+	}
+	if msg.AMPBody != "" {
+		if len(email.HTML) == 0 {
+			return Result{}, errors.New("amp body requires an html body")
+		}
+		// AMP parts are only rendered alongside text and HTML alternatives.
+		if len(email.Text) == 0 {
+			email.Text = []byte(htmlToText(email.HTML))
+		}
+	}
+	if s.cfg.DefaultFromName != "" {
+		email.From = withDefaultName(email.From, s.cfg.DefaultFromName)
+	}
+	if s.cfg.ConfigurationSet != "" {
+		email.Headers[hdrSESConfigurationSet] = []string{s.cfg.ConfigurationSet}
+	}
+	tags, err := s.makeTags(msg.Tags)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := encodeCharset(&email, s.cfg.Charset); err != nil {
+		return Result{}, err
 	}
 
-	fromEmail := msg.From
-	if msg.Campaign != nil {
-		fromEmail = msg.Campaign.FromEmail
+	emailB, err := renderEmail(email, s.cfg.Charset)
+	if err != nil {
+		return Result{}, err
+	}
+	if msg.AMPBody != "" {
+		// AMP for Email requires UTF-8, so the part is added after the
+		// other parts have been rendered in the configured charset.
+		if emailB, err = insertAMP(emailB, msg.AMPBody); err != nil {
+			return Result{}, err
+		}
 	}
+	if len(emailB) > s.cfg.MaxMessageBytes {
+		return Result{}, fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrMessageTooLarge, len(emailB), s.cfg.MaxMessageBytes)
+	}
+	s.logger.DebugWith("sending email").String("email", s.logger.email(msg.Subscriber.Email)).Int("bytes", len(emailB)).Write()
 
-	email := smtppool.Email{
-		From:        fromEmail,
-		To:          []string{msg.Subscriber.Email},
-		Subject:     msg.Subject,
-		Sender:      msg.From,
-		Headers:     msg.Headers,
-		Attachments: files,
+	// Bcc addresses aren't rendered in the raw message headers, so SES only
+	// delivers to them if they're part of the destinations.
+	dest := make([]*string, 0, len(email.To)+len(email.Cc)+len(email.Bcc))
+	for _, addrs := range [][]string{email.To, email.Cc, email.Bcc} {
+		for _, a := range addrs {
+			dest = append(dest, aws.String(a))
+		}
 	}
 
-	switch {
-	case msg.ContentType == ContentTypePlain:
-		email.Text = msg.Body
-	default:
-		email.HTML = msg.Body
+	if s.cfg.DryRun {
+		id := dryRunID()
+		e := s.logger.WarnWith("dry run: skipped sending email").String("message_id", id).
+			String("email", s.logger.email(msg.Subscriber.Email))
+		// The raw email has the addresses in full.
+		if !s.cfg.RedactPII {
+			e = e.String("raw", string(emailB))
+		}
+		e.Write()
+		return Result{MessageID: id, Provider: s.Name(), Timestamp: time.Now()}, nil
 	}
 
-	emailB, err := email.Bytes()
+	var res Result
+	if s.clientV2 != nil {
+		res, err = s.sendV2(ctx, email, tags, emailB)
+	} else {
+		res, err = s.send(ctx, email, dest, tags, emailB)
+	}
 	if err != nil {
-		return "", err
+		if ctx.Err() != nil {
+			return Result{}, fmt.Errorf("error sending email: %w", ctx.Err())
+		}
+		return Result{}, wrapAWSError(err)
+	}
+
+	// SES either accepts or rejects a message for all its destinations.
+	res.Provider = s.Name()
+	res.Recipients = aws.StringValueSlice(dest)
+	res.Accepted = len(res.Recipients)
+	res.Timestamp = time.Now()
+
+	s.logger.InfoWith("successfully sent email").String("email", s.logger.email(msg.Subscriber.Email)).String("message_id", res.MessageID).Write()
+
+	return res, nil
+}
+
+// send pushes the raw message through the v1 SendRawEmail API.
+func (s sesMessenger) send(ctx context.Context, email smtppool.Email, dest []*string, tags []*ses.MessageTag, raw []byte) (Result, error) {
+	source := email.From
+	if s.cfg.ReturnPath != "" {
+		source = s.cfg.ReturnPath
 	}
 
 	input := &ses.SendRawEmailInput{
-		Source:       &email.From,
-		Destinations: []*string{&msg.Subscriber.Email},
+		Source:       &source,
+		Destinations: dest,
+		Tags:         tags,
 		RawMessage: &ses.RawMessage{
-			Data: emailB,
+			Data: raw,
 		},
 	}
 
-	out, err := s.client.SendRawEmail(input)
+	out, err := s.client.SendRawEmailWithContext(ctx, input)
 	if err != nil {
-		return "", err
+		return Result{}, err
+	}
+
+	s.logger.DebugWith("ses response").String("results", fmt.Sprintf("%#+v", out)).Write()
+
+	rawOut, _ := json.Marshal(out)
+	return Result{MessageID: aws.StringValue(out.MessageId), Raw: rawOut}, nil
+}
+
+// messageFrom returns the From address for the message, taking the next
+// address from FromRotation when the campaign doesn't set one.
+func (s sesMessenger) messageFrom(msg Message) string {
+	if len(s.cfg.FromRotation) > 0 && (msg.Campaign == nil || msg.Campaign.FromEmail == "") {
+		return s.nextFrom()
 	}
+	return messageFrom(msg)
+}
+
+// nextFrom returns the next address from FromRotation, round-robin.
+func (s sesMessenger) nextFrom() string {
+	n := s.fromIdx.Add(1) - 1
+	return s.cfg.FromRotation[n%uint64(len(s.cfg.FromRotation))]
+}
+
+// checkAttachments checks the attachments against the configured count
+// and total size limits. Attachments by URL aren't fetched by SES.
+func (s sesMessenger) checkAttachments(files []Attachment) error {
+	for _, f := range files {
+		if f.URL != "" && len(f.Content) == 0 {
+			return fmt.Errorf("attachment %s: attachments by url aren't supported by ses", f.URL)
+		}
+	}
+
+	if len(files) > s.cfg.MaxAttachments {
+		return fmt.Errorf("%w: %d attachments exceeds the limit of %d", ErrMessageTooLarge, len(files), s.cfg.MaxAttachments)
+	}
+
+	total := Message{Attachments: files}.AttachmentBytes()
+	if total > s.cfg.MaxTotalAttachmentBytes {
+		return fmt.Errorf("%w: %d bytes of attachments exceeds the limit of %d bytes", ErrMessageTooLarge, total, s.cfg.MaxTotalAttachmentBytes)
+	}
+
+	return nil
+}
+
+// makeTags merges the configured default tags with the message's tags,
+// the latter taking precedence, and validates them against the
+// characters SES allows.
+func (s sesMessenger) makeTags(msgTags map[string]string) ([]*ses.MessageTag, error) {
+	merged := make(map[string]string, len(s.cfg.DefaultTags)+len(msgTags))
+	for k, v := range s.cfg.DefaultTags {
+		merged[k] = v
+	}
+	for k, v := range msgTags {
+		merged[k] = v
+	}
+	if len(merged) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	if s.cfg.Log {
-		s.logger.InfoWith("successfully sent email").String("email", msg.Subscriber.Email).String("results", fmt.Sprintf("%#+v", out)).Write()
+	tags := make([]*ses.MessageTag, 0, len(keys))
+	for _, k := range keys {
+		v := merged[k]
+		if !reSESTag.MatchString(k) {
+			return nil, fmt.Errorf("invalid tag name %q: only alphanumeric, '-' and '_' are allowed", k)
+		}
+		if !reSESTag.MatchString(v) {
+			return nil, fmt.Errorf("invalid value %q for tag %q: only alphanumeric, '-' and '_' are allowed", v, k)
+		}
+		tags = append(tags, &ses.MessageTag{Name: aws.String(k), Value: aws.String(v)})
+	}
+
+	return tags, nil
+}
+
+// HealthCheck verifies that SES is reachable by fetching the account's
+// sending quota.
+func (s sesMessenger) HealthCheck(ctx context.Context) error {
+	var err error
+	if s.clientV2 != nil {
+		_, err = s.clientV2.GetAccountWithContext(ctx, &sesv2.GetAccountInput{})
+	} else {
+		_, err = s.client.GetSendQuotaWithContext(ctx, &ses.GetSendQuotaInput{})
+	}
+	if err != nil {
+		return wrapAWSError(err)
 	}
 
-	return *out.MessageId, nil
+	if s.pools != nil {
+		return s.checkIPPool(ctx)
+	}
+	return nil
 }
 
 func (s sesMessenger) Flush() error {
 	return nil
 }
 
+// Close marks the messenger as closed and releases idle connections
+// held by the underlying HTTP transport.
 func (s sesMessenger) Close() error {
+	s.cancel()
+	s.transport.CloseIdleConnections()
 	return nil
 }
 
-func checkCredentials(sess *session.Session) error {
-	// Create a SES service client.
-	svc := sts.New(sess)
-	// Call the GetCallerIdentity API to check credentials
-	params := &sts.GetCallerIdentityInput{}
-	_, err := svc.GetCallerIdentity(params)
-	return err
+// NewAWSSES creates new instance of ses
+func NewAWSSES(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	s, sess, err := newSESMessenger(cfg, l)
+	if err != nil {
+		return nil, err
+	}
+
+	s.client = ses.New(sess)
+	return s, nil
 }
 
-// NewAWSSES creates new instance of pinpoint
-func NewAWSSES(cfg []byte, l *onelog.Logger) (Messenger, error) {
+// newSESTransport creates the HTTP transport for the SES client with the
+// configured connection pool settings.
+func newSESTransport(c sesCfg) (*http.Transport, error) {
+	if c.MaxIdleConns < 0 {
+		return nil, fmt.Errorf("invalid max_idle_conns: %d", c.MaxIdleConns)
+	}
+	if c.MaxIdleConnsPerHost < 0 {
+		return nil, fmt.Errorf("invalid max_idle_conns_per_host: %d", c.MaxIdleConnsPerHost)
+	}
+
+	t := newHTTPTransport()
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout != "" {
+		d, err := time.ParseDuration(c.IdleConnTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idle_conn_timeout: %v", err)
+		}
+		t.IdleConnTimeout = d
+	}
+	return t, nil
+}
+
+// newSESMessenger parses the config and sets up the AWS session shared by
+// the v1 and v2 SES messengers.
+func newSESMessenger(cfg []byte, l *onelog.Logger) (sesMessenger, *session.Session, error) {
 	var c sesCfg
 	if err := json.Unmarshal(cfg, &c); err != nil {
-		return nil, err
+		return sesMessenger{}, nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return sesMessenger{}, nil, err
+	}
+
+	if c.MaxMessageBytes == 0 {
+		c.MaxMessageBytes = sesMaxMessageBytes
+	}
+	if c.MaxAttachments == 0 {
+		c.MaxAttachments = sesMaxAttachments
+	}
+	if c.MaxTotalAttachmentBytes == 0 {
+		c.MaxTotalAttachmentBytes = sesMaxTotalAttachmentBytes
+	}
+	if c.Charset == "" {
+		c.Charset = defaultCharset
+	}
+	if _, err := charsetEncoder(c.Charset); err != nil {
+		return sesMessenger{}, nil, err
+	}
+
+	var pixel *template.Template
+	if c.TrackingPixelURL != "" {
+		t, err := template.New("pixel").Parse(c.TrackingPixelURL)
+		if err != nil {
+			return sesMessenger{}, nil, fmt.Errorf("invalid tracking_pixel_url: %v", err)
+		}
+		pixel = t
 	}
 
-	config := &aws.Config{
-		MaxRetries: aws.Int(3),
+	var clickBase *url.URL
+	if c.ClickTrackBaseURL != "" {
+		u, err := url.Parse(c.ClickTrackBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return sesMessenger{}, nil, fmt.Errorf("invalid click_track_base_url: %s", c.ClickTrackBaseURL)
+		}
+		clickBase = u
 	}
-	if c.AccessKey != "" && c.SecretKey != "" {
-		config.Credentials = credentials.NewStaticCredentials(c.AccessKey, c.SecretKey, "")
+
+	if c.IPPoolName != "" && c.ConfigurationSet == "" {
+		return sesMessenger{}, nil, fmt.Errorf("ip_pool_name requires a configuration_set")
 	}
-	if c.Region != "" {
-		config.Region = &c.Region
+
+	for _, a := range c.FromRotation {
+		if _, err := mail.ParseAddress(a); err != nil {
+			return sesMessenger{}, nil, fmt.Errorf("invalid from_rotation address %q: %v", a, err)
+		}
 	}
 
-	var sess = session.Must(session.NewSession(config))
-	err := checkCredentials(sess)
+	transport, err := newSESTransport(c)
 	if err != nil {
-		return nil, err
+		return sesMessenger{}, nil, err
+	}
+	sess, err := newAWSSession(c.awsCfg, transport)
+	if err != nil {
+		return sesMessenger{}, nil, err
+	}
+
+	var limiter *rate.Limiter
+	if c.RateLimit > 0 {
+		burst := int(c.RateLimit)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(c.RateLimit), burst)
+	}
+
+	var suppression *sesv2.SESV2
+	if c.CheckSuppression {
+		suppression = sesv2.New(sess)
+	}
+
+	var pools *sesv2.SESV2
+	if c.IPPoolName != "" {
+		pools = sesv2.New(sess)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := sesMessenger{
+		cfg:         c,
+		transport:   transport,
+		suppression: suppression,
+		pools:       pools,
+		pixel:       pixel,
+		clickBase:   clickBase,
+		limiter:     limiter,
+		fromIdx:     new(atomic.Uint64),
+		ctx:         ctx,
+		cancel:      cancel,
+		logger:      logger,
+	}
+
+	// The pool is applied by the configuration set, so fail fast if it
+	// isn't the one mail would be sent from.
+	if pools != nil {
+		if err := s.checkIPPool(context.Background()); err != nil {
+			s.Close()
+			return sesMessenger{}, nil, err
+		}
 	}
 
-	svc := ses.New(sess)
-	return sesMessenger{
-		client: svc,
-		cfg:    c,
-		logger: l,
-	}, nil
+	return s, sess, nil
 }
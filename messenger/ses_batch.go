@@ -0,0 +1,199 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ses"
+)
+
+// sesMaxBulkDestinations is the maximum number of destinations SES accepts
+// in a single SendBulkTemplatedEmail call.
+const sesMaxBulkDestinations = 50
+
+// PushBatch sends multiple messages, grouping the ones that share a
+// template, sender and Reply-To addresses into SendBulkTemplatedEmail
+// calls. Messages without a
+// template are sent individually with Push. The returned IDs are aligned
+// with msgs and the error joins the failures of individual messages.
+func (s sesMessenger) PushBatch(ctx context.Context, msgs []Message) ([]string, error) {
+	if s.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+
+	var (
+		ids  = make([]string, len(msgs))
+		errs []error
+
+		// Indexes of templated messages grouped by template, sender and
+		// Reply-To addresses.
+		groups = make(map[sesBulkKey][]int)
+		order  []sesBulkKey
+	)
+	for i, m := range msgs {
+		// The bulk API is only available in SES v1.
+		tpl := s.templateName(m)
+		if tpl == "" || s.clientV2 != nil {
+			id, err := s.Push(ctx, m)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("message %d: %w", i, err))
+			}
+			ids[i] = id
+			continue
+		}
+
+		if err := validateRecipient(m.Subscriber.Email); err != nil {
+			errs = append(errs, fmt.Errorf("message %d: %w", i, err))
+			continue
+		}
+		if s.suppression != nil {
+			if err := s.checkSuppressed(ctx, m.Subscriber.Email); err != nil {
+				errs = append(errs, fmt.Errorf("message %d: %w", i, err))
+				continue
+			}
+		}
+
+		key := sesBulkKey{tpl: tpl, from: s.messageFrom(m), replyTo: strings.Join(m.ReplyTo, ",")}
+		if key.from == "" {
+			errs = append(errs, fmt.Errorf("message %d: %w", i, errMissingFrom))
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range order {
+		idx := groups[key]
+		for len(idx) > 0 {
+			n := len(idx)
+			if n > sesMaxBulkDestinations {
+				n = sesMaxBulkDestinations
+			}
+
+			if err := s.sendBulk(ctx, key.tpl, key.from, msgs, idx[:n], ids); err != nil {
+				errs = append(errs, err)
+			}
+			idx = idx[n:]
+		}
+	}
+
+	return ids, errors.Join(errs...)
+}
+
+// sesBulkKey groups the messages that can be sent in the same
+// SendBulkTemplatedEmail call.
+type sesBulkKey struct {
+	tpl     string
+	from    string
+	replyTo string
+}
+
+// sendBulk sends the messages at the given indexes with a single
+// SendBulkTemplatedEmail call and records their IDs in ids.
+func (s sesMessenger) sendBulk(ctx context.Context, tpl, from string, msgs []Message, idx []int, ids []string) error {
+	var errs []error
+
+	dest := make([]*ses.BulkEmailDestination, 0, len(idx))
+	sent := make([]int, 0, len(idx))
+	for _, i := range idx {
+		m := msgs[i]
+
+		data, err := json.Marshal(m.TemplateData)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("message %d: error encoding template data: %w", i, err))
+			continue
+		}
+		// A nil map encodes to null, which SES rejects.
+		if m.TemplateData == nil {
+			data = []byte("{}")
+		}
+
+		tags, err := s.makeTags(m.Tags)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("message %d: %w", i, err))
+			continue
+		}
+
+		dest = append(dest, &ses.BulkEmailDestination{
+			Destination: &ses.Destination{
+				ToAddresses:  aws.StringSlice([]string{m.Subscriber.Email}),
+				CcAddresses:  aws.StringSlice(m.Cc),
+				BccAddresses: aws.StringSlice(m.Bcc),
+			},
+			ReplacementTemplateData: aws.String(string(data)),
+			ReplacementTags:         tags,
+		})
+		sent = append(sent, i)
+	}
+	if len(dest) == 0 {
+		return errors.Join(errs...)
+	}
+
+	if s.cfg.DryRun {
+		for _, i := range sent {
+			ids[i] = dryRunID()
+		}
+		s.logger.WarnWith("dry run: skipped sending bulk email").String("template", tpl).Int("count", len(sent)).Write()
+		return errors.Join(errs...)
+	}
+
+	// Every destination counts towards the send rate. Waiting one at a
+	// time avoids WaitN failing when the batch exceeds the burst size.
+	if s.limiter != nil {
+		for range dest {
+			if err := s.limiter.Wait(ctx); err != nil {
+				return errors.Join(append(errs, fmt.Errorf("error waiting for rate limit: %w", err))...)
+			}
+		}
+	}
+
+	input := &ses.SendBulkTemplatedEmailInput{
+		Source:              aws.String(from),
+		Template:            aws.String(tpl),
+		DefaultTemplateData: aws.String("{}"),
+		Destinations:        dest,
+	}
+	// The messages in a group share their Reply-To addresses.
+	if replyTo := msgs[sent[0]].ReplyTo; len(replyTo) > 0 {
+		input.ReplyToAddresses = aws.StringSlice(replyTo)
+	}
+	if s.cfg.ReturnPath != "" {
+		input.ReturnPath = aws.String(s.cfg.ReturnPath)
+	}
+	if s.cfg.ConfigurationSet != "" {
+		input.ConfigurationSetName = aws.String(s.cfg.ConfigurationSet)
+	}
+
+	out, err := s.client.SendBulkTemplatedEmailWithContext(ctx, input)
+	if err != nil {
+		for _, i := range sent {
+			errs = append(errs, fmt.Errorf("message %d: %w", i, wrapAWSError(err)))
+		}
+		return errors.Join(errs...)
+	}
+
+	// Statuses are returned in the order of the destinations.
+	for n, i := range sent {
+		if n >= len(out.Status) {
+			errs = append(errs, fmt.Errorf("message %d: no status returned", i))
+			continue
+		}
+
+		st := out.Status[n]
+		if aws.StringValue(st.Status) != ses.BulkEmailStatusSuccess {
+			errs = append(errs, fmt.Errorf("message %d: %s: %s", i, aws.StringValue(st.Status), aws.StringValue(st.Error)))
+			continue
+		}
+		ids[i] = aws.StringValue(st.MessageId)
+	}
+
+	s.logger.InfoWith("successfully sent bulk email").String("template", tpl).Int("count", len(sent)).Write()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,148 @@
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	SESEventBounce    = "Bounce"
+	SESEventComplaint = "Complaint"
+	SESEventDelivery  = "Delivery"
+
+	SESBouncePermanent = "Permanent"
+	SESBounceTransient = "Transient"
+)
+
+// SESEvent is an SES bounce, complaint or delivery notification.
+type SESEvent struct {
+	// Type is one of the SESEvent* values.
+	Type      string        `json:"type"`
+	MessageID string        `json:"message_id"`
+	Source    string        `json:"source"`
+	Timestamp time.Time     `json:"timestamp"`
+	Bounce    *SESBounce    `json:"bounce,omitempty"`
+	Complaint *SESComplaint `json:"complaint,omitempty"`
+	Delivery  *SESDelivery  `json:"delivery,omitempty"`
+}
+
+// Recipients returns the addresses affected by the event.
+func (e SESEvent) Recipients() []string {
+	switch {
+	case e.Bounce != nil:
+		out := make([]string, 0, len(e.Bounce.Recipients))
+		for _, r := range e.Bounce.Recipients {
+			out = append(out, r.EmailAddress)
+		}
+		return out
+	case e.Complaint != nil:
+		out := make([]string, 0, len(e.Complaint.Recipients))
+		for _, r := range e.Complaint.Recipients {
+			out = append(out, r.EmailAddress)
+		}
+		return out
+	case e.Delivery != nil:
+		return e.Delivery.Recipients
+	}
+	return nil
+}
+
+// SESBounce is the bounce object of an SES notification.
+type SESBounce struct {
+	// BounceType is either SESBouncePermanent, SESBounceTransient or
+	// "Undetermined".
+	BounceType    string                `json:"bounceType"`
+	BounceSubType string                `json:"bounceSubType"`
+	Recipients    []SESBouncedRecipient `json:"bouncedRecipients"`
+	FeedbackID    string                `json:"feedbackId"`
+	Timestamp     time.Time             `json:"timestamp"`
+}
+
+// SESBouncedRecipient is a recipient of a bounced message.
+type SESBouncedRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	Action         string `json:"action"`
+	Status         string `json:"status"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+// SESComplaint is the complaint object of an SES notification.
+type SESComplaint struct {
+	Recipients            []SESComplainedRecipient `json:"complainedRecipients"`
+	ComplaintFeedbackType string                   `json:"complaintFeedbackType"`
+	FeedbackID            string                   `json:"feedbackId"`
+	Timestamp             time.Time                `json:"timestamp"`
+}
+
+// SESComplainedRecipient is a recipient that complained about a message.
+type SESComplainedRecipient struct {
+	EmailAddress string `json:"emailAddress"`
+}
+
+// SESDelivery is the delivery object of an SES notification.
+type SESDelivery struct {
+	Recipients   []string  `json:"recipients"`
+	SMTPResponse string    `json:"smtpResponse"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// sesNotification is the message of an SES notification or, with
+// EventType instead of NotificationType, an event publishing record.
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Mail             struct {
+		MessageID string    `json:"messageId"`
+		Source    string    `json:"source"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"mail"`
+	Bounce    *SESBounce    `json:"bounce"`
+	Complaint *SESComplaint `json:"complaint"`
+	Delivery  *SESDelivery  `json:"delivery"`
+}
+
+// ParseSESNotification parses an SNS notification carrying an SES bounce,
+// complaint or delivery notification, eg: to suppress bounced subscribers
+// in listmonk.
+func ParseSESNotification(raw []byte) (SESEvent, error) {
+	var env snsEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return SESEvent{}, fmt.Errorf("error parsing sns notification: %v", err)
+	}
+	if env.Type != snsTypeNotification {
+		return SESEvent{}, fmt.Errorf("unsupported sns message type: %q", env.Type)
+	}
+
+	var n sesNotification
+	if err := json.Unmarshal([]byte(env.Message), &n); err != nil {
+		return SESEvent{}, fmt.Errorf("error parsing ses notification: %v", err)
+	}
+
+	typ := n.NotificationType
+	if typ == "" {
+		typ = n.EventType
+	}
+
+	ev := SESEvent{
+		Type:      typ,
+		MessageID: n.Mail.MessageID,
+		Source:    n.Mail.Source,
+		Timestamp: n.Mail.Timestamp,
+	}
+	switch typ {
+	case SESEventBounce:
+		ev.Bounce = n.Bounce
+	case SESEventComplaint:
+		ev.Complaint = n.Complaint
+	case SESEventDelivery:
+		ev.Delivery = n.Delivery
+	default:
+		return SESEvent{}, fmt.Errorf("unsupported ses notification type: %q", typ)
+	}
+	if ev.Bounce == nil && ev.Complaint == nil && ev.Delivery == nil {
+		return SESEvent{}, fmt.Errorf("ses %s notification is missing its %s object", typ, typ)
+	}
+
+	return ev, nil
+}
@@ -0,0 +1,72 @@
+package messenger
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sesNotificationEnvelope wraps an SES notification in an SNS envelope.
+func sesNotificationEnvelope(t *testing.T, msg string) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(snsEnvelope{Type: snsTypeNotification, MessageID: "n-1", Message: msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseSESNotification(t *testing.T) {
+	const mail = `"mail": {"messageId": "m-1", "source": "sender@example.com", "timestamp": "2024-01-01T12:00:00.000Z"}`
+
+	ev, err := ParseSESNotification(sesNotificationEnvelope(t, `{"notificationType": "Bounce", `+mail+`,
+		"bounce": {"bounceType": "Permanent", "bounceSubType": "General", "feedbackId": "f-1",
+			"bouncedRecipients": [{"emailAddress": "a@example.com", "status": "5.1.1"}, {"emailAddress": "b@example.com"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != SESEventBounce || ev.MessageID != "m-1" || ev.Source != "sender@example.com" || !ev.Timestamp.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("got event %+v", ev)
+	}
+	if ev.Bounce.BounceType != SESBouncePermanent || ev.Bounce.Recipients[0].Status != "5.1.1" {
+		t.Errorf("got bounce %+v", ev.Bounce)
+	}
+	if got := strings.Join(ev.Recipients(), ","); got != "a@example.com,b@example.com" {
+		t.Errorf("got recipients %s", got)
+	}
+
+	// Event publishing records use eventType.
+	ev, err = ParseSESNotification(sesNotificationEnvelope(t, `{"eventType": "Complaint", `+mail+`,
+		"complaint": {"complaintFeedbackType": "abuse", "complainedRecipients": [{"emailAddress": "c@example.com"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != SESEventComplaint || ev.Complaint.ComplaintFeedbackType != "abuse" || strings.Join(ev.Recipients(), ",") != "c@example.com" {
+		t.Errorf("got event %+v", ev)
+	}
+
+	ev, err = ParseSESNotification(sesNotificationEnvelope(t, `{"notificationType": "Delivery", `+mail+`,
+		"delivery": {"recipients": ["d@example.com"], "smtpResponse": "250 OK"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != SESEventDelivery || strings.Join(ev.Recipients(), ",") != "d@example.com" {
+		t.Errorf("got event %+v", ev)
+	}
+}
+
+func TestParseSESNotificationErrors(t *testing.T) {
+	for name, raw := range map[string][]byte{
+		"invalid json":   []byte("{"),
+		"sns type":       []byte(`{"Type": "SubscriptionConfirmation"}`),
+		"invalid ses":    sesNotificationEnvelope(t, "not json"),
+		"unknown type":   sesNotificationEnvelope(t, `{"notificationType": "Open"}`),
+		"missing object": sesNotificationEnvelope(t, `{"notificationType": "Bounce"}`),
+	} {
+		if _, err := ParseSESNotification(raw); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/aws/aws-sdk-go/service/sesv2"
+)
+
+// templateName returns the SES template to send the message with, if any.
+func (s sesMessenger) templateName(msg Message) string {
+	if msg.Template != "" {
+		return msg.Template
+	}
+	return s.cfg.TemplateName
+}
+
+// pushTemplated sends the message with an SES template, rendered by SES
+// with the message's TemplateData. The body, headers and attachments of the
+// message aren't used.
+func (s sesMessenger) pushTemplated(ctx context.Context, msg Message, tpl string) (Result, error) {
+	from := s.messageFrom(msg)
+	if from == "" {
+		return Result{}, errMissingFrom
+	}
+	if s.cfg.DefaultFromName != "" {
+		from = withDefaultName(from, s.cfg.DefaultFromName)
+	}
+
+	data, err := json.Marshal(msg.TemplateData)
+	if err != nil {
+		return Result{}, fmt.Errorf("error encoding template data: %w", err)
+	}
+	// A nil map encodes to null, which SES rejects.
+	if msg.TemplateData == nil {
+		data = []byte("{}")
+	}
+
+	tags, err := s.makeTags(msg.Tags)
+	if err != nil {
+		return Result{}, err
+	}
+
+	s.logger.DebugWith("sending templated email").String("email", s.logger.email(msg.Subscriber.Email)).String("template", tpl).Write()
+
+	to := []string{msg.Subscriber.Email}
+	if s.cfg.DryRun {
+		id := dryRunID()
+		s.logger.WarnWith("dry run: skipped sending templated email").String("message_id", id).
+			String("email", s.logger.email(msg.Subscriber.Email)).String("template", tpl).Write()
+		return Result{MessageID: id, Provider: s.Name(), Timestamp: time.Now()}, nil
+	}
+
+	var res Result
+	if s.clientV2 != nil {
+		res, err = s.sendTemplatedV2(ctx, from, to, msg, tpl, string(data), tags)
+	} else {
+		res, err = s.sendTemplated(ctx, from, to, msg, tpl, string(data), tags)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return Result{}, fmt.Errorf("error sending email: %w", ctx.Err())
+		}
+		return Result{}, wrapAWSError(err)
+	}
+
+	res.Provider = s.Name()
+	res.Recipients = make([]string, 0, len(to)+len(msg.Cc)+len(msg.Bcc))
+	for _, addrs := range [][]string{to, msg.Cc, msg.Bcc} {
+		res.Recipients = append(res.Recipients, addrs...)
+	}
+	res.Accepted = len(res.Recipients)
+	res.Timestamp = time.Now()
+
+	s.logger.InfoWith("successfully sent templated email").String("email", s.logger.email(msg.Subscriber.Email)).String("message_id", res.MessageID).Write()
+
+	return res, nil
+}
+
+// sendTemplated sends through the v1 SendTemplatedEmail API.
+func (s sesMessenger) sendTemplated(ctx context.Context, from string, to []string, msg Message, tpl, data string, tags []*ses.MessageTag) (Result, error) {
+	input := &ses.SendTemplatedEmailInput{
+		Source:       aws.String(from),
+		Template:     aws.String(tpl),
+		TemplateData: aws.String(data),
+		Destination: &ses.Destination{
+			ToAddresses:  aws.StringSlice(to),
+			CcAddresses:  aws.StringSlice(msg.Cc),
+			BccAddresses: aws.StringSlice(msg.Bcc),
+		},
+		ReplyToAddresses: aws.StringSlice(msg.ReplyTo),
+		Tags:             tags,
+	}
+	if s.cfg.ReturnPath != "" {
+		input.ReturnPath = aws.String(s.cfg.ReturnPath)
+	}
+	if s.cfg.ConfigurationSet != "" {
+		input.ConfigurationSetName = aws.String(s.cfg.ConfigurationSet)
+	}
+
+	out, err := s.client.SendTemplatedEmailWithContext(ctx, input)
+	if err != nil {
+		return Result{}, err
+	}
+
+	rawOut, _ := json.Marshal(out)
+	return Result{MessageID: aws.StringValue(out.MessageId), Raw: rawOut}, nil
+}
+
+// sendTemplatedV2 sends through the SESv2 SendEmail API with template
+// content.
+func (s sesMessenger) sendTemplatedV2(ctx context.Context, from string, to []string, msg Message, tpl, data string, tags []*ses.MessageTag) (Result, error) {
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(from),
+		Destination: &sesv2.Destination{
+			ToAddresses:  aws.StringSlice(to),
+			CcAddresses:  aws.StringSlice(msg.Cc),
+			BccAddresses: aws.StringSlice(msg.Bcc),
+		},
+		ReplyToAddresses: aws.StringSlice(msg.ReplyTo),
+		Content: &sesv2.EmailContent{
+			Template: &sesv2.Template{
+				TemplateName: aws.String(tpl),
+				TemplateData: aws.String(data),
+			},
+		},
+	}
+	if s.cfg.ConfigurationSet != "" {
+		input.ConfigurationSetName = aws.String(s.cfg.ConfigurationSet)
+	}
+	if s.cfg.ReturnPath != "" {
+		input.FeedbackForwardingEmailAddress = aws.String(s.cfg.ReturnPath)
+	}
+	for _, t := range tags {
+		input.EmailTags = append(input.EmailTags, &sesv2.MessageTag{Name: t.Name, Value: t.Value})
+	}
+
+	out, err := s.clientV2.SendEmailWithContext(ctx, input)
+	if err != nil {
+		return Result{}, err
+	}
+
+	rawOut, _ := json.Marshal(out)
+	return Result{MessageID: aws.StringValue(out.MessageId), Raw: rawOut}, nil
+}
@@ -0,0 +1,1052 @@
+package messenger
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/listmonk/models"
+)
+
+// fakeSES is an endpoint for both SES API versions that accepts every
+// message and records the requests it receives.
+type fakeSES struct {
+	srv    *httptest.Server
+	closed atomic.Int32
+
+	mu   sync.Mutex
+	reqs []fakeSESRequest
+
+	// errCode, if set, fails every request with the AWS error code.
+	errCode string
+}
+
+// fakeSESRequest is a request to fakeSES. action is the Action of v1
+// requests and the method and path of v2 ones.
+type fakeSESRequest struct {
+	action string
+	form   url.Values
+	body   []byte
+}
+
+func newFakeSES(t *testing.T) *fakeSES {
+	t.Helper()
+
+	f := &fakeSES{}
+	f.srv = httptest.NewUnstartedServer(http.HandlerFunc(f.serve))
+	f.srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateClosed {
+			f.closed.Add(1)
+		}
+	}
+	f.srv.Start()
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeSES) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := fakeSESRequest{action: r.Method + " " + r.URL.Path, body: body}
+	if r.URL.Path == "/" {
+		req.form, _ = url.ParseQuery(string(body))
+		req.action = req.form.Get("Action")
+	}
+
+	f.mu.Lock()
+	f.reqs = append(f.reqs, req)
+	id := fmt.Sprintf("m-%d", len(f.reqs))
+	errCode := f.errCode
+	f.mu.Unlock()
+
+	if errCode != "" {
+		if req.form == nil {
+			w.Header().Set("X-Amzn-Errortype", errCode)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "failed"}`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>failed</Message></Error></ErrorResponse>", errCode)
+		return
+	}
+
+	switch req.action {
+	case "SendRawEmail":
+		fmt.Fprintf(w, "<SendRawEmailResponse><SendRawEmailResult><MessageId>%s</MessageId></SendRawEmailResult></SendRawEmailResponse>", id)
+	case "SendTemplatedEmail":
+		fmt.Fprintf(w, "<SendTemplatedEmailResponse><SendTemplatedEmailResult><MessageId>%s</MessageId></SendTemplatedEmailResult></SendTemplatedEmailResponse>", id)
+	case "SendBulkTemplatedEmail":
+		// Destinations whose address contains "reject" are rejected.
+		fmt.Fprint(w, "<SendBulkTemplatedEmailResponse><SendBulkTemplatedEmailResult><Status>")
+		for i := 1; req.form.Has(fmt.Sprintf("Destinations.member.%d.Destination.ToAddresses.member.1", i)); i++ {
+			if strings.Contains(req.form.Get(fmt.Sprintf("Destinations.member.%d.Destination.ToAddresses.member.1", i)), "reject") {
+				fmt.Fprint(w, "<member><Status>MessageRejected</Status><Error>rejected</Error></member>")
+				continue
+			}
+			fmt.Fprintf(w, "<member><Status>Success</Status><MessageId>%s-%d</MessageId></member>", id, i)
+		}
+		fmt.Fprint(w, "</Status></SendBulkTemplatedEmailResult></SendBulkTemplatedEmailResponse>")
+	case "POST /v2/email/outbound-emails":
+		fmt.Fprintf(w, `{"MessageId": %q}`, id)
+	case "GetSendQuota":
+		fmt.Fprint(w, "<GetSendQuotaResponse><GetSendQuotaResult><Max24HourSend>200</Max24HourSend></GetSendQuotaResult></GetSendQuotaResponse>")
+	case "GET /v2/email/account":
+		fmt.Fprint(w, `{"SendingEnabled": true}`)
+	default:
+		// Configuration sets named "pool-<name>" send from the IP pool
+		// <name>.
+		if name, ok := strings.CutPrefix(req.action, "GET /v2/email/configuration-sets/"); ok {
+			pool, _ := strings.CutPrefix(name, "pool-")
+			if pool == name {
+				pool = ""
+			}
+			fmt.Fprintf(w, `{"ConfigurationSetName": %q, "DeliveryOptions": {"SendingPoolName": %q}}`, name, pool)
+			return
+		}
+
+		// Addresses containing "suppressed" are on the suppression list.
+		if addr, ok := strings.CutPrefix(req.action, "GET /v2/email/suppression/addresses/"); ok {
+			if !strings.Contains(addr, "suppressed") {
+				w.Header().Set("X-Amzn-Errortype", "NotFoundException")
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "not found"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"SuppressedDestination": {"EmailAddress": %q, "Reason": "BOUNCE"}}`, addr)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "<ErrorResponse><Error><Code>InvalidAction</Code><Message>%s</Message></Error></ErrorResponse>", req.action)
+	}
+}
+
+func (f *fakeSES) requests() []fakeSESRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeSESRequest(nil), f.reqs...)
+}
+
+// newTestSES returns the named SES messenger, ses or sesv2, sending to a
+// fakeSES. cfg is additional JSON config fields.
+func newTestSES(t *testing.T, name, cfg string) (sesMessenger, *fakeSES) {
+	t.Helper()
+
+	f := newFakeSES(t)
+	if cfg != "" {
+		cfg = ", " + cfg
+	}
+	m, err := NewRegistry().New(name, []byte(fmt.Sprintf(`{"region": "us-east-1", "access_key": "a", "secret_key": "s", "max_retries": 0, "endpoint": %q%s}`, f.srv.URL, cfg)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.(sesMessenger), f
+}
+
+// sesTestMessage returns a plain text message to a single subscriber.
+func sesTestMessage() Message {
+	msg := Message{From: "sender@example.com", Subject: "Hello", ContentType: ContentTypePlain, Body: []byte("Hello")}
+	msg.Subscriber.Email = "to@example.com"
+	return msg
+}
+
+func TestSESClose(t *testing.T) {
+	for _, name := range []string{"ses", "sesv2"} {
+		m, f := newTestSES(t, name, "")
+
+		if _, err := m.Push(context.Background(), sesTestMessage()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The idle keep-alive connection is closed.
+		deadline := time.Now().Add(time.Second)
+		for f.closed.Load() == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if f.closed.Load() == 0 {
+			t.Errorf("%s: idle connection left open", name)
+		}
+
+		if _, err := m.Push(context.Background(), sesTestMessage()); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: got %v, want ErrClosed", name, err)
+		}
+		if _, err := m.PushBatch(context.Background(), []Message{sesTestMessage()}); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: got %v from PushBatch, want ErrClosed", name, err)
+		}
+		if n := len(f.requests()); n != 1 {
+			t.Errorf("%s: got %d requests", name, n)
+		}
+	}
+}
+
+// rawEmail returns the raw message of a SendRawEmail request.
+func (r fakeSESRequest) rawEmail(t *testing.T) []byte {
+	t.Helper()
+
+	b, err := base64.StdEncoding.DecodeString(r.form.Get("RawMessage.Data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// members returns the values of a v1 list param, eg: "Destinations".
+func (r fakeSESRequest) members(name string) []string {
+	var out []string
+	for i := 1; r.form.Has(fmt.Sprintf("%s.member.%d", name, i)); i++ {
+		out = append(out, r.form.Get(fmt.Sprintf("%s.member.%d", name, i)))
+	}
+	return out
+}
+
+func TestSESCcBcc(t *testing.T) {
+	msg := sesTestMessage()
+	msg.Cc = []string{"cc@example.com"}
+	msg.Bcc = []string{"bcc@example.com"}
+
+	m, f := newTestSES(t, "ses", "")
+	res, err := m.PushDetailed(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(res.Recipients, ","); got != "to@example.com,cc@example.com,bcc@example.com" {
+		t.Errorf("got recipients %s", got)
+	}
+
+	req := f.requests()[0]
+	if got := strings.Join(req.members("Destinations"), ","); got != "to@example.com,cc@example.com,bcc@example.com" {
+		t.Errorf("got destinations %s", got)
+	}
+	h, _ := parseEmail(t, req.rawEmail(t))
+	if h.Get("Cc") != "<cc@example.com>" {
+		t.Errorf("got Cc %q", h.Get("Cc"))
+	}
+	if h.Get("Bcc") != "" {
+		t.Errorf("Bcc rendered in the headers: %q", h.Get("Bcc"))
+	}
+
+	// SESv2 takes the recipients separately from the raw message.
+	m, f = newTestSES(t, "sesv2", "")
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	var in struct {
+		Destination struct {
+			ToAddresses, CcAddresses, BccAddresses []string
+		}
+	}
+	if err := json.Unmarshal(f.requests()[0].body, &in); err != nil {
+		t.Fatal(err)
+	}
+	d := in.Destination
+	if fmt.Sprint(d.ToAddresses, d.CcAddresses, d.BccAddresses) != "[to@example.com] [cc@example.com] [bcc@example.com]" {
+		t.Errorf("got destination %+v", d)
+	}
+}
+
+func TestSESConfigurationSet(t *testing.T) {
+	msg := sesTestMessage()
+	msg.Headers = textproto.MIMEHeader{"X-Custom": {"1"}}
+
+	m, f := newTestSES(t, "ses", `"configuration_set": "tracking"`)
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := parseEmail(t, f.requests()[0].rawEmail(t))
+	if got := h.Get(hdrSESConfigurationSet); got != "tracking" {
+		t.Errorf("got %s %q", hdrSESConfigurationSet, got)
+	}
+	if h.Get("X-Custom") != "1" {
+		t.Error("message headers dropped")
+	}
+	if len(msg.Headers) != 1 {
+		t.Errorf("caller's headers modified: %v", msg.Headers)
+	}
+
+	m, f = newTestSES(t, "sesv2", `"configuration_set": "tracking"`)
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	var in struct{ ConfigurationSetName string }
+	if err := json.Unmarshal(f.requests()[0].body, &in); err != nil {
+		t.Fatal(err)
+	}
+	if in.ConfigurationSetName != "tracking" {
+		t.Errorf("got ConfigurationSetName %q", in.ConfigurationSetName)
+	}
+
+	// Without a configuration set, the header isn't added.
+	m, f = newTestSES(t, "ses", "")
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := parseEmail(t, f.requests()[0].rawEmail(t)); h.Get(hdrSESConfigurationSet) != "" {
+		t.Error("configuration set header added without one configured")
+	}
+}
+
+func TestSESMakeTags(t *testing.T) {
+	s := sesMessenger{cfg: sesCfg{DefaultTags: map[string]string{"env": "prod", "team": "growth"}}}
+
+	tags, err := s.makeTags(map[string]string{"team": "billing", "campaign": "c-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tag := range tags {
+		got = append(got, aws.StringValue(tag.Name)+"="+aws.StringValue(tag.Value))
+	}
+	// Sorted, with the message's tags overriding the defaults.
+	if strings.Join(got, ",") != "campaign=c-1,env=prod,team=billing" {
+		t.Errorf("got tags %v", got)
+	}
+
+	if tags, err := (sesMessenger{}).makeTags(nil); tags != nil || err != nil {
+		t.Errorf("got %v, %v without tags", tags, err)
+	}
+
+	for _, bad := range []map[string]string{{"bad name": "x"}, {"name": "bad:value"}, {"name": ""}} {
+		if _, err := s.makeTags(bad); err == nil {
+			t.Errorf("%v: expected an error", bad)
+		}
+	}
+}
+
+func TestSESTags(t *testing.T) {
+	msg := sesTestMessage()
+	msg.Tags = map[string]string{"campaign": "c-1"}
+
+	m, f := newTestSES(t, "ses", `"default_tags": {"env": "prod"}`)
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	form := f.requests()[0].form
+	if form.Get("Tags.member.1.Name") != "campaign" || form.Get("Tags.member.1.Value") != "c-1" ||
+		form.Get("Tags.member.2.Name") != "env" || form.Get("Tags.member.2.Value") != "prod" {
+		t.Errorf("got tags %v", form)
+	}
+
+	// Invalid tags fail the send before it's made.
+	msg.Tags = map[string]string{"campaign": "spring sale"}
+	if _, err := m.Push(context.Background(), msg); err == nil {
+		t.Error("expected an error for an invalid tag")
+	}
+	if n := len(f.requests()); n != 1 {
+		t.Errorf("got %d requests", n)
+	}
+}
+
+func TestSESv2Push(t *testing.T) {
+	m, f := newTestSES(t, "sesv2", `"return_path": "bounces@example.com"`)
+	if m.Name() != "sesv2" {
+		t.Errorf("got Name %q", m.Name())
+	}
+
+	res, err := m.PushDetailed(context.Background(), sesTestMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MessageID != "m-1" || res.Provider != "sesv2" || res.Accepted != 1 || len(res.Raw) == 0 {
+		t.Errorf("got result %+v", res)
+	}
+
+	req := f.requests()[0]
+	if req.action != "POST /v2/email/outbound-emails" {
+		t.Fatalf("got request %s", req.action)
+	}
+	var in struct {
+		FromEmailAddress               string
+		FeedbackForwardingEmailAddress string
+		Content                        struct{ Raw struct{ Data []byte } }
+	}
+	if err := json.Unmarshal(req.body, &in); err != nil {
+		t.Fatal(err)
+	}
+	if in.FromEmailAddress != "sender@example.com" || in.FeedbackForwardingEmailAddress != "bounces@example.com" {
+		t.Errorf("got request %s", req.body)
+	}
+	h, parts := parseEmail(t, in.Content.Raw.Data)
+	if h.Get("Subject") != "Hello" || len(parts) != 1 {
+		t.Errorf("got raw message %s", in.Content.Raw.Data)
+	}
+}
+
+func TestSESEndpoint(t *testing.T) {
+	m, f := newTestSES(t, "ses", "")
+
+	// The credentials check is skipped for custom endpoints.
+	if n := len(f.requests()); n != 0 {
+		t.Fatalf("got %d requests on creation", n)
+	}
+	if got := aws.StringValue(m.client.Config.Endpoint); got != f.srv.URL {
+		t.Errorf("got endpoint %q", got)
+	}
+
+	if _, err := m.Push(context.Background(), sesTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := f.requests(); len(reqs) != 1 || reqs[0].action != "SendRawEmail" {
+		t.Errorf("got requests %+v", reqs)
+	}
+}
+
+func TestSESMessageTooLarge(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"max_message_bytes": 2048`)
+	if m.cfg.MaxMessageBytes != 2048 {
+		t.Fatalf("got MaxMessageBytes %d", m.cfg.MaxMessageBytes)
+	}
+
+	msg := sesTestMessage()
+	msg.Body = []byte(strings.Repeat("x", 4096))
+	if _, err := m.Push(context.Background(), msg); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got %v, want ErrMessageTooLarge", err)
+	}
+	if n := len(f.requests()); n != 0 {
+		t.Errorf("got %d requests for an oversized message", n)
+	}
+
+	// The limit defaults to SES's.
+	m, _ = newTestSES(t, "ses", "")
+	if m.cfg.MaxMessageBytes != sesMaxMessageBytes {
+		t.Errorf("got default MaxMessageBytes %d", m.cfg.MaxMessageBytes)
+	}
+}
+
+func TestSESRateLimit(t *testing.T) {
+	m, _ := newTestSES(t, "ses", `"rate_limit": 14.5`)
+	if m.limiter.Limit() != 14.5 || m.limiter.Burst() != 14 {
+		t.Errorf("got limit %v with burst %d", m.limiter.Limit(), m.limiter.Burst())
+	}
+	m, _ = newTestSES(t, "ses", `"rate_limit": 0.5`)
+	if m.limiter.Burst() != 1 {
+		t.Errorf("got burst %d", m.limiter.Burst())
+	}
+	if m, _ = newTestSES(t, "ses", ""); m.limiter != nil {
+		t.Error("limiter set without a rate_limit")
+	}
+
+	// Sends beyond the burst wait for the limiter.
+	m, f := newTestSES(t, "ses", `"rate_limit": 1`)
+	if _, err := m.Push(context.Background(), sesTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Push(ctx, sesTestMessage()); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("got %v, want a rate limit error", err)
+	}
+	if n := len(f.requests()); n != 1 {
+		t.Errorf("got %d requests", n)
+	}
+}
+
+func TestSESPushBatch(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"template_name": "welcome"`)
+
+	var msgs []Message
+	for i := 0; i < sesMaxBulkDestinations+3; i++ {
+		msg := sesTestMessage()
+		msg.Subscriber.Email = fmt.Sprintf("to-%d@example.com", i)
+		msg.TemplateData = map[string]interface{}{"n": i}
+		msgs = append(msgs, msg)
+	}
+	msgs[1].Subscriber.Email = "reject@example.com"
+	msgs[2].Subscriber.Email = "not an address"
+	// A different template is sent in a bulk call of its own.
+	msgs[3].Template = "reminder"
+
+	ids, err := m.PushBatch(context.Background(), msgs)
+	if err == nil || !strings.Contains(err.Error(), "message 1: MessageRejected: rejected") || !strings.Contains(err.Error(), "message 2:") {
+		t.Errorf("got %v", err)
+	}
+	if len(ids) != len(msgs) {
+		t.Fatalf("got %d ids", len(ids))
+	}
+	if ids[0] != "m-1-1" || ids[1] != "" || ids[2] != "" || ids[3] != "m-3-1" || ids[4] != "m-1-3" || ids[len(ids)-1] != "m-2-1" {
+		t.Errorf("got ids %v", ids)
+	}
+
+	reqs := f.requests()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d requests, want 3", len(reqs))
+	}
+	for i, want := range []struct {
+		tpl   string
+		count int
+	}{{"welcome", sesMaxBulkDestinations}, {"welcome", 1}, {"reminder", 1}} {
+		r := reqs[i]
+		if r.action != "SendBulkTemplatedEmail" || r.form.Get("Template") != want.tpl || r.form.Get("Source") != "sender@example.com" {
+			t.Errorf("request %d: got %s %v", i, r.action, r.form)
+		}
+		n := 0
+		for r.form.Has(fmt.Sprintf("Destinations.member.%d.Destination.ToAddresses.member.1", n+1)) {
+			n++
+		}
+		if n != want.count {
+			t.Errorf("request %d: got %d destinations, want %d", i, n, want.count)
+		}
+	}
+	if got := reqs[0].form.Get("Destinations.member.1.ReplacementTemplateData"); got != `{"n":0}` {
+		t.Errorf("got template data %s", got)
+	}
+}
+
+func TestSESPushBatchReplyTo(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"template_name": "welcome"`)
+
+	// Messages with different Reply-To addresses go in separate calls.
+	msgs := []Message{sesTestMessage(), sesTestMessage(), sesTestMessage()}
+	msgs[0].ReplyTo = []string{"support@example.com"}
+	msgs[2].ReplyTo = []string{"support@example.com"}
+	if _, err := m.PushBatch(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := f.requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	for i, want := range []struct {
+		replyTo string
+		dest    int
+	}{{"support@example.com", 2}, {"", 1}} {
+		r := reqs[i]
+		if got := r.form.Get("ReplyToAddresses.member.1"); got != want.replyTo {
+			t.Errorf("request %d: got Reply-To %q, want %q", i, got, want.replyTo)
+		}
+		for d := 1; d <= want.dest; d++ {
+			// Messages without template data send an empty object.
+			if got := r.form.Get(fmt.Sprintf("Destinations.member.%d.ReplacementTemplateData", d)); got != "{}" {
+				t.Errorf("request %d: got template data %q for destination %d", i, got, d)
+			}
+		}
+		if r.form.Has(fmt.Sprintf("Destinations.member.%d.Destination.ToAddresses.member.1", want.dest+1)) {
+			t.Errorf("request %d: more than %d destinations", i, want.dest)
+		}
+	}
+}
+
+func TestSESPushBatchUntemplated(t *testing.T) {
+	// Messages without a template are sent one at a time.
+	m, f := newTestSES(t, "ses", "")
+	ids, err := m.PushBatch(context.Background(), []Message{sesTestMessage(), sesTestMessage()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "m-1,m-2" {
+		t.Errorf("got ids %v", ids)
+	}
+	for _, r := range f.requests() {
+		if r.action != "SendRawEmail" {
+			t.Errorf("got %s", r.action)
+		}
+	}
+}
+
+func TestSESCheckSuppression(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"check_suppression": true`)
+
+	if _, err := m.Push(context.Background(), sesTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := sesTestMessage()
+	msg.Subscriber.Email = "suppressed@example.com"
+	_, err := m.Push(context.Background(), msg)
+	if !errors.Is(err, ErrSuppressed) || !strings.Contains(err.Error(), "BOUNCE") {
+		t.Errorf("got %v, want ErrSuppressed", err)
+	}
+
+	var actions []string
+	for _, r := range f.requests() {
+		actions = append(actions, r.action)
+	}
+	want := "GET /v2/email/suppression/addresses/to@example.com,SendRawEmail,GET /v2/email/suppression/addresses/suppressed@example.com"
+	if strings.Join(actions, ",") != want {
+		t.Errorf("got requests %v", actions)
+	}
+
+	// The list isn't checked unless it's enabled.
+	m, f = newTestSES(t, "ses", "")
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.requests()); n != 1 {
+		t.Errorf("got %d requests", n)
+	}
+}
+
+func TestSESCheckSuppressionBatch(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"check_suppression": true, "template_name": "welcome"`)
+
+	msgs := []Message{sesTestMessage(), sesTestMessage(), sesTestMessage()}
+	msgs[1].Subscriber.Email = "suppressed@example.com"
+	msgs[2].Subscriber.Email = "other@example.com"
+
+	ids, err := m.PushBatch(context.Background(), msgs)
+	if !errors.Is(err, ErrSuppressed) || !strings.Contains(err.Error(), "message 1: ") {
+		t.Errorf("got %v, want ErrSuppressed for message 1", err)
+	}
+	if strings.Join(ids, ",") != "m-4-1,,m-4-2" {
+		t.Errorf("got ids %v", ids)
+	}
+
+	// The suppressed address is left out of the bulk send.
+	reqs := f.requests()
+	bulk := reqs[len(reqs)-1]
+	if bulk.action != "SendBulkTemplatedEmail" {
+		t.Fatalf("got %s", bulk.action)
+	}
+	var dest []string
+	for i := 1; bulk.form.Has(fmt.Sprintf("Destinations.member.%d.Destination.ToAddresses.member.1", i)); i++ {
+		dest = append(dest, bulk.form.Get(fmt.Sprintf("Destinations.member.%d.Destination.ToAddresses.member.1", i)))
+	}
+	if strings.Join(dest, ",") != "to@example.com,other@example.com" {
+		t.Errorf("got destinations %v", dest)
+	}
+}
+
+func TestSESFromRotation(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"from_rotation": ["a@example.com", "Team B <b@example.com>"]`)
+
+	campaign := sesTestMessage()
+	campaign.Campaign = &models.Campaign{FromEmail: "campaign@example.com"}
+	msgs := []Message{sesTestMessage(), sesTestMessage(), campaign, sesTestMessage()}
+	for _, msg := range msgs {
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A campaign's own From address isn't rotated and doesn't take a turn.
+	want := []string{"a@example.com", "b@example.com", "campaign@example.com", "a@example.com"}
+	for i, req := range f.requests() {
+		h, _ := parseEmail(t, req.rawEmail(t))
+		if got := h.Get("From"); !strings.Contains(got, want[i]) {
+			t.Errorf("message %d: got From %q, want %s", i, got, want[i])
+		}
+	}
+
+	if _, err := NewAWSSES([]byte(`{"region": "us-east-1", "endpoint": "http://localhost", "from_rotation": ["not an address"]}`), onelog.New(io.Discard, 0)); err == nil {
+		t.Error("expected an error for an invalid from_rotation address")
+	}
+}
+
+func TestSESFromRotationConcurrent(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"from_rotation": ["a@example.com", "b@example.com", "c@example.com"]`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Push(context.Background(), sesTestMessage()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Concurrent sends are spread evenly across the addresses.
+	counts := map[string]int{}
+	for _, req := range f.requests() {
+		h, _ := parseEmail(t, req.rawEmail(t))
+		counts[h.Get("From")]++
+	}
+	want := map[string]int{"<a@example.com>": 34, "<b@example.com>": 33, "<c@example.com>": 33}
+	if fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("got From counts %v, want %v", counts, want)
+	}
+}
+
+func TestSESTransport(t *testing.T) {
+	m, _ := newTestSES(t, "ses", `"max_idle_conns": 50, "max_idle_conns_per_host": 20, "idle_conn_timeout": "2m"`)
+	if tr := m.transport; tr.MaxIdleConns != 50 || tr.MaxIdleConnsPerHost != 20 || tr.IdleConnTimeout != 2*time.Minute {
+		t.Errorf("got MaxIdleConns %d, MaxIdleConnsPerHost %d, IdleConnTimeout %v", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+
+	// Unset options keep the transport's defaults.
+	m, _ = newTestSES(t, "ses", "")
+	def := newHTTPTransport()
+	if tr := m.transport; tr.MaxIdleConns != def.MaxIdleConns || tr.MaxIdleConnsPerHost != def.MaxIdleConnsPerHost || tr.IdleConnTimeout != def.IdleConnTimeout {
+		t.Errorf("got MaxIdleConns %d, MaxIdleConnsPerHost %d, IdleConnTimeout %v", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+
+	for _, c := range []sesCfg{
+		{MaxIdleConns: -1},
+		{MaxIdleConnsPerHost: -1},
+		{IdleConnTimeout: "soon"},
+	} {
+		if _, err := newSESTransport(c); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
+
+func TestSESIPPool(t *testing.T) {
+	for _, name := range []string{"ses", "sesv2"} {
+		m, f := newTestSES(t, name, `"configuration_set": "pool-dedicated", "ip_pool_name": "dedicated"`)
+
+		// The pool of the configuration set is checked on creation.
+		reqs := f.requests()
+		if len(reqs) != 1 || reqs[0].action != "GET /v2/email/configuration-sets/pool-dedicated" {
+			t.Fatalf("%s: got requests %+v", name, reqs)
+		}
+
+		// Mail is sent with the configuration set, which routes it
+		// through the pool.
+		if _, err := m.Push(context.Background(), sesTestMessage()); err != nil {
+			t.Fatal(err)
+		}
+		req := f.requests()[1]
+		switch name {
+		case "ses":
+			h, _ := parseEmail(t, req.rawEmail(t))
+			if got := h.Get(hdrSESConfigurationSet); got != "pool-dedicated" {
+				t.Errorf("got %s %q", hdrSESConfigurationSet, got)
+			}
+		case "sesv2":
+			var in struct{ ConfigurationSetName string }
+			if err := json.Unmarshal(req.body, &in); err != nil {
+				t.Fatal(err)
+			}
+			if in.ConfigurationSetName != "pool-dedicated" {
+				t.Errorf("got ConfigurationSetName %q", in.ConfigurationSetName)
+			}
+		}
+
+		if err := m.HealthCheck(context.Background()); err != nil {
+			t.Errorf("%s: health check: %v", name, err)
+		}
+	}
+}
+
+func TestSESIPPoolInvalid(t *testing.T) {
+	f := newFakeSES(t)
+	for _, cfg := range []string{
+		`"ip_pool_name": "dedicated"`,
+		// The configuration set sends from the shared pool.
+		`"configuration_set": "tracking", "ip_pool_name": "dedicated"`,
+		`"configuration_set": "pool-other", "ip_pool_name": "dedicated"`,
+	} {
+		for _, name := range []string{"ses", "sesv2"} {
+			_, err := NewRegistry().New(name, []byte(fmt.Sprintf(`{"region": "us-east-1", "access_key": "a", "secret_key": "s", "endpoint": %q, %s}`, f.srv.URL, cfg)), onelog.New(io.Discard, 0))
+			if err == nil {
+				t.Errorf("%s %s: expected an error", name, cfg)
+			}
+		}
+	}
+}
+
+func TestSESDryRun(t *testing.T) {
+	for _, name := range []string{"ses", "sesv2"} {
+		m, f := newTestSES(t, name, `"dry_run": true`)
+
+		id, err := m.Push(context.Background(), sesTestMessage())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasPrefix(id, "dryrun-") {
+			t.Errorf("%s: got message ID %q", name, id)
+		}
+
+		ids, err := m.PushBatch(context.Background(), []Message{sesTestMessage(), sesTestMessage()})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, id := range ids {
+			if !strings.HasPrefix(id, "dryrun-") {
+				t.Errorf("%s: got batch message ID %q", name, id)
+			}
+		}
+
+		if n := len(f.requests()); n != 0 {
+			t.Errorf("%s: got %d requests in dry run mode", name, n)
+		}
+	}
+}
+
+func TestSESHealthCheck(t *testing.T) {
+	for name, action := range map[string]string{"ses": "GetSendQuota", "sesv2": "GET /v2/email/account"} {
+		m, f := newTestSES(t, name, "")
+
+		if err := m.HealthCheck(context.Background()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if reqs := f.requests(); len(reqs) != 1 || reqs[0].action != action {
+			t.Errorf("%s: got requests %+v, want %s", name, reqs, action)
+		}
+
+		f.mu.Lock()
+		f.errCode = "AccessDenied"
+		f.mu.Unlock()
+		if err := m.HealthCheck(context.Background()); !errors.Is(err, ErrAuth) {
+			t.Errorf("%s: got %v, want ErrAuth", name, err)
+		}
+	}
+}
+
+func TestSESPushDetailed(t *testing.T) {
+	msg := sesTestMessage()
+	msg.Cc = []string{"cc@example.com"}
+
+	m, _ := newTestSES(t, "ses", "")
+	start := time.Now()
+	res, err := m.PushDetailed(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.MessageID != "m-1" || res.Provider != "ses" {
+		t.Errorf("got result %+v", res)
+	}
+	if res.Accepted != 2 || strings.Join(res.Recipients, ",") != "to@example.com,cc@example.com" {
+		t.Errorf("got recipients %v (%d accepted)", res.Recipients, res.Accepted)
+	}
+	if res.Timestamp.Before(start) {
+		t.Errorf("got timestamp %v before the send", res.Timestamp)
+	}
+
+	var raw struct{ MessageId string }
+	if err := json.Unmarshal(res.Raw, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.MessageId != "m-1" {
+		t.Errorf("got raw response %s", res.Raw)
+	}
+
+	// Push returns the same message ID.
+	if id, err := m.Push(context.Background(), msg); err != nil || id != "m-2" {
+		t.Errorf("got %q, %v from Push", id, err)
+	}
+}
+
+func TestSESDefaultFromName(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"default_from_name": "Zoë Müller"`)
+
+	cases := []struct {
+		from, wantName string
+	}{
+		{"sender@example.com", "Zoë Müller"},
+		// Names set on the campaign take precedence.
+		{"Newsletter <sender@example.com>", "Newsletter"},
+	}
+	for i, c := range cases {
+		msg := sesTestMessage()
+		msg.Campaign = &models.Campaign{FromEmail: c.from}
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+
+		h, _ := parseEmail(t, f.requests()[i].rawEmail(t))
+		from := h.Get("From")
+		for _, r := range from {
+			if r > 127 {
+				t.Errorf("got non-ASCII From header %q", from)
+				break
+			}
+		}
+		addr, err := h.AddressList("From")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addr) != 1 || addr[0].Name != c.wantName || addr[0].Address != "sender@example.com" {
+			t.Errorf("got From %q, want %s <sender@example.com>", from, c.wantName)
+		}
+	}
+}
+
+func TestSESFrom(t *testing.T) {
+	cases := []struct {
+		name     string
+		campaign *models.Campaign
+		from     string
+		want     string
+	}{
+		{"campaign", &models.Campaign{FromEmail: "campaign@example.com"}, "sender@example.com", "campaign@example.com"},
+		{"campaign without from", &models.Campaign{}, "sender@example.com", "sender@example.com"},
+		{"no campaign", nil, "sender@example.com", "sender@example.com"},
+		{"no from", &models.Campaign{}, "", ""},
+	}
+	for _, c := range cases {
+		m, f := newTestSES(t, "ses", "")
+
+		msg := sesTestMessage()
+		msg.Campaign = c.campaign
+		msg.From = c.from
+		_, err := m.Push(context.Background(), msg)
+		if c.want == "" {
+			if !errors.Is(err, errMissingFrom) {
+				t.Errorf("%s: got %v, want errMissingFrom", c.name, err)
+			}
+			if n := len(f.requests()); n != 0 {
+				t.Errorf("%s: got %d requests", c.name, n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		h, _ := parseEmail(t, f.requests()[0].rawEmail(t))
+		if got := h.Get("From"); got != "<"+c.want+">" {
+			t.Errorf("%s: got From %q, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSESInvalidRecipient(t *testing.T) {
+	for _, name := range []string{"ses", "sesv2"} {
+		m, f := newTestSES(t, name, "")
+
+		for _, addr := range []string{"", "not-an-email", "a@b@example.com"} {
+			msg := sesTestMessage()
+			msg.Subscriber.Email = addr
+			_, err := m.Push(context.Background(), msg)
+			if !errors.Is(err, ErrInvalidRecipient) {
+				t.Errorf("%s %q: got %v, want ErrInvalidRecipient", name, addr, err)
+			}
+			if addr != "" && (err == nil || !strings.Contains(err.Error(), addr)) {
+				t.Errorf("%s %q: error doesn't name the address: %v", name, addr, err)
+			}
+		}
+		if n := len(f.requests()); n != 0 {
+			t.Errorf("%s: got %d requests", name, n)
+		}
+	}
+}
+
+func TestSESTemplated(t *testing.T) {
+	msg := sesTestMessage()
+	msg.TemplateData = map[string]interface{}{"name": "Jane", "plan": "pro"}
+
+	m, f := newTestSES(t, "ses", `"template_name": "welcome"`)
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "m-1" {
+		t.Errorf("got message ID %q", id)
+	}
+	req := f.requests()[0]
+	if req.action != "SendTemplatedEmail" || req.form.Get("Template") != "welcome" || req.form.Get("Source") != "sender@example.com" {
+		t.Errorf("got request %s %v", req.action, req.form)
+	}
+	if got := req.form.Get("TemplateData"); got != `{"name":"Jane","plan":"pro"}` {
+		t.Errorf("got TemplateData %s", got)
+	}
+
+	m, f = newTestSES(t, "sesv2", `"template_name": "welcome"`)
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	var in struct {
+		Content struct {
+			Template struct{ TemplateName, TemplateData string }
+		}
+	}
+	if err := json.Unmarshal(f.requests()[0].body, &in); err != nil {
+		t.Fatal(err)
+	}
+	if tpl := in.Content.Template; tpl.TemplateName != "welcome" || tpl.TemplateData != `{"name":"Jane","plan":"pro"}` {
+		t.Errorf("got template %+v", tpl)
+	}
+
+	// Data that can't be encoded as JSON fails before sending.
+	msg.TemplateData = map[string]interface{}{"ch": make(chan int)}
+	if _, err := m.Push(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "template data") {
+		t.Errorf("got %v, want a template data error", err)
+	}
+	if n := len(f.requests()); n != 1 {
+		t.Errorf("got %d requests", n)
+	}
+}
+
+func TestSESAttachmentLimits(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"max_attachments": 2, "max_total_attachment_bytes": 100`)
+
+	file := func(name string, size int) Attachment {
+		return Attachment{Name: name, Content: []byte(strings.Repeat("x", size))}
+	}
+	for _, c := range []struct {
+		name  string
+		files []Attachment
+		want  string
+	}{
+		{"count", []Attachment{file("a.txt", 1), file("b.txt", 1), file("c.txt", 1)}, "3 attachments exceeds the limit of 2"},
+		{"size", []Attachment{file("a.txt", 60), file("b.txt", 60)}, "120 bytes of attachments exceeds the limit of 100"},
+	} {
+		msg := sesTestMessage()
+		msg.Attachments = c.files
+		_, err := m.Push(context.Background(), msg)
+		if !errors.Is(err, ErrMessageTooLarge) || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want ErrMessageTooLarge: %s", c.name, err, c.want)
+		}
+	}
+	if n := len(f.requests()); n != 0 {
+		t.Errorf("got %d requests", n)
+	}
+
+	// Attachments within both limits are sent.
+	msg := sesTestMessage()
+	msg.Attachments = []Attachment{file("a.txt", 50), file("b.txt", 50)}
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ = newTestSES(t, "ses", "")
+	if m.cfg.MaxAttachments != sesMaxAttachments || m.cfg.MaxTotalAttachmentBytes != sesMaxTotalAttachmentBytes {
+		t.Errorf("got default limits %d, %d", m.cfg.MaxAttachments, m.cfg.MaxTotalAttachmentBytes)
+	}
+}
+
+func TestSESDetectContentType(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		contentType string
+		body        string
+		wantHTML    bool
+	}{
+		{"html", "", "<html><body><p>Hello</p></body></html>", true},
+		{"plain", "", "Hello, 1 < 2 and 3 > 2", false},
+		// An explicit content type is authoritative.
+		{"explicit plain", ContentTypePlain, "<p>Hello</p>", false},
+	} {
+		m, f := newTestSES(t, "ses", "")
+
+		msg := sesTestMessage()
+		msg.ContentType = c.contentType
+		msg.Body = []byte(c.body)
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		_, parts := parseEmail(t, f.requests()[0].rawEmail(t))
+		var html bool
+		for _, p := range parts {
+			if strings.HasPrefix(p.header.Get("Content-Type"), "text/html") {
+				html = true
+			}
+		}
+		if html != c.wantHTML {
+			t.Errorf("%s: got HTML part %v, want %v", c.name, html, c.wantHTML)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/aws/aws-sdk-go/service/sesv2"
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/smtppool"
+)
+
+// sendV2 pushes the raw message through the SESv2 SendEmail API.
+func (s sesMessenger) sendV2(ctx context.Context, email smtppool.Email, tags []*ses.MessageTag, raw []byte) (Result, error) {
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: &email.From,
+		Destination: &sesv2.Destination{
+			ToAddresses:  aws.StringSlice(email.To),
+			CcAddresses:  aws.StringSlice(email.Cc),
+			BccAddresses: aws.StringSlice(email.Bcc),
+		},
+		Content: &sesv2.EmailContent{
+			Raw: &sesv2.RawMessage{
+				Data: raw,
+			},
+		},
+	}
+	if s.cfg.ConfigurationSet != "" {
+		input.ConfigurationSetName = &s.cfg.ConfigurationSet
+	}
+	if s.cfg.ReturnPath != "" {
+		input.FeedbackForwardingEmailAddress = &s.cfg.ReturnPath
+	}
+	for _, t := range tags {
+		input.EmailTags = append(input.EmailTags, &sesv2.MessageTag{Name: t.Name, Value: t.Value})
+	}
+
+	out, err := s.clientV2.SendEmailWithContext(ctx, input)
+	if err != nil {
+		return Result{}, err
+	}
+
+	s.logger.DebugWith("sesv2 response").String("results", fmt.Sprintf("%#+v", out)).Write()
+
+	rawOut, _ := json.Marshal(out)
+	return Result{MessageID: aws.StringValue(out.MessageId), Raw: rawOut}, nil
+}
+
+// checkSuppressed returns ErrSuppressed if the address is on the account's
+// suppression list.
+func (s sesMessenger) checkSuppressed(ctx context.Context, addr string) error {
+	out, err := s.suppression.GetSuppressedDestinationWithContext(ctx, &sesv2.GetSuppressedDestinationInput{
+		EmailAddress: aws.String(addr),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == sesv2.ErrCodeNotFoundException {
+			return nil
+		}
+		return fmt.Errorf("error checking suppression list: %w", wrapAWSError(err))
+	}
+
+	reason := ""
+	if out.SuppressedDestination != nil {
+		reason = aws.StringValue(out.SuppressedDestination.Reason)
+	}
+	return fmt.Errorf("%w: %s (%s)", ErrSuppressed, addr, reason)
+}
+
+// checkIPPool returns an error if the configuration set isn't assigned to
+// the configured dedicated IP pool.
+func (s sesMessenger) checkIPPool(ctx context.Context) error {
+	out, err := s.pools.GetConfigurationSetWithContext(ctx, &sesv2.GetConfigurationSetInput{
+		ConfigurationSetName: aws.String(s.cfg.ConfigurationSet),
+	})
+	if err != nil {
+		return fmt.Errorf("error checking configuration set: %w", wrapAWSError(err))
+	}
+
+	pool := ""
+	if out.DeliveryOptions != nil {
+		pool = aws.StringValue(out.DeliveryOptions.SendingPoolName)
+	}
+	if pool != s.cfg.IPPoolName {
+		return fmt.Errorf("configuration set %s sends from ip pool %q instead of %q", s.cfg.ConfigurationSet, pool, s.cfg.IPPoolName)
+	}
+	return nil
+}
+
+// NewAWSSESv2 creates new instance of ses that sends through the SESv2 API.
+func NewAWSSESv2(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	s, sess, err := newSESMessenger(cfg, l)
+	if err != nil {
+		return nil, err
+	}
+
+	s.clientV2 = sesv2.New(sess)
+	return s, nil
+}
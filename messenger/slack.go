@@ -0,0 +1,145 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/francoispqt/onelog"
+)
+
+type slackCfg struct {
+	WebhookURL string `json:"webhook_url"`
+
+	// WebhookURLAttribute is an optional subscriber attribute holding a
+	// per-subscriber webhook URL that overrides WebhookURL.
+	WebhookURLAttribute string `json:"webhook_url_attribute"`
+	httpClientCfg
+	logCfg
+}
+
+type slackMessenger struct {
+	cfg    slackCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type string    `json:"type"`
+	Text slackText `json:"text"`
+}
+
+type slackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+func (s slackMessenger) Name() string {
+	return "slack"
+}
+
+// Push posts the message to the Slack incoming webhook.
+func (s slackMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	s.logger.DebugWith("sending message").String("email", s.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	url := s.cfg.WebhookURL
+	if s.cfg.WebhookURLAttribute != "" {
+		if u, ok := msg.Subscriber.Attribs[s.cfg.WebhookURLAttribute].(string); ok && u != "" {
+			url = u
+		}
+	}
+	if url == "" {
+		return "", fmt.Errorf("could not find slack webhook url")
+	}
+
+	payload := slackPayload{Text: msg.Subject}
+	if msg.Subject != "" {
+		payload.Blocks = append(payload.Blocks, slackBlock{
+			Type: "header",
+			Text: slackText{Type: "plain_text", Text: msg.Subject},
+		})
+	}
+	payload.Blocks = append(payload.Blocks, slackBlock{
+		Type: "section",
+		Text: slackText{Type: "mrkdwn", Text: string(msg.Body)},
+	})
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "slack"); err != nil {
+		return "", err
+	}
+
+	// Slack responds with plain text, eg: "ok" or "invalid_payload".
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("slack returned status %d: %s", resp.StatusCode, body)
+	}
+
+	s.logger.InfoWith("successfully sent slack message").String("subject", msg.Subject).Write()
+
+	return "", nil
+}
+
+func (s slackMessenger) Flush() error {
+	return nil
+}
+
+func (s slackMessenger) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// NewSlack creates new instance of slack
+func NewSlack(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c slackCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.WebhookURL == "" && c.WebhookURLAttribute == "" {
+		return nil, fmt.Errorf("invalid webhook_url or webhook_url_attribute")
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return slackMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestSlackPush(t *testing.T) {
+	var (
+		path string
+		body []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		body, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	m, err := NewSlack([]byte(fmt.Sprintf(`{"webhook_url": "%s/default", "webhook_url_attribute": "slack_url"}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Push(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/default" {
+		t.Errorf("got request to %s", path)
+	}
+
+	var got, want any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	_ = json.Unmarshal([]byte(`{
+		"text": "Hello",
+		"blocks": [
+			{"type": "header", "text": {"type": "plain_text", "text": "Hello"}},
+			{"type": "section", "text": {"type": "mrkdwn", "text": "<p>Hello</p>"}}
+		]
+	}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got payload %s", body)
+	}
+
+	// The subscriber's webhook URL takes precedence.
+	msg := testMessage()
+	msg.Subscriber.Attribs["slack_url"] = srv.URL + "/subscriber"
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/subscriber" {
+		t.Errorf("got request to %s", path)
+	}
+}
+
+func TestSlackPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("invalid_blocks"))
+	}))
+	defer srv.Close()
+
+	m, err := NewSlack([]byte(fmt.Sprintf(`{"webhook_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "invalid_blocks") {
+		t.Errorf("got %v, want the slack error", err)
+	}
+}
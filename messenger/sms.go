@@ -0,0 +1,49 @@
+package messenger
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	smsEncodingGSM7 = "GSM-7"
+	smsEncodingUCS2 = "UCS-2"
+)
+
+const (
+	// gsm7Chars is the GSM 03.38 basic character set.
+	gsm7Chars = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+	// gsm7ExtChars are in the GSM 03.38 extension table and take two
+	// septets (escape + char) each.
+	gsm7ExtChars = "^{}\\[~]|€\f"
+)
+
+// smsSegments returns the encoding required for the SMS body and the number
+// of segments it's split into. Concatenated messages lose space to the
+// UDH, leaving 153 GSM-7 or 67 UCS-2 characters per segment.
+func smsSegments(body string) (int, string) {
+	septets := 0
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Chars, r):
+			septets++
+		case strings.ContainsRune(gsm7ExtChars, r):
+			septets += 2
+		default:
+			return countSegments(len(utf16.Encode([]rune(body))), 70, 67), smsEncodingUCS2
+		}
+	}
+
+	return countSegments(septets, 160, 153), smsEncodingGSM7
+}
+
+// countSegments returns the number of segments n units split into given
+// the single and concatenated segment sizes.
+func countSegments(n, single, multi int) int {
+	if n <= single {
+		return 1
+	}
+	return (n + multi - 1) / multi
+}
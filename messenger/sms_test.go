@@ -0,0 +1,33 @@
+package messenger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSMSSegments(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		body     string
+		segments int
+		encoding string
+	}{
+		{"empty", "", 1, smsEncodingGSM7},
+		{"gsm7 single", strings.Repeat("a", 160), 1, smsEncodingGSM7},
+		{"gsm7 concatenated", strings.Repeat("a", 161), 2, smsEncodingGSM7},
+		{"gsm7 three", strings.Repeat("a", 307), 3, smsEncodingGSM7},
+		{"gsm7 accents", "Café à l'été", 1, smsEncodingGSM7},
+		{"extension chars count twice", strings.Repeat("€", 80), 1, smsEncodingGSM7},
+		{"extension chars overflow", strings.Repeat("€", 81), 2, smsEncodingGSM7},
+		{"ucs2 single", strings.Repeat("ç", 70), 1, smsEncodingUCS2},
+		{"ucs2 concatenated", strings.Repeat("ç", 71), 2, smsEncodingUCS2},
+		{"ucs2 mixed", "hello 👋", 1, smsEncodingUCS2},
+		// Characters outside the BMP take two UTF-16 units each.
+		{"ucs2 surrogates", strings.Repeat("👋", 36), 2, smsEncodingUCS2},
+	} {
+		segments, encoding := smsSegments(tc.body)
+		if segments != tc.segments || encoding != tc.encoding {
+			t.Errorf("%s: got %d %s segments, want %d %s", tc.name, segments, encoding, tc.segments, tc.encoding)
+		}
+	}
+}
@@ -0,0 +1,636 @@
+package messenger
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/smtppool"
+)
+
+const (
+	smtpTLSNone     = "none"
+	smtpTLSStartTLS = "starttls"
+	smtpTLSTLS      = "tls"
+)
+
+type smtpCfg struct {
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	HelloHostname string `json:"hello_hostname"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	TLSType       string `json:"tls_type"`
+	TLSSkipVerify bool   `json:"tls_skip_verify"`
+
+	// TLSCertFile and TLSKeyFile are an optional PEM client certificate and
+	// key for relays requiring mutual TLS. TLSCAFile is an optional PEM CA
+	// bundle to verify the server with instead of the system roots.
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+	TLSCAFile   string `json:"tls_ca_file"`
+
+	MaxConns    int    `json:"max_conns"`
+	IdleTimeout string `json:"idle_timeout"`
+	WaitTimeout string `json:"wait_timeout"`
+
+	// HealthCheckInterval, if set, periodically probes the server and
+	// recycles the pool's connections when the probe fails.
+	HealthCheckInterval string `json:"health_check_interval"`
+
+	// MaxConnAge, if set, recycles all of the pool's connections on Flush
+	// once the pool is older than it. The age is that of the pool, which is
+	// replaced on every recycle, not of individual connections.
+	MaxConnAge string `json:"max_conn_age"`
+
+	// FlushTimeout bounds how long Flush waits for in-flight sends.
+	FlushTimeout string `json:"flush_timeout"`
+
+	// DKIMDomain, DKIMSelector and DKIMPrivateKeyFile, if set, sign
+	// messages with DKIM using the PEM encoded RSA key in the file.
+	DKIMDomain         string `json:"dkim_domain"`
+	DKIMSelector       string `json:"dkim_selector"`
+	DKIMPrivateKeyFile string `json:"dkim_private_key_file"`
+
+	logCfg
+}
+
+type smtpMessenger struct {
+	cfg        smtpCfg
+	opt        smtppool.Opt
+	pool       *smtpPool
+	maxConnAge time.Duration
+
+	// dkim is nil when DKIM signing isn't configured.
+	dkim *dkimSigner
+
+	// inflight tracks the sends in progress for Flush.
+	inflight     *pending
+	flushTimeout time.Duration
+
+	// ctx is cancelled when the messenger is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger *levelLogger
+}
+
+// smtpPool is a pool of connections to the server, configured with the
+// same options as an smtppool.Pool. Unlike smtppool, which renders
+// messages itself on every send, it sends messages that are already
+// rendered, so that they can be DKIM signed first.
+type smtpPool struct {
+	// mu is held for reading by sends and for writing while the
+	// connections are recycled or closed, so that neither happens to a
+	// connection that is in use.
+	mu      sync.RWMutex
+	created time.Time
+	closed  bool
+
+	// slots caps the connections at max_conns and idle keeps them for
+	// reuse.
+	slots chan struct{}
+	idle  chan *smtpConn
+
+	dial        func(ctx context.Context) (*smtp.Client, error)
+	idleTimeout time.Duration
+	waitTimeout time.Duration
+}
+
+// smtpConn is a pooled connection.
+type smtpConn struct {
+	*smtp.Client
+	lastUsed time.Time
+}
+
+// newSMTPPool creates a pool of up to opt.MaxConns connections made with
+// dial.
+func newSMTPPool(opt smtppool.Opt, dial func(ctx context.Context) (*smtp.Client, error)) *smtpPool {
+	// Mirror smtppool's 2s default wait timeout.
+	wait := opt.PoolWaitTimeout
+	if wait < time.Second {
+		wait = 2 * time.Second
+	}
+
+	return &smtpPool{
+		created:     time.Now(),
+		slots:       make(chan struct{}, opt.MaxConns),
+		idle:        make(chan *smtpConn, opt.MaxConns),
+		dial:        dial,
+		idleTimeout: opt.IdleTimeout,
+		waitTimeout: wait,
+	}
+}
+
+// send sends the rendered message to the recipients over a pooled
+// connection.
+func (p *smtpPool) send(ctx context.Context, from string, rcpts []string, msg []byte) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+
+	wait := time.NewTimer(p.waitTimeout)
+	defer wait.Stop()
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("error sending email: %w", ctx.Err())
+	case <-wait.C:
+		return errors.New("timed out waiting for a free connection")
+	}
+	defer func() { <-p.slots }()
+
+	c, err := p.conn(ctx)
+	if err != nil {
+		return err
+	}
+	if err := sendRaw(c.Client, from, rcpts, msg); err != nil {
+		// Errors replied by the server leave the connection usable, any
+		// other means it's broken.
+		var perr *textproto.Error
+		if errors.As(err, &perr) {
+			p.put(c)
+		} else {
+			c.Close()
+		}
+		return err
+	}
+
+	p.put(c)
+	return nil
+}
+
+// conn returns an idle connection that's still alive or dials a new one.
+// Connections dropped by the server while idle fail the reset and are
+// replaced.
+func (p *smtpPool) conn(ctx context.Context) (*smtpConn, error) {
+	for {
+		select {
+		case c := <-p.idle:
+			if p.idleTimeout > 0 && time.Since(c.lastUsed) > p.idleTimeout {
+				c.Close()
+				continue
+			}
+			if err := c.Reset(); err != nil {
+				c.Close()
+				continue
+			}
+			return c, nil
+		default:
+			c, err := p.dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return &smtpConn{Client: c}, nil
+		}
+	}
+}
+
+// put returns a connection to the pool.
+func (p *smtpPool) put(c *smtpConn) {
+	c.lastUsed = time.Now()
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+// closeIdle closes the idle connections that haven't been used for maxIdle,
+// or all of them if maxIdle is 0.
+func (p *smtpPool) closeIdle(maxIdle time.Duration) {
+	for n := len(p.idle); n > 0; n-- {
+		var c *smtpConn
+		select {
+		case c = <-p.idle:
+		default:
+			return
+		}
+
+		if maxIdle == 0 || time.Since(c.lastUsed) > maxIdle {
+			c.Close()
+			continue
+		}
+		p.put(c)
+	}
+}
+
+func (s smtpMessenger) Name() string {
+	return "smtp"
+}
+
+// Push renders the email, signs it if DKIM is configured, and sends it
+// through the SMTP pool.
+func (s smtpMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	s.logger.DebugWith("sending message").String("email", s.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("error sending email: %w", err)
+	}
+
+	if err := validateHeaders(msg.Headers); err != nil {
+		return "", err
+	}
+
+	s.inflight.add()
+	defer s.inflight.done()
+
+	email := makeEmail(msg)
+	from, rcpts, err := smtpEnvelope(email)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := email.Bytes()
+	if err != nil {
+		return "", err
+	}
+	if s.dkim != nil {
+		if raw, err = s.dkim.sign(raw); err != nil {
+			return "", fmt.Errorf("error signing email: %w", err)
+		}
+	}
+
+	if err := s.pool.send(ctx, from, rcpts, raw); err != nil {
+		return "", err
+	}
+
+	s.logger.InfoWith("successfully sent email").String("email", s.logger.email(msg.Subscriber.Email)).Write()
+
+	return "", nil
+}
+
+// smtpEnvelope returns the envelope sender and recipients of the email.
+func smtpEnvelope(email smtppool.Email) (string, []string, error) {
+	sender := email.Sender
+	if sender == "" {
+		sender = email.From
+	}
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid from: %v", err)
+	}
+
+	var rcpts []string
+	for _, addrs := range [][]string{email.To, email.Cc, email.Bcc} {
+		for _, a := range addrs {
+			addr, err := mail.ParseAddress(a)
+			if err != nil {
+				return "", nil, fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+			}
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+	return from.Address, rcpts, nil
+}
+
+// HealthCheck opens a probe connection to the server, going through the
+// same TLS and auth handshake as the pool, and closes it.
+func (s smtpMessenger) HealthCheck(ctx context.Context) error {
+	c, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.Quit()
+}
+
+// dial connects to the server and goes through the TLS and auth
+// handshake. The handshake is bound by ctx's deadline.
+func (s smtpMessenger) dial(ctx context.Context) (*smtp.Client, error) {
+	// Mirror smtppool, which uses the wait timeout, defaulting to 2s, for
+	// new connections.
+	timeout := s.opt.PoolWaitTimeout
+	if timeout < time.Second {
+		timeout = 2 * time.Second
+	}
+
+	var (
+		addr = net.JoinHostPort(s.opt.Host, strconv.Itoa(s.opt.Port))
+		d    = &net.Dialer{Timeout: timeout}
+
+		conn net.Conn
+		err  error
+	)
+	if s.opt.SSL {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: s.opt.TLSConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.opt.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := s.handshake(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (s smtpMessenger) handshake(c *smtp.Client) error {
+	if s.opt.HelloHostname != "" {
+		if err := c.Hello(s.opt.HelloHostname); err != nil {
+			return err
+		}
+	}
+	if s.opt.TLSConfig != nil && !s.opt.SSL {
+		if err := c.StartTLS(s.opt.TLSConfig); err != nil {
+			return err
+		}
+	}
+	if s.opt.Auth != nil {
+		if err := c.Auth(s.opt.Auth); err != nil {
+			return fmt.Errorf("%w: %v", ErrAuth, err)
+		}
+	}
+	return nil
+}
+
+// sendRaw sends a rendered message over the connection.
+func sendRaw(c *smtp.Client, from string, rcpts []string, msg []byte) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, r := range rcpts {
+		if err := c.Rcpt(r); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// checkHealth probes the server every interval until the messenger is
+// closed, recycling the pool's connections when a probe fails.
+func (s smtpMessenger) checkHealth(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, interval)
+		err := s.HealthCheck(ctx)
+		cancel()
+		if err != nil && s.ctx.Err() == nil {
+			s.logger.ErrorWith("smtp health check failed, recycling connections").Err("error", err).Write()
+			s.recycle()
+		}
+	}
+}
+
+// sweepIdle closes the connections idle for longer than idle_timeout until
+// the messenger is closed.
+func (s smtpMessenger) sweepIdle(timeout time.Duration) {
+	t := time.NewTicker(timeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-t.C:
+			s.pool.closeIdle(timeout)
+		}
+	}
+}
+
+// recycle closes the pool's connections so that subsequent pushes use
+// fresh ones. It waits for the in-flight sends to finish first.
+func (s smtpMessenger) recycle() {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	if s.pool.closed {
+		return
+	}
+	s.pool.closeIdle(0)
+	s.pool.created = time.Now()
+}
+
+// Flush waits for in-flight sends to finish and then recycles the pool's
+// connections if the pool is older than max_conn_age. Messages are sent
+// synchronously so there is nothing buffered beyond the in-flight sends.
+func (s smtpMessenger) Flush() error {
+	if err := s.inflight.wait(s.flushTimeout); err != nil {
+		return err
+	}
+	if s.maxConnAge == 0 {
+		return nil
+	}
+
+	s.pool.mu.RLock()
+	created := s.pool.created
+	s.pool.mu.RUnlock()
+
+	if time.Since(created) > s.maxConnAge {
+		s.recycle()
+	}
+	return nil
+}
+
+// Close stops the health checks and closes the SMTP pool and all its
+// connections.
+func (s smtpMessenger) Close() error {
+	s.cancel()
+
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	s.pool.closed = true
+	s.pool.closeIdle(0)
+	return nil
+}
+
+// makeSMTPTLSConfig builds the TLS config for the connections, loading the
+// client certificate and the CA bundle if they're configured.
+func makeSMTPTLSConfig(c smtpCfg) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: c.Host, InsecureSkipVerify: c.TLSSkipVerify}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return nil, fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+	if c.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls_cert_file or tls_key_file: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.TLSCAFile != "" {
+		b, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls_ca_file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("invalid tls_ca_file: no PEM certificates found")
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// NewSMTP creates new instance of smtp
+func NewSMTP(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c smtpCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Host == "" {
+		return nil, fmt.Errorf("invalid host")
+	}
+	if c.Port == 0 {
+		return nil, fmt.Errorf("invalid port")
+	}
+	if c.MaxConns < 0 {
+		return nil, fmt.Errorf("invalid max_conns: %d", c.MaxConns)
+	}
+	if c.MaxConns == 0 {
+		c.MaxConns = 10
+	}
+
+	opt := smtppool.Opt{
+		Host:          c.Host,
+		Port:          c.Port,
+		HelloHostname: c.HelloHostname,
+		MaxConns:      c.MaxConns,
+	}
+
+	if c.IdleTimeout != "" {
+		d, err := time.ParseDuration(c.IdleTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idle_timeout: %v", err)
+		}
+		opt.IdleTimeout = d
+	}
+	if c.WaitTimeout != "" {
+		d, err := time.ParseDuration(c.WaitTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wait_timeout: %v", err)
+		}
+		opt.PoolWaitTimeout = d
+	}
+
+	var healthInterval, maxConnAge, flushTimeout time.Duration
+	if c.HealthCheckInterval != "" {
+		d, err := time.ParseDuration(c.HealthCheckInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health_check_interval: %v", err)
+		}
+		healthInterval = d
+	}
+	if c.MaxConnAge != "" {
+		d, err := time.ParseDuration(c.MaxConnAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_conn_age: %v", err)
+		}
+		maxConnAge = d
+	}
+	if c.FlushTimeout != "" {
+		d, err := time.ParseDuration(c.FlushTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flush_timeout: %v", err)
+		}
+		flushTimeout = d
+	}
+
+	switch strings.ToLower(c.TLSType) {
+	case "", smtpTLSNone:
+		if c.TLSCertFile != "" || c.TLSKeyFile != "" || c.TLSCAFile != "" {
+			return nil, fmt.Errorf("tls_cert_file, tls_key_file and tls_ca_file require a tls_type")
+		}
+	case smtpTLSStartTLS, smtpTLSTLS:
+		tlsCfg, err := makeSMTPTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		opt.TLSConfig = tlsCfg
+		opt.SSL = strings.EqualFold(c.TLSType, smtpTLSTLS)
+	default:
+		return nil, fmt.Errorf("invalid tls_type: %s", c.TLSType)
+	}
+
+	if c.Username != "" {
+		opt.Auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+
+	var signer *dkimSigner
+	if c.DKIMDomain != "" || c.DKIMSelector != "" || c.DKIMPrivateKeyFile != "" {
+		if c.DKIMDomain == "" || c.DKIMSelector == "" || c.DKIMPrivateKeyFile == "" {
+			return nil, fmt.Errorf("dkim_domain, dkim_selector and dkim_private_key_file must be set together")
+		}
+		if signer, err = newDKIMSigner(c.DKIMDomain, c.DKIMSelector, c.DKIMPrivateKeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := smtpMessenger{
+		dkim:         signer,
+		cfg:          c,
+		opt:          opt,
+		maxConnAge:   maxConnAge,
+		inflight:     newPending(),
+		flushTimeout: flushTimeout,
+		ctx:          ctx,
+		cancel:       cancel,
+		logger:       logger,
+	}
+	s.pool = newSMTPPool(opt, s.dial)
+	if healthInterval > 0 {
+		go s.checkHealth(healthInterval)
+	}
+	if opt.IdleTimeout > 0 {
+		go s.sweepIdle(opt.IdleTimeout)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,381 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+// fakeSMTPServer is a minimal SMTP server that records the messages it
+// receives.
+type fakeSMTPServer struct {
+	ln net.Listener
+
+	// drop closes each connection after the first message sent on it.
+	drop  atomic.Bool
+	conns atomic.Int32
+
+	mu   sync.Mutex
+	msgs []fakeSMTPMessage
+}
+
+type fakeSMTPMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+// port returns the port the server listens on.
+func (s *fakeSMTPServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) messages() []fakeSMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSMTPMessage(nil), s.msgs...)
+}
+
+func (s *fakeSMTPServer) serve(c net.Conn) {
+	defer c.Close()
+
+	tc := textproto.NewConn(c)
+	_ = tc.PrintfLine("220 localhost ready")
+
+	var msg fakeSMTPMessage
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			_ = tc.PrintfLine("250 localhost")
+		case "MAIL":
+			msg = fakeSMTPMessage{From: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")}
+			_ = tc.PrintfLine("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			_ = tc.PrintfLine("250 OK")
+		case "DATA":
+			_ = tc.PrintfLine("354 go ahead")
+			b, err := io.ReadAll(tc.DotReader())
+			if err != nil {
+				return
+			}
+			// The dot reader converts line endings to LF.
+			msg.Data = []byte(strings.ReplaceAll(string(b), "\n", "\r\n"))
+			s.mu.Lock()
+			s.msgs = append(s.msgs, msg)
+			s.mu.Unlock()
+			_ = tc.PrintfLine("250 OK queued")
+			if s.drop.Load() {
+				return
+			}
+		case "RSET", "NOOP":
+			_ = tc.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tc.PrintfLine("221 bye")
+			return
+		default:
+			_ = tc.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPPushDKIM(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	path, key := writeDKIMKey(t)
+
+	m, err := NewSMTP([]byte(fmt.Sprintf(`{
+		"host": "127.0.0.1",
+		"port": %d,
+		"dkim_domain": "example.com",
+		"dkim_selector": "mail",
+		"dkim_private_key_file": %q
+	}`, srv.port(), path)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	msg := Message{
+		From:        "sender@example.com",
+		Subject:     "Signed",
+		ContentType: ContentTypePlain,
+		Body:        []byte("Hello"),
+		Bcc:         []string{"bcc@example.com"},
+	}
+	msg.Subscriber.Email = "to@example.com"
+
+	// The second push reuses the idle connection.
+	for i := 0; i < 2; i++ {
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := srv.messages()
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want 2", len(got))
+	}
+	for _, g := range got {
+		if g.From != "sender@example.com" {
+			t.Errorf("got envelope from %q", g.From)
+		}
+		if strings.Join(g.To, ",") != "to@example.com,bcc@example.com" {
+			t.Errorf("got envelope recipients %v", g.To)
+		}
+		if err := verifyDKIM(g.Data, &key.PublicKey); err != nil {
+			t.Errorf("signature doesn't verify: %v", err)
+		}
+	}
+}
+
+func TestSMTPPushUnsigned(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+
+	m, err := NewSMTP([]byte(fmt.Sprintf(`{"host": "127.0.0.1", "port": %d}`, srv.port())), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	msg := Message{From: "sender@example.com", Subject: "Plain", Body: []byte("Hello")}
+	msg.Subscriber.Email = "to@example.com"
+	if _, err := m.Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := srv.messages()
+	if len(got) != 1 {
+		t.Fatalf("got %d messages, want 1", len(got))
+	}
+	if strings.Contains(string(got[0].Data), "DKIM-Signature") {
+		t.Error("message is signed without a dkim config")
+	}
+}
+
+func TestNewSMTPDKIMConfig(t *testing.T) {
+	_, err := NewSMTP([]byte(`{"host": "127.0.0.1", "port": 25, "dkim_domain": "example.com"}`), onelog.New(io.Discard, 0))
+	if err == nil {
+		t.Fatal("expected an error for a partial dkim config")
+	}
+}
+
+func TestSMTPDeadConnection(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	srv.drop.Store(true)
+
+	m, err := NewSMTP([]byte(fmt.Sprintf(`{"host": "127.0.0.1", "port": %d, "max_conns": 1}`, srv.port())), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	msg := Message{From: "sender@example.com", Subject: "Hello", Body: []byte("Hello")}
+	msg.Subscriber.Email = "to@example.com"
+
+	// The server drops the pooled connection after every message, so each
+	// push after the first has to replace it.
+	for i := 0; i < 3; i++ {
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatalf("push %d: %v", i, err)
+		}
+	}
+	if n := len(srv.messages()); n != 3 {
+		t.Errorf("got %d messages, want 3", n)
+	}
+	if n := srv.conns.Load(); n != 3 {
+		t.Errorf("got %d connections, want 3", n)
+	}
+}
+
+func TestSMTPRecycle(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+
+	m, err := NewSMTP([]byte(fmt.Sprintf(`{"host": "127.0.0.1", "port": %d, "max_conn_age": "1ns"}`, srv.port())), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	msg := Message{From: "sender@example.com", Subject: "Hello", Body: []byte("Hello")}
+	msg.Subscriber.Email = "to@example.com"
+	for i := 0; i < 2; i++ {
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+
+		// The pool is older than max_conn_age, so Flush closes its
+		// connection and the next push opens a new one.
+		if err := m.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.conns.Load(); n != 2 {
+		t.Errorf("got %d connections, want 2", n)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), msg); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v after Close, want ErrClosed", err)
+	}
+}
+
+func TestSMTPHealthCheck(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+
+	m, err := NewSMTP([]byte(fmt.Sprintf(`{"host": "127.0.0.1", "port": %d}`, srv.port())), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	hc := m.(HealthChecker)
+	if err := hc.HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.ln.Close()
+	if err := hc.HealthCheck(context.Background()); err == nil {
+		t.Error("expected an error with the server down")
+	}
+}
+
+// writeTLSCert writes a new self-signed certificate and its key to PEM
+// files in dir and returns their paths.
+func writeTLSCert(t *testing.T, dir string) (string, string, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath, der
+}
+
+func TestSMTPClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, der := writeTLSCert(t, dir)
+
+	m, err := NewSMTP([]byte(fmt.Sprintf(`{
+		"host": "smtp.example.com",
+		"port": 587,
+		"tls_type": "starttls",
+		"tls_cert_file": %q,
+		"tls_key_file": %q,
+		"tls_ca_file": %q
+	}`, cert, key, cert)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	cfg := m.(smtpMessenger).opt.TLSConfig
+	if cfg == nil || len(cfg.Certificates) != 1 {
+		t.Fatalf("got TLS config %+v", cfg)
+	}
+	if got := cfg.Certificates[0].Certificate[0]; !bytes.Equal(got, der) {
+		t.Error("got a different client certificate")
+	}
+	if cfg.RootCAs == nil || cfg.ServerName != "smtp.example.com" {
+		t.Errorf("got RootCAs %v and ServerName %q", cfg.RootCAs, cfg.ServerName)
+	}
+}
+
+func TestNewSMTPTLSInvalid(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, _ := writeTLSCert(t, dir)
+	_, otherKey, _ := writeTLSCert(t, t.TempDir())
+
+	for _, cfg := range []string{
+		// The files are only used with TLS.
+		fmt.Sprintf(`"tls_cert_file": %q, "tls_key_file": %q`, cert, key),
+		fmt.Sprintf(`"tls_key_file": %q`, key),
+		fmt.Sprintf(`"tls_ca_file": %q`, cert),
+
+		fmt.Sprintf(`"tls_type": "tls", "tls_cert_file": %q`, cert),
+		fmt.Sprintf(`"tls_type": "tls", "tls_cert_file": %q, "tls_key_file": %q`, cert, otherKey),
+		fmt.Sprintf(`"tls_type": "tls", "tls_ca_file": %q`, key),
+		fmt.Sprintf(`"tls_type": "tls", "tls_ca_file": %q`, filepath.Join(dir, "missing.pem")),
+		`"tls_type": "ssl"`,
+	} {
+		if _, err := NewSMTP([]byte(`{"host": "smtp.example.com", "port": 465, `+cfg+`}`), onelog.New(io.Discard, 0)); err == nil {
+			t.Errorf("%s: expected an error", cfg)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/francoispqt/onelog"
+)
+
+type snsCfg struct {
+	awsCfg
+
+	// SMSType is either "Transactional" or "Promotional".
+	SMSType  string `json:"sms_type"`
+	SenderID string `json:"sender_id"`
+
+	// PhoneAttribute is the subscriber attribute holding the phone
+	// number. Defaults to "phone".
+	PhoneAttribute string `json:"phone_attribute"`
+
+	// DefaultRegion is the ISO country code used to normalize phone
+	// numbers that aren't in international format, eg: "US".
+	DefaultRegion string `json:"default_region"`
+	logCfg
+}
+
+type snsMessenger struct {
+	cfg       snsCfg
+	client    *sns.SNS
+	sess      *session.Session
+	transport *http.Transport
+
+	// receipts verifies the SNS notifications that deliver receipts.
+	receipts *snsReceiver
+
+	// ctx is cancelled when the messenger is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger *levelLogger
+}
+
+func (s snsMessenger) Name() string {
+	return "sns"
+}
+
+// Push sends the sms through the SNS Publish API.
+func (s snsMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	s.logger.DebugWith("sending message").String("email", s.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	if s.ctx.Err() != nil {
+		return "", ErrClosed
+	}
+
+	phone, err := subscriberPhone(msg, s.cfg.PhoneAttribute, s.cfg.DefaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	attribs := map[string]*sns.MessageAttributeValue{}
+	if s.cfg.SMSType != "" {
+		attribs["AWS.SNS.SMS.SMSType"] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(s.cfg.SMSType),
+		}
+	}
+	if s.cfg.SenderID != "" {
+		attribs["AWS.SNS.SMS.SenderID"] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(s.cfg.SenderID),
+		}
+	}
+
+	out, err := s.client.PublishWithContext(ctx, &sns.PublishInput{
+		PhoneNumber:       aws.String(phone),
+		Message:           aws.String(string(msg.Body)),
+		MessageAttributes: attribs,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("error sending sms: %w", ctx.Err())
+		}
+		return "", wrapAWSError(err)
+	}
+
+	msgID := aws.StringValue(out.MessageId)
+	s.logger.InfoWith("successfully sent sms").String("phone", s.logger.phone(phone)).String("message_id", msgID).Write()
+
+	return msgID, nil
+}
+
+// HealthCheck verifies the configured credentials against STS.
+func (s snsMessenger) HealthCheck(ctx context.Context) error {
+	return wrapAWSError(checkCredentials(ctx, s.sess))
+}
+
+// HandleDeliveryReceipt parses a delivery receipt, a SNS SMS delivery status log
+// delivered by an SNS HTTP subscription, for a previously sent message.
+// The notification's signature is verified first, and subscription
+// confirmations are confirmed and returned as ErrSubscriptionConfirmed.
+func (s snsMessenger) HandleDeliveryReceipt(ctx context.Context, raw []byte) (DeliveryStatus, error) {
+	env, err := s.receipts.receive(ctx, raw)
+	if err != nil {
+		if errors.Is(err, ErrSubscriptionConfirmed) {
+			s.logger.InfoWith("confirmed sns subscription").String("topic_arn", env.TopicArn).Write()
+		}
+		return DeliveryStatus{}, err
+	}
+
+	st, err := parseDeliveryReceipt(env)
+	if err != nil {
+		return st, err
+	}
+
+	s.logger.InfoWith("received delivery receipt").String("message_id", st.MessageID).
+		String("status", st.Status).String("provider_status", st.ProviderStatus).Write()
+	return st, nil
+}
+
+func (s snsMessenger) Flush() error {
+	return nil
+}
+
+// Close marks the messenger as closed and releases idle connections
+// held by the underlying HTTP transport.
+func (s snsMessenger) Close() error {
+	s.cancel()
+	s.transport.CloseIdleConnections()
+	return nil
+}
+
+// NewSNS creates new instance of sns
+func NewSNS(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c snsCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.SMSType {
+	case "", "Transactional", "Promotional":
+	default:
+		return nil, fmt.Errorf("invalid sms_type: %s", c.SMSType)
+	}
+	if c.PhoneAttribute == "" {
+		c.PhoneAttribute = "phone"
+	}
+
+	transport := newHTTPTransport()
+	sess, err := newAWSSession(c.awsCfg, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return snsMessenger{
+		client:    sns.New(sess),
+		sess:      sess,
+		cfg:       c,
+		transport: transport,
+		receipts:  newSNSReceiver(aws.StringValue(sess.Config.Region), transport),
+		ctx:       ctx,
+		cancel:    cancel,
+		logger:    logger,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+// fakeSNSAPI is an endpoint for the SNS and STS query APIs that accepts every
+// message and records the requests' forms.
+type fakeSNSAPI struct {
+	srv *httptest.Server
+
+	mu    sync.Mutex
+	forms []url.Values
+
+	// errCode, if set, fails every request with the AWS error code.
+	errCode string
+}
+
+func (f *fakeSNSAPI) serve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.forms = append(f.forms, r.PostForm)
+	id := fmt.Sprintf("m-%d", len(f.forms))
+	errCode := f.errCode
+	f.mu.Unlock()
+
+	if errCode != "" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>failed</Message></Error></ErrorResponse>", errCode)
+		return
+	}
+
+	switch r.PostForm.Get("Action") {
+	case "Publish":
+		fmt.Fprintf(w, "<PublishResponse><PublishResult><MessageId>%s</MessageId></PublishResult></PublishResponse>", id)
+	case "GetCallerIdentity":
+		fmt.Fprint(w, "<GetCallerIdentityResponse><GetCallerIdentityResult><Account>123456789012</Account></GetCallerIdentityResult></GetCallerIdentityResponse>")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "<ErrorResponse><Error><Code>InvalidAction</Code><Message>%s</Message></Error></ErrorResponse>", r.PostForm.Get("Action"))
+	}
+}
+
+func (f *fakeSNSAPI) requests() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.forms...)
+}
+
+// newTestSNS returns a SNS messenger sending to a fakeSNSAPI. cfg is
+// additional JSON config fields.
+func newTestSNS(t *testing.T, cfg string) (snsMessenger, *fakeSNSAPI) {
+	t.Helper()
+
+	f := &fakeSNSAPI{}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+
+	if cfg != "" {
+		cfg = ", " + cfg
+	}
+	m, err := NewSNS([]byte(fmt.Sprintf(`{"region": "us-east-1", "access_key": "a", "secret_key": "s", "max_retries": 0, "endpoint": %q%s}`, f.srv.URL, cfg)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.(snsMessenger), f
+}
+
+func TestSNSHealthCheck(t *testing.T) {
+	m, f := newTestSNS(t, "")
+
+	if err := m.HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := f.requests(); len(reqs) != 1 || reqs[0].Get("Action") != "GetCallerIdentity" {
+		t.Errorf("got requests %v, want GetCallerIdentity", reqs)
+	}
+
+	f.mu.Lock()
+	f.errCode = "InvalidClientTokenId"
+	f.mu.Unlock()
+	if err := m.HealthCheck(context.Background()); !errors.Is(err, ErrAuth) {
+		t.Errorf("got %v, want ErrAuth", err)
+	}
+}
+
+func TestSNSPush(t *testing.T) {
+	m, f := newTestSNS(t, `"sms_type": "Transactional", "sender_id": "Listmonk", "default_region": "US"`)
+
+	msg := testMessage()
+	msg.ContentType = ContentTypePlain
+	msg.Body = []byte("Your code is 1234")
+	msg.Subscriber.Attribs["phone"] = "(555) 123-4567"
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "m-1" {
+		t.Errorf("got id %q", id)
+	}
+
+	req := f.requests()[0]
+	for k, want := range map[string]string{
+		"Action":      "Publish",
+		"PhoneNumber": "+15551234567",
+		"Message":     "Your code is 1234",
+	} {
+		if got := req.Get(k); got != want {
+			t.Errorf("got %s %q, want %q", k, got, want)
+		}
+	}
+
+	// Message attributes are sent as entry.N.Name/Value pairs in any order.
+	attribs := map[string]string{}
+	for i := 1; req.Has(fmt.Sprintf("MessageAttributes.entry.%d.Name", i)); i++ {
+		attribs[req.Get(fmt.Sprintf("MessageAttributes.entry.%d.Name", i))] = req.Get(fmt.Sprintf("MessageAttributes.entry.%d.Value.StringValue", i))
+	}
+	if attribs["AWS.SNS.SMS.SMSType"] != "Transactional" || attribs["AWS.SNS.SMS.SenderID"] != "Listmonk" || len(attribs) != 2 {
+		t.Errorf("got message attributes %v", attribs)
+	}
+
+	f.mu.Lock()
+	f.errCode = "Throttling"
+	f.mu.Unlock()
+	if _, err := m.Push(context.Background(), msg); !errors.Is(err, ErrThrottled) {
+		t.Errorf("got %v, want ErrThrottled", err)
+	}
+}
@@ -0,0 +1,236 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/smtppool"
+)
+
+const sparkpostAPIURL = "https://api.sparkpost.com"
+
+type sparkpostCfg struct {
+	APIKey string `json:"api_key"`
+
+	// ReturnPath is the envelope sender, eg: an address on a custom
+	// bounce domain.
+	ReturnPath string `json:"return_path"`
+
+	// APIURL can be set to "https://api.eu.sparkpost.com" for SparkPost EU.
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type sparkpostMessenger struct {
+	cfg    sparkpostCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type sparkpostAddress struct {
+	Email    string `json:"email"`
+	Name     string `json:"name,omitempty"`
+	HeaderTo string `json:"header_to,omitempty"`
+}
+
+type sparkpostRecipient struct {
+	Address sparkpostAddress `json:"address"`
+}
+
+type sparkpostAttachment struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+type sparkpostContent struct {
+	From         sparkpostAddress      `json:"from"`
+	Subject      string                `json:"subject"`
+	HTML         string                `json:"html,omitempty"`
+	Text         string                `json:"text,omitempty"`
+	ReplyTo      string                `json:"reply_to,omitempty"`
+	Headers      map[string]string     `json:"headers,omitempty"`
+	Attachments  []sparkpostAttachment `json:"attachments,omitempty"`
+	InlineImages []sparkpostAttachment `json:"inline_images,omitempty"`
+}
+
+type sparkpostTransmission struct {
+	Recipients []sparkpostRecipient `json:"recipients"`
+	Content    sparkpostContent     `json:"content"`
+	ReturnPath string               `json:"return_path,omitempty"`
+}
+
+type sparkpostResp struct {
+	Results struct {
+		ID string `json:"id"`
+	} `json:"results"`
+	Errors []struct {
+		Code        string `json:"code"`
+		Message     string `json:"message"`
+		Description string `json:"description"`
+	} `json:"errors"`
+}
+
+func (s sparkpostMessenger) Name() string {
+	return "sparkpost"
+}
+
+// Push sends the email through the SparkPost transmissions API.
+func (s sparkpostMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	s.logger.DebugWith("sending message").String("email", s.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	files, err := fetchAttachments(ctx, s.cfg.httpClientCfg, msg.Attachments)
+	if err != nil {
+		return "", err
+	}
+	msg.Attachments = files
+
+	name, addr := splitAddress(messageFrom(msg))
+	c := sparkpostContent{
+		From:    sparkpostAddress{Email: addr, Name: name},
+		Subject: msg.Subject,
+		ReplyTo: strings.Join(msg.ReplyTo, ", "),
+	}
+	if msg.ContentType == ContentTypePlain {
+		c.Text = string(msg.Body)
+	} else {
+		c.HTML = string(msg.Body)
+		c.Text = string(msg.AltBody)
+	}
+
+	if len(msg.Headers) > 0 || len(msg.Cc) > 0 {
+		c.Headers = make(map[string]string, len(msg.Headers)+1)
+		for k, v := range msg.Headers {
+			c.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	// Cc and Bcc recipients are regular recipients whose header_to is the
+	// primary recipient. Cc addresses are also listed in the CC header.
+	rcpts := []sparkpostRecipient{{Address: sparkpostAddress{Email: msg.Subscriber.Email}}}
+	for _, a := range append(append([]string(nil), msg.Cc...), msg.Bcc...) {
+		_, addr := splitAddress(a)
+		rcpts = append(rcpts, sparkpostRecipient{Address: sparkpostAddress{Email: addr, HeaderTo: msg.Subscriber.Email}})
+	}
+	if len(msg.Cc) > 0 {
+		c.Headers["CC"] = strings.Join(msg.Cc, ", ")
+	}
+
+	for _, a := range msg.Attachments {
+		att := sparkpostAttachment{
+			Name: a.Name,
+			Type: attachmentHeader(a).Get(smtppool.HdrContentType),
+			Data: base64.StdEncoding.EncodeToString(a.Content),
+		}
+		if a.ContentID != "" {
+			// Inline images are referenced by their name.
+			att.Name = a.ContentID
+			c.InlineImages = append(c.InlineImages, att)
+			continue
+		}
+		c.Attachments = append(c.Attachments, att)
+	}
+
+	b, err := json.Marshal(sparkpostTransmission{
+		Recipients: rcpts,
+		Content:    c,
+		ReturnPath: s.cfg.ReturnPath,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.APIURL+"/api/v1/transmissions", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", s.cfg.APIKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "sparkpost"); err != nil {
+		return "", err
+	}
+
+	var out sparkpostResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding sparkpost response (status %d): %v", resp.StatusCode, err)
+	}
+
+	if len(out.Errors) > 0 || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		errs := make([]error, 0, len(out.Errors))
+		for _, e := range out.Errors {
+			errs = append(errs, fmt.Errorf("sparkpost error %s: %s: %s", e.Code, e.Message, e.Description))
+		}
+
+		var base error
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			base = ErrAuth
+		default:
+			base = fmt.Errorf("sparkpost returned status %d", resp.StatusCode)
+		}
+		if len(errs) == 0 {
+			return "", base
+		}
+		return "", fmt.Errorf("%w: %w", base, errors.Join(errs...))
+	}
+
+	s.logger.InfoWith("successfully sent email").String("email", s.logger.email(msg.Subscriber.Email)).String("message_id", out.Results.ID).Write()
+
+	return out.Results.ID, nil
+}
+
+func (s sparkpostMessenger) Flush() error {
+	return nil
+}
+
+func (s sparkpostMessenger) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// NewSparkPost creates new instance of sparkpost
+func NewSparkPost(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c sparkpostCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("invalid api_key")
+	}
+	if c.APIURL == "" {
+		c.APIURL = sparkpostAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return sparkpostMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestSparkPostPush(t *testing.T) {
+	var (
+		path, auth string
+		tr         sparkpostTransmission
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"results": {"total_rejected_recipients": 0, "total_accepted_recipients": 2, "id": "11668787484950529"}}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewSparkPost([]byte(fmt.Sprintf(`{"api_key": "key", "return_path": "bounces@bounce.example.com", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.Cc = []string{"cc@example.com"}
+	msg.ReplyTo = []string{"reply@example.com"}
+	msg.Attachments = []Attachment{{Name: "a.pdf", Content: []byte("%PDF")}}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "11668787484950529" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/api/v1/transmissions" || auth != "key" {
+		t.Errorf("got request to %s with Authorization %q", path, auth)
+	}
+
+	if tr.ReturnPath != "bounces@bounce.example.com" {
+		t.Errorf("got return path %q", tr.ReturnPath)
+	}
+	if len(tr.Recipients) != 2 || tr.Recipients[0].Address.Email != "to@example.com" ||
+		tr.Recipients[1].Address != (sparkpostAddress{Email: "cc@example.com", HeaderTo: "to@example.com"}) {
+		t.Errorf("got recipients %+v", tr.Recipients)
+	}
+	c := tr.Content
+	if c.From != (sparkpostAddress{Email: "sender@example.com", Name: "Sender"}) || c.ReplyTo != "reply@example.com" || c.Headers["CC"] != "cc@example.com" {
+		t.Errorf("got content %+v", c)
+	}
+	if len(c.Attachments) != 1 || c.Attachments[0] != (sparkpostAttachment{Name: "a.pdf", Type: "application/pdf", Data: "JVBERg=="}) {
+		t.Errorf("got attachments %+v", c.Attachments)
+	}
+}
+
+func TestSparkPostPushErrors(t *testing.T) {
+	status := http.StatusUnprocessableEntity
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"errors": [
+			{"code": "1200", "message": "invalid data format/type", "description": "Error while parsing recipients"},
+			{"code": "7001", "message": "Sending domain is not configured", "description": "Unconfigured sending domain: example.com"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewSparkPost([]byte(fmt.Sprintf(`{"api_key": "key", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Push(context.Background(), testMessage())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"status 422", "1200", "Error while parsing recipients", "7001", "Unconfigured sending domain"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q is missing %q", err, want)
+		}
+	}
+
+	status = http.StatusForbidden
+	if _, err := m.Push(context.Background(), testMessage()); !errors.Is(err, ErrAuth) {
+		t.Errorf("got %v, want ErrAuth", err)
+	}
+}
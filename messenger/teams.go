@@ -0,0 +1,217 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+const (
+	teamsFormatMessageCard  = "messagecard"
+	teamsFormatAdaptiveCard = "adaptivecard"
+
+	teamsAdaptiveCardType = "application/vnd.microsoft.card.adaptive"
+)
+
+type teamsCfg struct {
+	WebhookURL string `json:"webhook_url"`
+
+	// WebhookURLAttribute is an optional subscriber attribute holding a
+	// per-subscriber webhook URL that overrides WebhookURL.
+	WebhookURLAttribute string `json:"webhook_url_attribute"`
+
+	// Format is the card format, either "messagecard" (legacy, default) or
+	// "adaptivecard".
+	Format string `json:"format"`
+	httpClientCfg
+	logCfg
+}
+
+type teamsMessenger struct {
+	cfg    teamsCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type teamsMessageCard struct {
+	Type    string `json:"@type"`
+	Context string `json:"@context"`
+	Summary string `json:"summary"`
+	Title   string `json:"title,omitempty"`
+	Text    string `json:"text"`
+}
+
+type teamsTextBlock struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Weight string `json:"weight,omitempty"`
+	Size   string `json:"size,omitempty"`
+	Wrap   bool   `json:"wrap"`
+}
+
+type teamsAdaptiveCard struct {
+	Schema  string           `json:"$schema"`
+	Type    string           `json:"type"`
+	Version string           `json:"version"`
+	Body    []teamsTextBlock `json:"body"`
+}
+
+type teamsAttachment struct {
+	ContentType string            `json:"contentType"`
+	Content     teamsAdaptiveCard `json:"content"`
+}
+
+type teamsAdaptivePayload struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+func (t teamsMessenger) Name() string {
+	return "teams"
+}
+
+// Push posts the message as a card to the Teams incoming webhook.
+func (t teamsMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	t.logger.DebugWith("sending message").String("email", t.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	url := t.cfg.WebhookURL
+	if t.cfg.WebhookURLAttribute != "" {
+		if u, ok := msg.Subscriber.Attribs[t.cfg.WebhookURLAttribute].(string); ok && u != "" {
+			url = u
+		}
+	}
+	if url == "" {
+		return "", fmt.Errorf("could not find teams webhook url")
+	}
+
+	b, err := json.Marshal(t.makePayload(msg))
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "teams"); err != nil {
+		return "", err
+	}
+
+	// Teams responds with a plain text "1" on success and the error text
+	// otherwise.
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return "", fmt.Errorf("teams returned status %d: %s", resp.StatusCode, body)
+	case strings.TrimSpace(string(body)) != "1":
+		return "", fmt.Errorf("teams error: %s", body)
+	}
+
+	t.logger.InfoWith("successfully sent teams message").String("subject", msg.Subject).Write()
+
+	return "", nil
+}
+
+// makePayload builds the webhook payload in the configured card format.
+func (t teamsMessenger) makePayload(msg Message) interface{} {
+	if t.cfg.Format != teamsFormatAdaptiveCard {
+		// The summary is required and shown in notifications.
+		summary := msg.Subject
+		if summary == "" {
+			summary = truncate(string(msg.Body), 100)
+		}
+		return teamsMessageCard{
+			Type:    "MessageCard",
+			Context: "http://schema.org/extensions",
+			Summary: summary,
+			Title:   msg.Subject,
+			Text:    string(msg.Body),
+		}
+	}
+
+	card := teamsAdaptiveCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+	}
+	if msg.Subject != "" {
+		card.Body = append(card.Body, teamsTextBlock{
+			Type:   "TextBlock",
+			Text:   msg.Subject,
+			Weight: "Bolder",
+			Size:   "Medium",
+			Wrap:   true,
+		})
+	}
+	card.Body = append(card.Body, teamsTextBlock{
+		Type: "TextBlock",
+		Text: string(msg.Body),
+		Wrap: true,
+	})
+
+	return teamsAdaptivePayload{
+		Type:        "message",
+		Attachments: []teamsAttachment{{ContentType: teamsAdaptiveCardType, Content: card}},
+	}
+}
+
+func (t teamsMessenger) Flush() error {
+	return nil
+}
+
+func (t teamsMessenger) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// NewTeams creates new instance of teams
+func NewTeams(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c teamsCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.WebhookURL == "" && c.WebhookURLAttribute == "" {
+		return nil, fmt.Errorf("invalid webhook_url or webhook_url_attribute")
+	}
+	switch c.Format {
+	case "":
+		c.Format = teamsFormatMessageCard
+	case teamsFormatMessageCard, teamsFormatAdaptiveCard:
+	default:
+		return nil, fmt.Errorf("invalid format: %s", c.Format)
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return teamsMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
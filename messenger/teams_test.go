@@ -0,0 +1,94 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestTeamsPush(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("1"))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		format string
+		want   string
+	}{
+		{"", `{
+			"@type": "MessageCard",
+			"@context": "http://schema.org/extensions",
+			"summary": "Hello",
+			"title": "Hello",
+			"text": "<p>Hello</p>"
+		}`},
+		{"adaptivecard", `{
+			"type": "message",
+			"attachments": [{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": {
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type": "AdaptiveCard",
+					"version": "1.4",
+					"body": [
+						{"type": "TextBlock", "text": "Hello", "weight": "Bolder", "size": "Medium", "wrap": true},
+						{"type": "TextBlock", "text": "<p>Hello</p>", "wrap": true}
+					]
+				}
+			}]
+		}`},
+	} {
+		m, err := NewTeams([]byte(fmt.Sprintf(`{"webhook_url": %q, "format": %q}`, srv.URL, c.format)), onelog.New(io.Discard, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Push(context.Background(), testMessage()); err != nil {
+			t.Fatalf("%q: %v", c.format, err)
+		}
+
+		var got, want any
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(c.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got payload %s", c.format, body)
+		}
+	}
+}
+
+func TestTeamsPushErrors(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		// Legacy connectors report some failures with a 200.
+		_, _ = w.Write([]byte("Webhook message delivery failed with error: Microsoft Teams endpoint returned HTTP error 413"))
+	}))
+	defer srv.Close()
+
+	m, err := NewTeams([]byte(fmt.Sprintf(`{"webhook_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "delivery failed") {
+		t.Errorf("got %v, want the teams error", err)
+	}
+
+	status = http.StatusBadRequest
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("got %v, want a status error", err)
+	}
+}
@@ -0,0 +1,139 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/francoispqt/onelog"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+type telegramCfg struct {
+	BotToken string `json:"bot_token"`
+	APIURL   string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type telegramMessenger struct {
+	cfg    telegramCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type telegramResp struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Result      struct {
+		MessageID int64 `json:"message_id"`
+	} `json:"result"`
+}
+
+func (t telegramMessenger) Name() string {
+	return "telegram"
+}
+
+// Push sends the message to the subscriber's chat through the Telegram bot API.
+func (t telegramMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	t.logger.DebugWith("sending message").String("email", t.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	var chatID string
+	switch v := msg.Subscriber.Attribs["telegram_chat_id"].(type) {
+	case string:
+		chatID = v
+	case float64:
+		chatID = strconv.FormatInt(int64(v), 10)
+	}
+	if chatID == "" {
+		return "", fmt.Errorf("could not find subscriber telegram_chat_id")
+	}
+
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    string(msg.Body),
+	}
+	if msg.ContentType != ContentTypePlain {
+		payload["parse_mode"] = "HTML"
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf("%s/bot%s/sendMessage", t.cfg.APIURL, t.cfg.BotToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "telegram"); err != nil {
+		return "", err
+	}
+
+	var out telegramResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding telegram response (status %d): %v", resp.StatusCode, err)
+	}
+	if !out.OK {
+		return "", fmt.Errorf("telegram error %d: %s", out.ErrorCode, out.Description)
+	}
+
+	msgID := strconv.FormatInt(out.Result.MessageID, 10)
+	t.logger.InfoWith("successfully sent telegram message").String("chat_id", chatID).String("message_id", msgID).Write()
+
+	return msgID, nil
+}
+
+func (t telegramMessenger) Flush() error {
+	return nil
+}
+
+func (t telegramMessenger) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// NewTelegram creates new instance of telegram
+func NewTelegram(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c telegramCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.BotToken == "" {
+		return nil, fmt.Errorf("invalid bot_token")
+	}
+	if c.APIURL == "" {
+		c.APIURL = telegramAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return telegramMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
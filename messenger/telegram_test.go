@@ -0,0 +1,76 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestTelegramPush(t *testing.T) {
+	var (
+		path    string
+		payload map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 42}}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewTelegram([]byte(fmt.Sprintf(`{"bot_token": "123:abc", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.Push(context.Background(), testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "42" {
+		t.Errorf("got id %q", id)
+	}
+	if path != "/bot123:abc/sendMessage" {
+		t.Errorf("got request to %s", path)
+	}
+	if payload["chat_id"] != "12345" || payload["text"] != "<p>Hello</p>" || payload["parse_mode"] != "HTML" {
+		t.Errorf("got payload %v", payload)
+	}
+}
+
+func TestTelegramPushError(t *testing.T) {
+	// The Bot API reports failures in the envelope, with a 4xx status.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewTelegram([]byte(fmt.Sprintf(`{"bot_token": "123:abc", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Push(context.Background(), testMessage())
+	if err == nil || !strings.Contains(err.Error(), "chat not found") || !strings.Contains(err.Error(), "400") {
+		t.Errorf("got %v, want the telegram error", err)
+	}
+	if id != "" {
+		t.Errorf("got id %q for a failed send", id)
+	}
+
+	// Subscribers without a chat ID aren't sent to.
+	msg := testMessage()
+	delete(msg.Subscriber.Attribs, "telegram_chat_id")
+	if _, err := m.Push(context.Background(), msg); err == nil {
+		t.Error("expected an error without telegram_chat_id")
+	}
+}
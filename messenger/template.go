@@ -0,0 +1,34 @@
+package messenger
+
+import (
+	"bytes"
+	"fmt"
+	htmltpl "html/template"
+	texttpl "text/template"
+)
+
+// renderBody renders the message body as a template with the subscriber
+// as its data, eg: "Hi {{ .Attribs.first_name }}". HTML bodies are
+// rendered with html/template so that attribute values are escaped.
+func renderBody(msg Message) (string, error) {
+	var (
+		b   bytes.Buffer
+		err error
+	)
+	if msg.ContentType == ContentTypePlain {
+		var tpl *texttpl.Template
+		if tpl, err = texttpl.New("body").Parse(string(msg.Body)); err == nil {
+			err = tpl.Execute(&b, msg.Subscriber)
+		}
+	} else {
+		var tpl *htmltpl.Template
+		if tpl, err = htmltpl.New("body").Parse(string(msg.Body)); err == nil {
+			err = tpl.Execute(&b, msg.Subscriber)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("error rendering body: %v", err)
+	}
+
+	return b.String(), nil
+}
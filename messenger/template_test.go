@@ -0,0 +1,67 @@
+package messenger
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRenderBody(t *testing.T) {
+	msg := Message{}
+	msg.Subscriber.Name = "Ann <admin> & Co"
+	msg.Subscriber.Attribs = map[string]interface{}{"city": `"Oslo"`}
+
+	for _, tc := range []struct {
+		ct, body, want string
+	}{
+		// Plain text is rendered as is.
+		{ContentTypePlain, "Hi {{ .Name }} from {{ .Attribs.city }}", `Hi Ann <admin> & Co from "Oslo"`},
+		// HTML escapes the values for where they're used.
+		{ContentTypeHTML, "<p>Hi {{ .Name }}</p>", "<p>Hi Ann &lt;admin&gt; &amp; Co</p>"},
+		{ContentTypeHTML, `<a title="{{ .Attribs.city }}">x</a>`, `<a title="&#34;Oslo&#34;">x</a>`},
+		{ContentTypeHTML, "<p>No template</p>", "<p>No template</p>"},
+	} {
+		msg.ContentType, msg.Body = tc.ct, []byte(tc.body)
+		got, err := renderBody(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s %q: got %q, want %q", tc.ct, tc.body, got, tc.want)
+		}
+	}
+
+	for _, body := range []string{"{{ .Name", "{{ .Missing }}"} {
+		msg.ContentType, msg.Body = ContentTypePlain, []byte(body)
+		if _, err := renderBody(msg); err == nil {
+			t.Errorf("%q: expected an error", body)
+		}
+	}
+}
+
+func TestSESRenderTemplates(t *testing.T) {
+	msg := sesTestMessage()
+	msg.Subscriber.Name = "Ann"
+	msg.Body = []byte("Hi {{ .Name }}")
+
+	for cfg, want := range map[string]string{
+		`"render_templates": true`: "Hi Ann",
+		// The body is sent as is unless rendering is enabled.
+		"": "Hi {{ .Name }}",
+	} {
+		m, f := newTestSES(t, "ses", cfg)
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		_, parts := parseEmail(t, f.requests()[0].rawEmail(t))
+		if got := partText(t, parts[0]); got != want {
+			t.Errorf("%s: got body %q, want %q", cfg, got, want)
+		}
+	}
+
+	m, _ := newTestSES(t, "ses", `"render_templates": true`)
+	msg.Body = []byte("Hi {{ .Name")
+	if _, err := m.Push(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "error rendering body") {
+		t.Errorf("got %v", err)
+	}
+}
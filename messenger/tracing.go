@@ -0,0 +1,63 @@
+package messenger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMessenger wraps a Messenger and starts an OpenTelemetry span
+// around every Push.
+type TracingMessenger struct {
+	Messenger
+	tracer trace.Tracer
+	key    []byte
+}
+
+// NewTracingMessenger wraps m, tracing its pushes with tracer. If key is
+// set, spans carry an HMAC of the recipient keyed with it, which lets
+// traces for the same recipient be correlated without the address being
+// recoverable from them. Otherwise the recipient isn't recorded.
+func NewTracingMessenger(m Messenger, tracer trace.Tracer, key []byte) *TracingMessenger {
+	return &TracingMessenger{Messenger: m, tracer: tracer, key: key}
+}
+
+// Push pushes the message through the underlying messenger inside a
+// "messenger.push" span.
+func (t *TracingMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("messenger.name", t.Messenger.Name()),
+		attribute.String("messenger.content_type", msg.ContentType),
+		attribute.Int("messenger.bytes", msg.EstimatedBytes()),
+	}
+	if len(t.key) > 0 && msg.Subscriber.Email != "" {
+		attrs = append(attrs, attribute.String("messenger.recipient_hash", hashRecipient(t.key, msg.Subscriber.Email)))
+	}
+
+	ctx, span := t.tracer.Start(ctx, "messenger.push",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	defer span.End()
+
+	id, err := t.Messenger.Push(ctx, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return id, err
+	}
+
+	span.SetAttributes(attribute.String("messenger.message_id", id))
+	return id, nil
+}
+
+// hashRecipient returns the hex encoded HMAC-SHA256 of a recipient address.
+func hashRecipient(key []byte, addr string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(addr))
+	return hex.EncodeToString(h.Sum(nil))
+}
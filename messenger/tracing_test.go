@@ -0,0 +1,66 @@
+package messenger
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// fakeTracer records the attributes spans are started with.
+type fakeTracer struct {
+	noop.Tracer
+	attrs []attribute.KeyValue
+}
+
+func (f *fakeTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	f.attrs = cfg.Attributes()
+	return f.Tracer.Start(ctx, name, opts...)
+}
+
+func (f *fakeTracer) attr(key string) (string, bool) {
+	for _, a := range f.attrs {
+		if string(a.Key) == key {
+			return a.Value.Emit(), true
+		}
+	}
+	return "", false
+}
+
+func TestTracingMessengerRecipient(t *testing.T) {
+	msg := Message{}
+	msg.Subscriber.Email = "subscriber@example.com"
+
+	// Without a key, the recipient isn't recorded.
+	tr := &fakeTracer{}
+	if _, err := NewTracingMessenger(&fakeMessenger{}, tr, nil).Push(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := tr.attr("messenger.recipient_hash"); ok {
+		t.Errorf("recipient recorded without a key: %s", v)
+	}
+	if v, _ := tr.attr("messenger.name"); v != "fake" {
+		t.Errorf("got messenger.name %q", v)
+	}
+
+	// With a key, it's an HMAC that depends on the key.
+	hashes := make(map[string]bool)
+	for _, key := range []string{"key-1", "key-1", "key-2"} {
+		tr := &fakeTracer{}
+		if _, err := NewTracingMessenger(&fakeMessenger{}, tr, []byte(key)).Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		v, ok := tr.attr("messenger.recipient_hash")
+		if !ok || len(v) != 64 || strings.Contains(v, "subscriber") {
+			t.Fatalf("got recipient_hash %q", v)
+		}
+		hashes[v] = true
+	}
+	if len(hashes) != 2 {
+		t.Errorf("got %d distinct hashes for 2 keys", len(hashes))
+	}
+}
@@ -0,0 +1,119 @@
+package messenger
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"text/template"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// trackingData is the data that tracking URL templates are rendered with,
+// eg: "https://example.com/open?s={{ .SubscriberUUID }}".
+type trackingData struct {
+	SubscriberUUID string
+	CampaignUUID   string
+}
+
+// newTrackingData returns the query escaped tracking data for a message.
+func newTrackingData(msg Message) trackingData {
+	d := trackingData{SubscriberUUID: url.QueryEscape(msg.Subscriber.UUID)}
+	if msg.Campaign != nil {
+		d.CampaignUUID = url.QueryEscape(msg.Campaign.UUID)
+	}
+	return d
+}
+
+// injectPixel adds an open tracking pixel, rendered from tpl, to an HTML
+// body just before its closing body tag or, if there isn't one, at the end.
+func injectPixel(body []byte, tpl *template.Template, msg Message) ([]byte, error) {
+	var u bytes.Buffer
+	if err := tpl.Execute(&u, newTrackingData(msg)); err != nil {
+		return nil, fmt.Errorf("error rendering tracking pixel url: %v", err)
+	}
+	pixel := `<img src="` + html.EscapeString(u.String()) + `" width="1" height="1" alt="" style="display:none" />`
+
+	i := strings.LastIndex(strings.ToLower(string(body)), "</body>")
+	if i < 0 {
+		return append(append([]byte(nil), body...), pixel...), nil
+	}
+
+	out := make([]byte, 0, len(body)+len(pixel))
+	out = append(out, body[:i]...)
+	out = append(out, pixel...)
+	return append(out, body[i:]...), nil
+}
+
+// rewriteLinks routes the http(s) links of an HTML body through the click
+// tracking base URL, passing the original URL and the subscriber and
+// campaign as query params. Other links, eg: "mailto:", "tel:" and
+// anchors, are left as is. The body is tokenized rather than parsed so
+// that everything but the rewritten tags is preserved byte for byte.
+func rewriteLinks(body []byte, base *url.URL, msg Message) []byte {
+	var (
+		out bytes.Buffer
+		z   = xhtml.NewTokenizer(bytes.NewReader(body))
+	)
+	out.Grow(len(body))
+
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			// io.EOF, or a read error which can't happen with bytes.Reader.
+			// A tag left unterminated at the end is kept as is.
+			out.Write(z.Raw())
+			return out.Bytes()
+		}
+
+		raw := z.Raw()
+		if tt != xhtml.StartTagToken && tt != xhtml.SelfClosingTagToken {
+			out.Write(raw)
+			continue
+		}
+
+		tok := z.Token()
+		if tok.DataAtom != atom.A && tok.DataAtom != atom.Area {
+			out.Write(raw)
+			continue
+		}
+
+		rewritten := false
+		for i, a := range tok.Attr {
+			if a.Namespace != "" || a.Key != "href" {
+				continue
+			}
+			if u, ok := trackedURL(a.Val, base, msg); ok {
+				tok.Attr[i].Val = u
+				rewritten = true
+			}
+		}
+		if !rewritten {
+			out.Write(raw)
+			continue
+		}
+		out.WriteString(tok.String())
+	}
+}
+
+// trackedURL returns the click tracking URL for link if it's an absolute
+// http(s) URL.
+func trackedURL(link string, base *url.URL, msg Message) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+
+	t := *base
+	q := t.Query()
+	q.Set("url", u.String())
+	q.Set("s", msg.Subscriber.UUID)
+	if msg.Campaign != nil {
+		q.Set("c", msg.Campaign.UUID)
+	}
+	t.RawQuery = q.Encode()
+	return t.String(), true
+}
@@ -0,0 +1,201 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net/url"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/francoispqt/onelog"
+	"github.com/knadh/listmonk/models"
+)
+
+// trackingTestMessage returns a message to subscriber "sub-1" of campaign
+// "camp-1".
+func trackingTestMessage() Message {
+	msg := sesTestMessage()
+	msg.Subscriber.UUID = "sub-1"
+	msg.Campaign = &models.Campaign{UUID: "camp-1"}
+	return msg
+}
+
+// partText returns the decoded content of a quoted-printable part.
+func partText(t *testing.T, p parsedPart) string {
+	t.Helper()
+
+	b, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(p.content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRewriteLinks(t *testing.T) {
+	base, _ := url.Parse("https://track.example.com/c?src=mail")
+	msg := trackingTestMessage()
+
+	tracked := func(link string) string {
+		u, _ := trackedURL(link, base, msg)
+		return strings.ReplaceAll(u, "&", "&amp;")
+	}
+
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{
+			"multiple links",
+			`<p><a href="https://example.com/a">A</a> and <a class="b" href="http://example.com/b?x=1&amp;y=2">B</a></p>`,
+			`<p><a href="` + tracked("https://example.com/a") + `">A</a> and <a class="b" href="` + tracked("http://example.com/b?x=1&y=2") + `">B</a></p>`,
+		},
+		{
+			"skipped schemes",
+			`<a href="mailto:a@example.com">m</a><a href="tel:+15551234567">t</a><a href="#top">top</a><a href="/relative">r</a><a>none</a>`,
+			`<a href="mailto:a@example.com">m</a><a href="tel:+15551234567">t</a><a href="#top">top</a><a href="/relative">r</a><a>none</a>`,
+		},
+		{
+			"area tags",
+			`<map><area href="https://example.com/a"></map>`,
+			`<map><area href="` + tracked("https://example.com/a") + `"></map>`,
+		},
+		{
+			// Unclosed and stray tags are kept as they are.
+			"malformed html",
+			`<div><p>Hi <a href="https://example.com/a">link</div></span><b>bold`,
+			`<div><p>Hi <a href="` + tracked("https://example.com/a") + `">link</div></span><b>bold`,
+		},
+		{
+			"unterminated tag",
+			`<p>Hi</p><a href="https://example.com/a"`,
+			`<p>Hi</p><a href="https://example.com/a"`,
+		},
+	} {
+		if got := string(rewriteLinks([]byte(tc.in), base, msg)); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTrackedURL(t *testing.T) {
+	base, _ := url.Parse("https://track.example.com/c?src=mail")
+
+	u, ok := trackedURL(" https://example.com/a?x=1 ", base, trackingTestMessage())
+	if !ok {
+		t.Fatal("link not tracked")
+	}
+	p, err := url.Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := p.Query()
+	if p.Host != "track.example.com" || q.Get("src") != "mail" || q.Get("url") != "https://example.com/a?x=1" || q.Get("s") != "sub-1" || q.Get("c") != "camp-1" {
+		t.Errorf("got %s", u)
+	}
+
+	for _, link := range []string{"mailto:a@example.com", "tel:123", "#top", "ftp://example.com", "%zz"} {
+		if _, ok := trackedURL(link, base, trackingTestMessage()); ok {
+			t.Errorf("%s: tracked", link)
+		}
+	}
+}
+
+func TestSESClickTracking(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"click_track_base_url": "https://track.example.com/c"`)
+
+	html := trackingTestMessage()
+	html.ContentType = ContentTypeHTML
+	html.Body = []byte(`<p><a href="https://example.com/a">A</a></p>`)
+
+	// Plain text bodies are left untouched.
+	plain := trackingTestMessage()
+	plain.Body = []byte("Visit https://example.com/a")
+
+	for _, msg := range []Message{html, plain} {
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reqs := f.requests()
+	_, parts := parseEmail(t, reqs[0].rawEmail(t))
+	if got := partText(t, parts[len(parts)-1]); !strings.Contains(got, `href="https://track.example.com/c?`) || strings.Contains(got, `href="https://example.com/a"`) {
+		t.Errorf("got html body %s", got)
+	}
+	_, parts = parseEmail(t, reqs[1].rawEmail(t))
+	if got := partText(t, parts[0]); got != "Visit https://example.com/a" {
+		t.Errorf("got plain body %q", got)
+	}
+}
+
+func TestInjectPixel(t *testing.T) {
+	tpl := template.Must(template.New("pixel").Parse("https://track.example.com/o?s={{ .SubscriberUUID }}&c={{ .CampaignUUID }}"))
+	msg := trackingTestMessage()
+	msg.Subscriber.UUID = "sub 1"
+
+	const pixel = `<img src="https://track.example.com/o?s=sub+1&amp;c=camp-1" width="1" height="1" alt="" style="display:none" />`
+	for in, want := range map[string]string{
+		"<html><body><p>Hi</p></body></html>": "<html><body><p>Hi</p>" + pixel + "</body></html>",
+		"<BODY>Hi</BODY>":                     "<BODY>Hi" + pixel + "</BODY>",
+		// Without a closing body tag, the pixel is appended.
+		"<p>Hi</p>": "<p>Hi</p>" + pixel,
+		"":          pixel,
+	} {
+		got, err := injectPixel([]byte(in), tpl, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%q: got %s, want %s", in, got, want)
+		}
+	}
+
+	// Campaign is nil for transactional messages.
+	msg.Campaign = nil
+	got, err := injectPixel([]byte("<p>Hi</p>"), tpl, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "s=sub+1&amp;c=\"") {
+		t.Errorf("got %s", got)
+	}
+
+	bad := template.Must(template.New("pixel").Parse("{{ .Missing }}"))
+	if _, err := injectPixel([]byte("<p>Hi</p>"), bad, msg); err == nil {
+		t.Error("expected an error for a template that fails to render")
+	}
+}
+
+func TestSESTrackingPixel(t *testing.T) {
+	m, f := newTestSES(t, "ses", `"tracking_pixel_url": "https://track.example.com/o/{{ .SubscriberUUID }}"`)
+
+	html := trackingTestMessage()
+	html.ContentType = ContentTypeHTML
+	html.Body = []byte("<body><p>Hi</p></body>")
+
+	// Plain text bodies are left untouched.
+	plain := trackingTestMessage()
+	plain.Body = []byte("Hi")
+
+	for _, msg := range []Message{html, plain} {
+		if _, err := m.Push(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reqs := f.requests()
+	_, parts := parseEmail(t, reqs[0].rawEmail(t))
+	if got := partText(t, parts[len(parts)-1]); !strings.Contains(got, `<img src="https://track.example.com/o/sub-1"`) || !strings.HasSuffix(got, "</body>") {
+		t.Errorf("got html body %s", got)
+	}
+	_, parts = parseEmail(t, reqs[1].rawEmail(t))
+	if got := partText(t, parts[0]); got != "Hi" {
+		t.Errorf("got plain body %q", got)
+	}
+
+	if _, err := NewAWSSES([]byte(`{"region": "us-east-1", "endpoint": "http://localhost", "tracking_pixel_url": "{{ .Bad"}`), onelog.New(io.Discard, 0)); err == nil {
+		t.Error("expected an error for an invalid tracking_pixel_url")
+	}
+}
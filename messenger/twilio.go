@@ -1,28 +1,43 @@
 package messenger
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	
+	"net/http"
+
 	"github.com/twilio/twilio-go"
+	twilioClient "github.com/twilio/twilio-go/client"
 	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
 
 	"github.com/francoispqt/onelog"
 )
 
 type twilioCfg struct {
-	AccountID   string `json:"account_id"`
-	AuthToken   string `json:"auth_token"`
-	SenderID    string `json:"sender_id"`
-	UploadPath  string `json:"upload_path"`
-	Log         bool   `json:"log"`
+	AccountID  string `json:"account_id"`
+	AuthToken  string `json:"auth_token"`
+	SenderID   string `json:"sender_id"`
+	ServiceSID string `json:"messaging_service_sid"`
+	UploadPath string `json:"upload_path"`
+
+	// PhoneAttribute is the subscriber attribute holding the phone
+	// number. Defaults to "phone".
+	PhoneAttribute string `json:"phone_attribute"`
+
+	// DefaultRegion is the ISO country code used to normalize phone
+	// numbers that aren't in international format, eg: "US".
+	DefaultRegion string `json:"default_region"`
+	httpClientCfg
+	logCfg
 }
 
 type twilioMessenger struct {
 	cfg    twilioCfg
 	client *twilio.RestClient
+	http   *http.Client
 
-	logger *onelog.Logger
+	logger *levelLogger
 }
 
 func (t twilioMessenger) Name() string {
@@ -30,38 +45,62 @@ func (t twilioMessenger) Name() string {
 }
 
 // Push sends the sms through twilio API.
-func (t twilioMessenger) Push(msg Message) (string, error) {
-	phone, ok := msg.Subscriber.Attribs["phone"].(string)
-	if !ok {
-		return "", fmt.Errorf("could not find subscriber phone")
+func (t twilioMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	t.logger.DebugWith("sending message").String("email", t.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	phone, err := subscriberPhone(msg, t.cfg.PhoneAttribute, t.cfg.DefaultRegion)
+	if err != nil {
+		return "", err
 	}
 
 	body := string(msg.Body)
 	payload := &twilioApi.CreateMessageParams{}
 	payload.SetTo(phone)
-	payload.SetFrom(t.cfg.SenderID)
+	if t.cfg.ServiceSID != "" {
+		payload.SetMessagingServiceSid(t.cfg.ServiceSID)
+	} else {
+		payload.SetFrom(t.cfg.SenderID)
+	}
 	payload.SetBody(body)
 	if msg.Attachments != nil {
 		media := make([]string, 0, len(msg.Attachments))
 		for _, f := range msg.Attachments {
-			media = append(media,fmt.Sprintf("%s/%s",t.cfg.UploadPath,f.Name))
+			media = append(media, fmt.Sprintf("%s/%s", t.cfg.UploadPath, f.Name))
 		}
-		if (len(media) > 0) {
+		if len(media) > 0 {
 			payload.SetMediaUrl(media)
 		}
 	}
 
+	// The twilio client doesn't accept a context, so bail out early if the
+	// caller has already given up.
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("error sending sms: %w", err)
+	}
+
 	out, err := t.client.Api.CreateMessage(payload)
 	if err != nil {
+		var tErr *twilioClient.TwilioRestError
+		if errors.As(err, &tErr) {
+			return "", fmt.Errorf("twilio error %d: %s", tErr.Code, tErr.Message)
+		}
 		return "", err
 	}
 
-	if t.cfg.Log {
+	var sid string
+	if out.Sid != nil {
+		sid = *out.Sid
+	}
+
+	// The full response echoes the recipient's number.
+	if t.logger.enabled(onelog.INFO) && !t.cfg.RedactPII {
 		response, _ := json.Marshal(*out)
 		t.logger.InfoWith("successfully sent sms").String("phone", phone).String("result", string(response)).Write()
+	} else {
+		t.logger.InfoWith("successfully sent sms").String("phone", t.logger.phone(phone)).String("message_id", sid).Write()
 	}
 
-	return "", nil
+	return sid, nil
 }
 
 func (t twilioMessenger) Flush() error {
@@ -69,9 +108,32 @@ func (t twilioMessenger) Flush() error {
 }
 
 func (t twilioMessenger) Close() error {
+	t.http.CloseIdleConnections()
 	return nil
 }
 
+// twilioTransport returns rate limited responses as a ThrottledError, as
+// the twilio client doesn't expose the response headers with its errors.
+type twilioTransport struct {
+	base *http.Transport
+}
+
+func (t twilioTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkThrottled(resp, "twilio"); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t twilioTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
 // NewTwilio creates new instance of twilio
 func NewTwilio(cfg []byte, l *onelog.Logger) (Messenger, error) {
 	var c twilioCfg
@@ -79,27 +141,44 @@ func NewTwilio(cfg []byte, l *onelog.Logger) (Messenger, error) {
 		return nil, err
 	}
 
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	if c.AccountID == "" {
 		return nil, fmt.Errorf("invalid account_id")
 	}
 	if c.AuthToken == "" {
 		return nil, fmt.Errorf("invalid auth_token")
 	}
-	if c.SenderID == "" {
-		return nil, fmt.Errorf("invalid sender_id")
+	if c.SenderID == "" && c.ServiceSID == "" {
+		return nil, fmt.Errorf("invalid sender_id or messaging_service_sid")
 	}
 	if c.UploadPath == "" {
 		return nil, fmt.Errorf("invalid upload_path")
 	}
+	if c.PhoneAttribute == "" {
+		c.PhoneAttribute = "phone"
+	}
 
-	svc := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: c.AccountID,
-		Password: c.AuthToken,
-	})
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	httpClient := newHTTPClient(c.httpClientCfg)
+	httpClient.Transport = twilioTransport{base: httpClient.Transport.(*http.Transport)}
+	base := &twilioClient.Client{
+		Credentials: twilioClient.NewCredentials(c.AccountID, c.AuthToken),
+		HTTPClient:  httpClient,
+	}
+	base.SetAccountSid(c.AccountID)
+	svc := twilio.NewRestClientWithParams(twilio.ClientParams{Client: base})
 
 	return twilioMessenger{
 		client: svc,
+		http:   httpClient,
 		cfg:    c,
-		logger: l,
+		logger: logger,
 	}, nil
 }
@@ -0,0 +1,129 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/francoispqt/onelog"
+)
+
+// redirectTwilio sends the messenger's requests, which go to Twilio's
+// fixed API URL, to srv instead.
+func redirectTwilio(m twilioMessenger, srv *httptest.Server) {
+	addr := srv.Listener.Addr().String()
+	dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	m.http.Transport = twilioTransport{base: &http.Transport{DialContext: dial, DialTLSContext: dial}}
+}
+
+func TestTwilioTransportThrottled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			_, _ = w.Write([]byte(`{"sid": "SM1"}`))
+			return
+		}
+		w.Header().Set("Retry-After", "4")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"code": 20429, "message": "Too Many Requests", "status": 429}`))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: twilioTransport{base: newHTTPTransport()}}
+
+	resp, err := client.Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	_, err = client.Get(srv.URL + "/limited")
+	var te *ThrottledError
+	if !errors.As(err, &te) || te.RetryAfter != 4*time.Second {
+		t.Fatalf("got %v, want a ThrottledError", err)
+	}
+}
+
+func TestTwilioPush(t *testing.T) {
+	var (
+		path string
+		form url.Values
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		path, form = r.URL.Path, r.PostForm
+		if form.Get("To") == "+15550000000" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code": 21211, "message": "Invalid 'To' Phone Number", "status": 400}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"sid": "SM1"}`))
+	}))
+	defer srv.Close()
+
+	newTwilio := func(cfg string) twilioMessenger {
+		m, err := NewTwilio([]byte(cfg), onelog.New(io.Discard, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirectTwilio(m.(twilioMessenger), srv)
+		return m.(twilioMessenger)
+	}
+
+	m := newTwilio(`{"account_id": "AC1", "auth_token": "t", "sender_id": "+15559999999", "upload_path": "https://example.com/uploads"}`)
+	msg := testMessage()
+	msg.Body = []byte("Hello")
+	msg.Attachments = []Attachment{{Name: "a.png"}}
+	id, err := m.Push(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "SM1" {
+		t.Errorf("got sid %q", id)
+	}
+	if path != "/2010-04-01/Accounts/AC1/Messages.json" {
+		t.Errorf("got path %s", path)
+	}
+	if form.Get("To") != "+15551234567" || form.Get("From") != "+15559999999" || form.Get("Body") != "Hello" ||
+		form.Get("MediaUrl") != "https://example.com/uploads/a.png" {
+		t.Errorf("got form %v", form)
+	}
+
+	// A messaging service is used instead of the sender when it's set.
+	m = newTwilio(`{"account_id": "AC1", "auth_token": "t", "messaging_service_sid": "MG1", "upload_path": "https://example.com"}`)
+	if _, err := m.Push(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("MessagingServiceSid") != "MG1" || form.Has("From") {
+		t.Errorf("got form %v", form)
+	}
+
+	msg = testMessage()
+	msg.Subscriber.Attribs["phone"] = "+15550000000"
+	if _, err := m.Push(context.Background(), msg); err == nil || err.Error() != "twilio error 21211: Invalid 'To' Phone Number" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestNewTwilioInvalid(t *testing.T) {
+	for _, cfg := range []string{
+		`{"auth_token": "t", "sender_id": "+15559999999", "upload_path": "https://example.com"}`,
+		`{"account_id": "AC1", "sender_id": "+15559999999", "upload_path": "https://example.com"}`,
+		`{"account_id": "AC1", "auth_token": "t", "upload_path": "https://example.com"}`,
+		`{"account_id": "AC1", "auth_token": "t", "sender_id": "+15559999999"}`,
+	} {
+		if _, err := NewTwilio([]byte(cfg), onelog.New(io.Discard, 0)); err == nil {
+			t.Errorf("%s: expected an error", cfg)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/francoispqt/onelog"
+)
+
+const vonageAPIURL = "https://rest.nexmo.com"
+
+// vonageErrors maps Vonage SMS API status codes to the package's error
+// sentinels.
+var vonageErrors = map[string]error{
+	"1":  ErrThrottled,
+	"4":  ErrAuth,
+	"6":  ErrInvalidRecipient,
+	"7":  ErrInvalidRecipient,
+	"29": ErrInvalidRecipient,
+}
+
+type vonageCfg struct {
+	APIKey    string `json:"api_key"`
+	APISecret string `json:"api_secret"`
+
+	// From is the sender, either an alphanumeric sender ID or a number.
+	From string `json:"from"`
+
+	// PhoneAttribute is the subscriber attribute holding the phone
+	// number. Defaults to "phone".
+	PhoneAttribute string `json:"phone_attribute"`
+
+	// DefaultRegion is the ISO country code used to normalize phone
+	// numbers that aren't in international format, eg: "US".
+	DefaultRegion string `json:"default_region"`
+
+	APIURL string `json:"api_url"`
+	httpClientCfg
+	logCfg
+}
+
+type vonageMessenger struct {
+	cfg    vonageCfg
+	client *http.Client
+
+	logger *levelLogger
+}
+
+type vonageResp struct {
+	Messages []struct {
+		To        string `json:"to"`
+		MessageID string `json:"message-id"`
+		Status    string `json:"status"`
+		ErrorText string `json:"error-text"`
+	} `json:"messages"`
+}
+
+func (v vonageMessenger) Name() string {
+	return "vonage"
+}
+
+// Push sends the sms through the Vonage SMS API.
+func (v vonageMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	v.logger.DebugWith("sending message").String("email", v.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	phone, err := subscriberPhone(msg, v.cfg.PhoneAttribute, v.cfg.DefaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	// Bodies that can't be encoded in GSM-7 have to be sent as unicode.
+	body := string(msg.Body)
+	typ := "text"
+	segments, encoding := smsSegments(body)
+	if encoding == smsEncodingUCS2 {
+		typ = "unicode"
+	}
+
+	form := url.Values{
+		"api_key":    {v.cfg.APIKey},
+		"api_secret": {v.cfg.APISecret},
+		"from":       {v.cfg.From},
+		"to":         {strings.TrimPrefix(phone, "+")},
+		"text":       {body},
+		"type":       {typ},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.cfg.APIURL+"/sms/json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "vonage"); err != nil {
+		return "", err
+	}
+
+	var out vonageResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding vonage response (status %d): %v", resp.StatusCode, err)
+	}
+	if len(out.Messages) == 0 {
+		return "", fmt.Errorf("vonage returned status %d with no messages", resp.StatusCode)
+	}
+
+	// Long bodies are split into one message per segment, all of which
+	// report their own status.
+	for _, m := range out.Messages {
+		if m.Status == "0" {
+			continue
+		}
+		if e, ok := vonageErrors[m.Status]; ok {
+			return "", fmt.Errorf("%w: vonage error %s: %s", e, m.Status, m.ErrorText)
+		}
+		return "", fmt.Errorf("vonage error %s: %s", m.Status, m.ErrorText)
+	}
+
+	msgID := out.Messages[0].MessageID
+	v.logger.InfoWith("successfully sent sms").String("phone", v.logger.phone(phone)).String("message_id", msgID).
+		Int("segments", segments).String("encoding", encoding).Write()
+
+	return msgID, nil
+}
+
+func (v vonageMessenger) Flush() error {
+	return nil
+}
+
+func (v vonageMessenger) Close() error {
+	v.client.CloseIdleConnections()
+	return nil
+}
+
+// NewVonage creates new instance of vonage
+func NewVonage(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c vonageCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("invalid api_key")
+	}
+	if c.APISecret == "" {
+		return nil, fmt.Errorf("invalid api_secret")
+	}
+	if c.From == "" {
+		return nil, fmt.Errorf("invalid from")
+	}
+	if c.PhoneAttribute == "" {
+		c.PhoneAttribute = "phone"
+	}
+	if c.APIURL == "" {
+		c.APIURL = vonageAPIURL
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return vonageMessenger{
+		client: newHTTPClient(c.httpClientCfg),
+		cfg:    c,
+		logger: logger,
+	}, nil
+}
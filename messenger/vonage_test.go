@@ -0,0 +1,83 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestVonagePush(t *testing.T) {
+	var (
+		path string
+		form url.Values
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		path, form = r.URL.Path, r.PostForm
+		_, _ = w.Write([]byte(`{"message-count": "1", "messages": [{"to": "15551234567", "message-id": "0A0000000123ABCD1", "status": "0"}]}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewVonage([]byte(fmt.Sprintf(`{"api_key": "key", "api_secret": "secret", "from": "Listmonk", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name, body, wantType string
+	}{
+		{"gsm", "Your code is 1234 @ £5 {ok}", "text"},
+		{"unicode", "Привет 👋", "unicode"},
+	} {
+		msg := testMessage()
+		msg.Body = []byte(c.body)
+		id, err := m.Push(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if id != "0A0000000123ABCD1" {
+			t.Errorf("%s: got id %q", c.name, id)
+		}
+		if path != "/sms/json" {
+			t.Errorf("%s: got request to %s", c.name, path)
+		}
+		for k, want := range map[string]string{
+			"api_key":    "key",
+			"api_secret": "secret",
+			"from":       "Listmonk",
+			"to":         "15551234567",
+			"text":       c.body,
+			"type":       c.wantType,
+		} {
+			if got := form.Get(k); got != want {
+				t.Errorf("%s: got %s %q, want %q", c.name, k, got, want)
+			}
+		}
+	}
+}
+
+func TestVonagePushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"message-count": "1", "messages": [{"status": "6", "error-text": "Unroutable message - rejected"}]}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewVonage([]byte(fmt.Sprintf(`{"api_key": "key", "api_secret": "secret", "from": "Listmonk", "api_url": %q}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Push(context.Background(), testMessage())
+	if !errors.Is(err, ErrInvalidRecipient) || !strings.Contains(err.Error(), "Unroutable") {
+		t.Errorf("got %v, want ErrInvalidRecipient with the vonage error", err)
+	}
+}
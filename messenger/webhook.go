@@ -0,0 +1,133 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/francoispqt/onelog"
+)
+
+type webhookCfg struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+
+	// Encoder is the name of the MessageEncoder that serializes messages,
+	// "json" (default), "form" or one added with RegisterEncoder.
+	Encoder string `json:"encoder"`
+	httpClientCfg
+	logCfg
+}
+
+type webhookMessenger struct {
+	cfg     webhookCfg
+	client  *http.Client
+	encoder MessageEncoder
+
+	logger *levelLogger
+}
+
+func (w webhookMessenger) Name() string {
+	return "webhook"
+}
+
+// Push posts the message, serialized by the configured encoder, to the
+// configured URL.
+func (w webhookMessenger) Push(ctx context.Context, msg Message) (string, error) {
+	w.logger.DebugWith("sending message").String("email", w.logger.email(msg.Subscriber.Email)).Int("bytes", msg.EstimatedBytes()).Write()
+
+	b, contentType, err := w.encoder.Encode(msg)
+	if err != nil {
+		return "", fmt.Errorf("error encoding message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.cfg.Method, w.cfg.URL, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkThrottled(resp, "webhook"); err != nil {
+		return "", err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, body)
+	}
+
+	// The response body is optional, so a missing or non-JSON body
+	// simply results in an empty ID.
+	var out struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(body, &out)
+
+	w.logger.InfoWith("successfully sent webhook").String("email", w.logger.email(msg.Subscriber.Email)).String("id", out.ID).Write()
+
+	return out.ID, nil
+}
+
+func (w webhookMessenger) Flush() error {
+	return nil
+}
+
+func (w webhookMessenger) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// NewWebhook creates new instance of webhook
+func NewWebhook(cfg []byte, l *onelog.Logger) (Messenger, error) {
+	var c webhookCfg
+	if err := json.Unmarshal(cfg, &c); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLevelLogger(l, c.logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.URL == "" {
+		return nil, fmt.Errorf("invalid url")
+	}
+	if c.Method == "" {
+		c.Method = http.MethodPost
+	}
+	if c.Encoder == "" {
+		c.Encoder = "json"
+	}
+	enc, err := lookupEncoder(c.Encoder)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.httpClientCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return webhookMessenger{
+		client:  newHTTPClient(c.httpClientCfg),
+		encoder: enc,
+		cfg:     c,
+		logger:  logger,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francoispqt/onelog"
+)
+
+func TestWebhookPush(t *testing.T) {
+	var (
+		method, ct, auth string
+		payload          webhookPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, ct, auth = r.Method, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"id": "hook-1"}`))
+	}))
+	defer srv.Close()
+
+	m, err := NewWebhook([]byte(fmt.Sprintf(`{"url": %q, "method": "PUT", "headers": {"Authorization": "Bearer t"}}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	id, err := m.Push(context.Background(), testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "hook-1" {
+		t.Errorf("got id %q", id)
+	}
+	if method != http.MethodPut || ct != "application/json" || auth != "Bearer t" {
+		t.Errorf("got %s request with Content-Type %q and Authorization %q", method, ct, auth)
+	}
+	if payload.Subject != "Hello" || payload.Body != "<p>Hello</p>" || payload.Subscriber.Email != "to@example.com" {
+		t.Errorf("got payload %+v", payload)
+	}
+}
+
+func TestWebhookPushErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("upstream down"))
+	}))
+	defer srv.Close()
+
+	// A response without a body has no ID.
+	m, err := NewWebhook([]byte(fmt.Sprintf(`{"url": "%s/empty"}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := m.Push(context.Background(), testMessage()); err != nil || id != "" {
+		t.Errorf("got %q, %v", id, err)
+	}
+
+	m, err = NewWebhook([]byte(fmt.Sprintf(`{"url": "%s/fail"}`, srv.URL)), onelog.New(io.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "502: upstream down") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestNewWebhookInvalid(t *testing.T) {
+	for _, cfg := range []string{`{}`, `{"url": "http://example.com", "encoder": "xml"}`} {
+		if _, err := NewWebhook([]byte(cfg), onelog.New(io.Discard, 0)); err == nil {
+			t.Errorf("%s: expected an error", cfg)
+		}
+	}
+}